@@ -0,0 +1,90 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/AkronimBlack/process-manager/pkg/parser"
+	"github.com/AkronimBlack/process-manager/shared"
+	"github.com/spf13/cobra"
+	"os"
+)
+
+var (
+	bpmnFileLocation   string
+	bpmnOutputLocation string
+)
+
+// processBpmnImportCmd represents the process:bpmn-import command
+var processBpmnImportCmd = &cobra.Command{
+	Use:   "process:bpmn-import",
+	Short: "Convert a BPMN 2.0 process into a json process definition",
+	Long: `Convert a BPMN 2.0 process into a json process definition.
+
+Supported are start and end events, service and user tasks, exclusive gateways comparing two values,
+timer catch events and error boundary events. Every unsupported element is listed and the command exits with 1.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		file, err := os.Open(bpmnFileLocation)
+		if err != nil {
+			fmt.Println(err.Error())
+			os.Exit(1)
+		}
+		defer file.Close()
+		actions, err := parser.ImportBpmn(file)
+		if err != nil {
+			fmt.Println(err.Error())
+			os.Exit(1)
+		}
+		processParser := parser.NewParser()
+		processParser.SetActions(actions)
+		validationErrors := processParser.Validate()
+		if len(validationErrors) != 0 {
+			fmt.Printf("invalid actions \n%s\n", shared.ToJsonPrettyString(validationErrors))
+			os.Exit(1)
+		}
+		writeOutput(bpmnOutputLocation, []byte(shared.ToJsonPrettyString(actions)+"\n"))
+	},
+}
+
+// processBpmnExportCmd represents the process:bpmn-export command
+var processBpmnExportCmd = &cobra.Command{
+	Use:   "process:bpmn-export",
+	Short: "Convert a json process definition into BPMN 2.0 with diagram layout",
+	Run: func(cmd *cobra.Command, args []string) {
+		processParser := parser.NewParser()
+		err := processParser.LoadFile(bpmnFileLocation)
+		if err != nil {
+			fmt.Println(err.Error())
+			os.Exit(1)
+		}
+		buffer := bytes.Buffer{}
+		err = parser.ExportBpmn(&buffer, processParser.Key(), processParser.Actions())
+		if err != nil {
+			fmt.Println(err.Error())
+			os.Exit(1)
+		}
+		writeOutput(bpmnOutputLocation, buffer.Bytes())
+	},
+}
+
+// writeOutput writes to the file at location, or stdout when no location is given.
+func writeOutput(location string, data []byte) {
+	if location == "" {
+		_, _ = os.Stdout.Write(data)
+		return
+	}
+	err := os.WriteFile(location, data, 0644)
+	if err != nil {
+		fmt.Println(err.Error())
+		os.Exit(1)
+	}
+}
+
+func init() {
+	rootCmd.AddCommand(processBpmnImportCmd)
+	processBpmnImportCmd.Flags().StringVarP(&bpmnFileLocation, "file-location", "f", "", "location of the bpmn file to import")
+	processBpmnImportCmd.Flags().StringVarP(&bpmnOutputLocation, "output", "o", "", "location to write the json definition to, stdout by default")
+
+	rootCmd.AddCommand(processBpmnExportCmd)
+	processBpmnExportCmd.Flags().StringVarP(&bpmnFileLocation, "file-location", "f", "", "location of the process definition to export")
+	processBpmnExportCmd.Flags().StringVarP(&bpmnOutputLocation, "output", "o", "", "location to write the bpmn file to, stdout by default")
+}
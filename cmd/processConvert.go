@@ -0,0 +1,70 @@
+package cmd
+
+import (
+	"fmt"
+	"github.com/AkronimBlack/process-manager/pkg/parser"
+	"github.com/spf13/cobra"
+	"os"
+)
+
+var (
+	convertFileLocation   string
+	convertOutputLocation string
+	convertFormat         string
+)
+
+// processConvertCmd represents the process:convert command
+var processConvertCmd = &cobra.Command{
+	Use:     "process:convert",
+	Aliases: []string{"convert"},
+	Short:   "Convert a process definition between json and yaml",
+	Long: `Convert a process definition between json and yaml.
+
+The output format is taken from --to, otherwise from the extension of --output, otherwise the opposite
+of the input format. Anchors and aliases are expanded and comments are not kept.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		inputFormat, err := parser.DefinitionFormat(convertFileLocation)
+		if err != nil {
+			fmt.Println(err.Error())
+			os.Exit(1)
+		}
+		data, err := os.ReadFile(convertFileLocation)
+		if err != nil {
+			fmt.Println(err.Error())
+			os.Exit(1)
+		}
+		actions, err := parser.ParseDefinition(data, inputFormat)
+		if err != nil {
+			fmt.Println(err.Error())
+			os.Exit(1)
+		}
+
+		outputFormat := convertFormat
+		if outputFormat == "" && convertOutputLocation != "" {
+			outputFormat, err = parser.DefinitionFormat(convertOutputLocation)
+			if err != nil {
+				fmt.Println(err.Error())
+				os.Exit(1)
+			}
+		}
+		if outputFormat == "" {
+			outputFormat = parser.DefinitionFormatYaml
+			if inputFormat == parser.DefinitionFormatYaml {
+				outputFormat = parser.DefinitionFormatJson
+			}
+		}
+		output, err := parser.MarshalDefinition(actions, outputFormat)
+		if err != nil {
+			fmt.Println(err.Error())
+			os.Exit(1)
+		}
+		writeOutput(convertOutputLocation, output)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(processConvertCmd)
+	processConvertCmd.Flags().StringVarP(&convertFileLocation, "file-location", "f", "", "location of the process definition to convert")
+	processConvertCmd.Flags().StringVarP(&convertOutputLocation, "output", "o", "", "location to write the converted definition to, stdout by default")
+	processConvertCmd.Flags().StringVar(&convertFormat, "to", "", "output format (json, yaml)")
+}
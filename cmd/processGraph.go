@@ -0,0 +1,46 @@
+package cmd
+
+import (
+	"fmt"
+	"github.com/AkronimBlack/process-manager/pkg/parser"
+	"github.com/spf13/cobra"
+	"os"
+	"strings"
+)
+
+var (
+	graphFileLocation string
+	graphFormat       string
+	graphVisited      string
+)
+
+// processGraphCmd represents the process:graph command
+var processGraphCmd = &cobra.Command{
+	Use:   "process:graph",
+	Short: "Render a process definition as a graphviz dot or mermaid flowchart",
+	Run: func(cmd *cobra.Command, args []string) {
+		processParser := parser.NewParser()
+		err := processParser.LoadFile(graphFileLocation)
+		if err != nil {
+			fmt.Println(err.Error())
+			os.Exit(1)
+		}
+		var visited []string
+		if graphVisited != "" {
+			visited = strings.Split(graphVisited, ",")
+		}
+		graph, err := parser.RenderGraph(processParser.Actions(), graphFormat, visited)
+		if err != nil {
+			fmt.Println(err.Error())
+			os.Exit(1)
+		}
+		fmt.Print(graph)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(processGraphCmd)
+	processGraphCmd.Flags().StringVarP(&graphFileLocation, "file-location", "f", "", "location of the process definition to render")
+	processGraphCmd.Flags().StringVar(&graphFormat, "format", parser.GraphFormatDot, "output format (dot, mermaid)")
+	processGraphCmd.Flags().StringVar(&graphVisited, "visited", "", "comma separated action ids of an executed path to highlight")
+}
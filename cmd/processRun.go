@@ -0,0 +1,143 @@
+package cmd
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/AkronimBlack/process-manager/pkg/parser"
+	"github.com/AkronimBlack/process-manager/shared"
+	"github.com/spf13/cobra"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+)
+
+var (
+	runFileLocation  string
+	runDataLocation  string
+	runTasksLocation string
+)
+
+// processRunCmd represents the process:run command
+var processRunCmd = &cobra.Command{
+	Use:   "process:run",
+	Short: "Execute a process definition synchronously and print the resulting session",
+	Long: `Execute a process definition in-process without starting the server.
+
+Open tasks are completed with the payloads from the --tasks file, keyed by task id, business key, definition key or task name.
+Without a tasks file the payload of every task is read as a json line from stdin.
+Exits with 1 when the session fails or waits for a task that can not be completed.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		processParser := parser.NewParser()
+		logger, _ := parser.NewLogger(os.Stderr, slog.LevelWarn, parser.LogFormatText)
+		processParser.SetLogger(logger)
+		err := processParser.LoadFile(runFileLocation)
+		if err != nil {
+			fmt.Println(err.Error())
+			os.Exit(1)
+		}
+		validationErrors := processParser.Validate()
+		if len(validationErrors) != 0 {
+			fmt.Printf("invalid actions \n%s\n", shared.ToJsonPrettyString(validationErrors))
+			os.Exit(1)
+		}
+		data := map[string]interface{}{}
+		if runDataLocation != "" {
+			err = readJsonFile(runDataLocation, &data)
+			if err != nil {
+				fmt.Println(err.Error())
+				os.Exit(1)
+			}
+		}
+		var completions parser.TaskCompletions
+		if runTasksLocation != "" {
+			err = readJsonFile(runTasksLocation, &completions)
+			if err != nil {
+				fmt.Println(err.Error())
+				os.Exit(1)
+			}
+		}
+
+		ctx := context.Background()
+		session := processParser.Run(ctx, data, nil)
+		stdin := bufio.NewReader(os.Stdin)
+		for session.Status() == parser.StatusWaiting {
+			task := parser.FirstOpenTask(session)
+			if task == nil {
+				break
+			}
+			var payload map[string]interface{}
+			if completions != nil {
+				payload, err = fileTaskPayload(task, completions)
+			} else {
+				payload, err = promptTaskPayload(task, stdin)
+			}
+			if err != nil {
+				printRunResult(session)
+				fmt.Println(err.Error())
+				os.Exit(1)
+			}
+			err = processParser.RunTask(parser.ContextWithTaskUser(ctx, parser.TaskOwner(task)), task, payload)
+			if err != nil {
+				printRunResult(session)
+				fmt.Println(err.Error())
+				os.Exit(1)
+			}
+		}
+
+		printRunResult(session)
+		if session.Status() != parser.StatusCompleted {
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(processRunCmd)
+	processRunCmd.Flags().StringVarP(&runFileLocation, "file-location", "f", "", "location of the process definition to run")
+	processRunCmd.Flags().StringVar(&runDataLocation, "data", "", "location of a json file with the session input data")
+	processRunCmd.Flags().StringVar(&runTasksLocation, "tasks", "", "location of a json file with task payloads keyed by task id, business key, definition key or name")
+}
+
+func readJsonFile(location string, target interface{}) error {
+	file, err := os.ReadFile(location)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(file, target)
+}
+
+func fileTaskPayload(task parser.Task, completions parser.TaskCompletions) (map[string]interface{}, error) {
+	if payload, ok := completions.For(task); ok {
+		return payload, nil
+	}
+	return nil, fmt.Errorf("no payload for task %s (%s) in %s", task.DefinitionKey(), task.Name(), runTasksLocation)
+}
+
+func promptTaskPayload(task parser.Task, stdin *bufio.Reader) (map[string]interface{}, error) {
+	fmt.Fprintf(os.Stderr, "task %s (%s) is waiting\nparameters: %s\npayload json (empty for {}): ",
+		task.DefinitionKey(), task.Name(), shared.ToJsonString(task.Parameters()))
+	line, err := stdin.ReadString('\n')
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	if err == io.EOF && strings.TrimSpace(line) == "" {
+		return nil, fmt.Errorf("no payload for task %s (%s), stdin closed", task.DefinitionKey(), task.Name())
+	}
+	payload := map[string]interface{}{}
+	if strings.TrimSpace(line) == "" {
+		return payload, nil
+	}
+	err = json.Unmarshal([]byte(line), &payload)
+	if err != nil {
+		return nil, fmt.Errorf("invalid payload for task %s: %w", task.DefinitionKey(), err)
+	}
+	return payload, nil
+}
+
+func printRunResult(session parser.Session) {
+	fmt.Println(shared.ToJsonPrettyString(parser.NewSessionDto(session)))
+	fmt.Printf("status: %s\nexecuted path: %s\n", session.Status(), strings.Join(parser.VisitedActions(session), " -> "))
+}
@@ -0,0 +1,31 @@
+package cmd
+
+import (
+	"fmt"
+	"github.com/AkronimBlack/process-manager/pkg/parser"
+	"github.com/AkronimBlack/process-manager/shared"
+	"github.com/spf13/cobra"
+)
+
+var (
+	schemaOutputLocation string
+)
+
+// processSchemaCmd represents the process:schema command
+var processSchemaCmd = &cobra.Command{
+	Use:   "process:schema",
+	Short: "Print the json schema of process definitions",
+	Long: `Print the json schema of process definitions for editors and CI.
+
+The schema covers the built-in action types and their args. It validates yaml definitions as well,
+e.g. with a "# yaml-language-server: $schema=definition.schema.json" comment.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		schema := parser.NewParser().DefinitionSchema()
+		writeOutput(schemaOutputLocation, []byte(fmt.Sprintln(shared.ToJsonPrettyString(schema))))
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(processSchemaCmd)
+	processSchemaCmd.Flags().StringVarP(&schemaOutputLocation, "output", "o", "", "location to write the schema to, stdout by default")
+}
@@ -0,0 +1,75 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"github.com/AkronimBlack/process-manager/pkg/parser"
+	"github.com/AkronimBlack/process-manager/shared"
+	"github.com/spf13/cobra"
+	"log/slog"
+	"os"
+	"strings"
+)
+
+var (
+	simulateFileLocation     string
+	simulateScenarioLocation string
+)
+
+// processSimulateCmd represents the process:simulate command
+var processSimulateCmd = &cobra.Command{
+	Use:   "process:simulate",
+	Short: "Dry run a process definition against scenarios with mocked handlers",
+	Long: `Dry run a process definition without calling real endpoints.
+
+Every scenario declares input data, mocked action responses keyed by action id or type, task payloads
+and the expected status, visited action ids and values. Exits with 1 when any scenario fails.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		processParser := parser.NewParser()
+		logger, _ := parser.NewLogger(os.Stderr, slog.LevelWarn, parser.LogFormatText)
+		processParser.SetLogger(logger)
+		err := processParser.LoadFile(simulateFileLocation)
+		if err != nil {
+			fmt.Println(err.Error())
+			os.Exit(1)
+		}
+		validationErrors := processParser.Validate()
+		if len(validationErrors) != 0 {
+			fmt.Printf("invalid actions \n%s\n", shared.ToJsonPrettyString(validationErrors))
+			os.Exit(1)
+		}
+		scenarios, err := parser.LoadScenarios(simulateScenarioLocation)
+		if err != nil {
+			fmt.Println(err.Error())
+			os.Exit(1)
+		}
+
+		failed := 0
+		for i, scenario := range scenarios {
+			result := processParser.Simulate(context.Background(), scenario)
+			name := result.Scenario
+			if name == "" {
+				name = fmt.Sprintf("scenario %d", i+1)
+			}
+			if result.Passed() {
+				fmt.Printf("PASS %s\n     path: %s\n", name, strings.Join(result.Visited, " -> "))
+				continue
+			}
+			failed++
+			fmt.Printf("FAIL %s\n     path: %s\n", name, strings.Join(result.Visited, " -> "))
+			for _, failure := range result.Failures {
+				fmt.Printf("     %s\n", failure)
+			}
+		}
+		fmt.Printf("%d/%d scenarios passed\n", len(scenarios)-failed, len(scenarios))
+		if failed != 0 {
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(processSimulateCmd)
+	processSimulateCmd.Flags().StringVarP(&simulateFileLocation, "file-location", "f", "", "location of the process definition to simulate")
+	processSimulateCmd.Flags().StringVarP(&simulateScenarioLocation, "scenario", "s", "", "location of a json file with one or more scenarios")
+}
@@ -4,15 +4,42 @@ Copyright © 2023 NAME HERE <EMAIL ADDRESS>
 package cmd
 
 import (
+	"context"
+	"errors"
 	"github.com/AkronimBlack/process-manager/pkg/parser"
 	"github.com/gin-gonic/gin"
 	"github.com/spf13/cobra"
+	"go.opentelemetry.io/otel"
 	"log"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+	"time"
 )
 
 var (
 	router             *gin.Engine
 	serverFileLocation string
+	traceExporter      string
+	otlpEndpoint       string
+	logLevel           string
+	logFormat          string
+	maxSteps           int
+	maxDuration        time.Duration
+	workers            int
+	queueSize          int
+	maxConcurrent      int
+	rateLimits         []string
+	checkpointDir      string
+	shutdownTimeout    time.Duration
+	retainCompleted    time.Duration
+	retainFailed       time.Duration
+	archiveDir         string
+	janitorInterval    time.Duration
+	calledProcesses    []string
 )
 
 // serverStartCmd represents the serverStart command
@@ -27,13 +54,167 @@ var serverStartCmd = &cobra.Command{
 func init() {
 	rootCmd.AddCommand(serverStartCmd)
 	serverStartCmd.Flags().StringVarP(&serverFileLocation, "file-location", "f", "", "location of json file to parse")
+	serverStartCmd.Flags().StringVar(&traceExporter, "trace-exporter", parser.TraceExporterNone, "where to export traces to (none, stdout, otlp)")
+	serverStartCmd.Flags().StringVar(&otlpEndpoint, "otlp-endpoint", "", "host:port of the otlp http collector, defaults to OTEL_EXPORTER_OTLP_ENDPOINT")
+	serverStartCmd.Flags().StringVar(&logLevel, "log-level", "info", "minimum log level (debug, info, warn, error)")
+	serverStartCmd.Flags().StringVar(&logFormat, "log-format", parser.LogFormatText, "log output format (text, json)")
+	serverStartCmd.Flags().IntVar(&maxSteps, "max-steps", 0, "actions a session may execute before it fails, 0 does not limit")
+	serverStartCmd.Flags().IntVar(&workers, "workers", 0, "sessions running at the same time, 0 runs every session right away")
+	serverStartCmd.Flags().IntVar(&queueSize, "queue-size", 0, "sessions waiting for a worker before new ones are rejected, 0 does not limit")
+	serverStartCmd.Flags().IntVar(&maxConcurrent, "max-concurrent", 0, "sessions of the definition running at the same time, 0 does not limit")
+	serverStartCmd.Flags().StringArrayVar(&rateLimits, "rate-limit", nil, "rate limiter http actions reference by name, e.g. partner=10/s,burst=5,concurrency=2")
+	serverStartCmd.Flags().DurationVar(&maxDuration, "max-duration", 0, "time a session may take before it fails, 0 does not limit")
+	serverStartCmd.Flags().StringVar(&checkpointDir, "checkpoint-dir", "", "directory unfinished sessions are checkpointed to on shutdown and restored from on start")
+	serverStartCmd.Flags().DurationVar(&retainCompleted, "retain-completed", 0, "time completed sessions are kept, e.g. 720h, 0 keeps them")
+	serverStartCmd.Flags().DurationVar(&retainFailed, "retain-failed", 0, "time failed sessions are kept, e.g. 2160h, 0 keeps them")
+	serverStartCmd.Flags().StringVar(&archiveDir, "archive-dir", "", "directory expired sessions are archived to as compressed json lines")
+	serverStartCmd.Flags().DurationVar(&janitorInterval, "janitor-interval", time.Minute, "how often expired sessions are deleted")
+	serverStartCmd.Flags().StringArrayVar(&calledProcesses, "call-process", nil, "location of a definition call_activity actions start by its file name")
+	serverStartCmd.Flags().DurationVar(&shutdownTimeout, "shutdown-timeout", 30*time.Second, "time running actions of each process may take to finish on shutdown")
 }
 
 func spinUp() {
-	router = gin.Default()
-	parser.BuildHttp(router, serverFileLocation)
-	err := router.Run("0.0.0.0:8080")
+	level, err := parser.ParseLogLevel(logLevel)
+	if err != nil {
+		log.Panic(err)
+	}
+	logger, err := parser.NewLogger(os.Stdout, level, logFormat)
+	if err != nil {
+		log.Panic(err)
+	}
+	slog.SetDefault(logger)
+
+	tracerProvider, err := parser.NewTracerProvider(context.Background(), traceExporter, otlpEndpoint)
 	if err != nil {
 		log.Panic(err)
 	}
+	defer tracerProvider.Shutdown(context.Background())
+	otel.SetTracerProvider(tracerProvider)
+	otel.SetTextMapPropagator(parser.Propagator)
+
+	processParser := parser.NewParser()
+	processParser.SetLogger(logger)
+	processParser.SetLimits(parser.Limits{MaxSteps: maxSteps, MaxDuration: maxDuration})
+	for _, rateLimit := range rateLimits {
+		name, limit, err := parser.ParseRateLimit(rateLimit)
+		if err != nil {
+			log.Panic(err)
+		}
+		processParser.AddRateLimiter(name, parser.NewRateLimiter(limit))
+	}
+	if checkpointDir != "" {
+		store, err := parser.NewFileSessionStore(checkpointDir)
+		if err != nil {
+			log.Panic(err)
+		}
+		processParser.SetSessionStore(store)
+	}
+	if serverFileLocation != "" {
+		err = processParser.LoadFile(serverFileLocation)
+		if err != nil {
+			log.Panic(err)
+		}
+	}
+
+	for _, location := range calledProcesses {
+		calledParser := parser.NewParser()
+		calledParser.SetLogger(logger)
+		calledParser.SetLimits(processParser.Limits())
+		err = calledParser.LoadFile(location)
+		if err != nil {
+			log.Panic(err)
+		}
+		if checkpointDir != "" {
+			store, err := parser.NewFileSessionStore(filepath.Join(checkpointDir, calledParser.Key()))
+			if err != nil {
+				log.Panic(err)
+			}
+			calledParser.SetSessionStore(store)
+		}
+		processParser.AddCalledProcess(calledParser)
+	}
+
+	if archiveDir != "" {
+		archive, err := parser.NewFileSessionArchive(archiveDir)
+		if err != nil {
+			log.Panic(err)
+		}
+		processParser.SetSessionArchive(archive)
+	}
+	if retainCompleted > 0 || retainFailed > 0 {
+		processParser.SetRetentionPolicies(map[string]parser.RetentionPolicy{
+			processParser.Key(): {Completed: retainCompleted, Failed: retainFailed},
+		})
+	}
+
+	if workers > 0 {
+		definitionLimits := map[string]int{}
+		if maxConcurrent > 0 {
+			definitionLimits[processParser.Key()] = maxConcurrent
+		}
+		processParser.SetWorkerPool(parser.NewWorkerPool(parser.WorkerPoolOptions{
+			Workers:          workers,
+			QueueSize:        queueSize,
+			DefinitionLimits: definitionLimits,
+		}))
+	}
+
+	restored, err := processParser.RestoreSessions(context.Background())
+	if err != nil {
+		logger.Error("restoring sessions failed", slog.String("error", err.Error()))
+	}
+	logger.Info("sessions restored", slog.Int("restored", restored))
+	for _, calledParser := range processParser.CalledProcesses() {
+		restored, err := calledParser.RestoreSessions(context.Background())
+		if err != nil {
+			logger.Error("restoring called process sessions failed", slog.String("process", calledParser.Key()), slog.String("error", err.Error()))
+		}
+		logger.Info("called process sessions restored", slog.String("process", calledParser.Key()), slog.Int("restored", restored))
+	}
+
+	router = gin.Default()
+	parser.BuildParserHttp(router, processParser)
+	server := &http.Server{Addr: "0.0.0.0:8080", Handler: router}
+	serverErr := make(chan error, 1)
+	go func() {
+		serverErr <- server.ListenAndServe()
+	}()
+
+	signalCtx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	if retainCompleted > 0 || retainFailed > 0 {
+		go processParser.RunJanitor(signalCtx, janitorInterval)
+	}
+	select {
+	case err = <-serverErr:
+		if !errors.Is(err, http.ErrServerClosed) {
+			log.Panic(err)
+		}
+		return
+	case <-signalCtx.Done():
+	}
+
+	logger.Info("shutting down", slog.Duration("timeout", shutdownTimeout))
+	serverCtx, cancelServer := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancelServer()
+	serverShutdown := make(chan error, 1)
+	go func() {
+		serverShutdown <- server.Shutdown(serverCtx)
+	}()
+	// the parsers drain with their own deadline, stopping them ends the ?wait requests the server waits for
+	drainCtx, cancelDrain := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancelDrain()
+	if err = processParser.Shutdown(drainCtx); err != nil {
+		logger.Error("checkpointing sessions failed", slog.String("error", err.Error()))
+	}
+	for _, calledParser := range processParser.CalledProcesses() {
+		calledCtx, cancelCalled := context.WithTimeout(context.Background(), shutdownTimeout)
+		if err = calledParser.Shutdown(calledCtx); err != nil {
+			logger.Error("shutting down called process failed", slog.String("error", err.Error()))
+		}
+		cancelCalled()
+	}
+	if err = <-serverShutdown; err != nil {
+		logger.Error("http server shutdown failed", slog.String("error", err.Error()))
+	}
 }
@@ -0,0 +1,745 @@
+package parser
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"github.com/AkronimBlack/process-manager/shared"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	BpmnNamespace = "http://www.omg.org/spec/BPMN/20100524/MODEL"
+	// BpmnExtensionNamespace holds the action type and args an action needs beyond plain BPMN.
+	BpmnExtensionNamespace = "https://github.com/AkronimBlack/process-manager/bpmn"
+
+	bpmnDiNamespace = "http://www.omg.org/spec/BPMN/20100524/DI"
+	dcNamespace     = "http://www.omg.org/spec/DD/20100524/DC"
+	diNamespace     = "http://www.omg.org/spec/DD/20100524/DI"
+	xsiNamespace    = "http://www.w3.org/2001/XMLSchema-instance"
+
+	// bpmnUnhandledError is the on_failure of actions without an error boundary event, it ends the session.
+	bpmnUnhandledError = "end"
+)
+
+// UnsupportedElement is a BPMN element the engine can not execute.
+type UnsupportedElement struct {
+	ID      string `json:"id"`
+	Element string `json:"element"`
+	Reason  string `json:"reason"`
+}
+
+func (e UnsupportedElement) String() string {
+	return fmt.Sprintf("%s %s: %s", e.Element, e.ID, e.Reason)
+}
+
+// UnsupportedElementsError lists every element that prevented an import.
+type UnsupportedElementsError []UnsupportedElement
+
+func (e UnsupportedElementsError) Error() string {
+	lines := []string{fmt.Sprintf("%d unsupported bpmn elements", len(e))}
+	for _, element := range e {
+		lines = append(lines, "  "+element.String())
+	}
+	return strings.Join(lines, "\n")
+}
+
+var unsupportedBpmnElements = map[string]string{
+	"parallelGateway":        "the engine runs parallel branches one after another, model the branches in sequence",
+	"inclusiveGateway":       "the engine follows a single path, use an exclusive gateway",
+	"eventBasedGateway":      "event based gateways are not supported",
+	"complexGateway":         "complex gateways are not supported",
+	"subProcess":             "sub processes are not supported, model the sub process inline",
+	"transaction":            "transactions are not supported",
+	"task":                   "plain tasks have no behavior, use a service or user task",
+	"intermediateThrowEvent": "throw events are not supported",
+}
+
+// ignoredBpmnElements carry no behavior and are skipped on import.
+var ignoredBpmnElements = map[string]bool{
+	"documentation":       true,
+	"extensionElements":   true,
+	"laneSet":             true,
+	"textAnnotation":      true,
+	"association":         true,
+	"dataObject":          true,
+	"dataObjectReference": true,
+	"dataStoreReference":  true,
+	"ioSpecification":     true,
+	"property":            true,
+}
+
+var (
+	bpmnComparison  = regexp.MustCompile(`^(.+?)\s*(==|>=|<=|!=|>|<)\s*(.+)$`)
+	bpmnIsoDuration = regexp.MustCompile(`^P(?:(\d+)D)?(?:T(?:(\d+)H)?(?:(\d+)M)?(?:(\d+(?:\.\d+)?)S)?)?$`)
+
+	bpmnOperators = map[string]string{">": IsGreater, "<": IsLower, "==": IsEqual}
+)
+
+// xmlElement is a generic xml tree, prefixes are resolved to namespaces by the decoder.
+type xmlElement struct {
+	XMLName  xml.Name
+	Attrs    []xml.Attr   `xml:",any,attr"`
+	Children []xmlElement `xml:",any"`
+	Text     string       `xml:",chardata"`
+}
+
+func (e xmlElement) attr(name string) string {
+	for _, attr := range e.Attrs {
+		if attr.Name.Local == name && (attr.Name.Space == "" || attr.Name.Space == BpmnExtensionNamespace) {
+			return attr.Value
+		}
+	}
+	return ""
+}
+
+func (e xmlElement) child(name string) *xmlElement {
+	for i := range e.Children {
+		if e.Children[i].XMLName.Local == name {
+			return &e.Children[i]
+		}
+	}
+	return nil
+}
+
+func (e xmlElement) eventDefinitions() []string {
+	definitions := make([]string, 0)
+	for _, child := range e.Children {
+		if strings.HasSuffix(child.XMLName.Local, "EventDefinition") {
+			definitions = append(definitions, child.XMLName.Local)
+		}
+	}
+	return definitions
+}
+
+type bpmnFlow struct {
+	id        string
+	source    string
+	target    string
+	condition string
+}
+
+type bpmnImporter struct {
+	nodes       map[string]xmlElement
+	order       []string
+	outgoing    map[string][]bpmnFlow
+	boundaries  map[string]string
+	unsupported UnsupportedElementsError
+}
+
+// ImportBpmn converts the supported subset of a BPMN 2.0 process into actions. Start and end events, service and
+// user tasks, call activities, exclusive gateways comparing two values, timer catch events and error boundary
+// events are supported, every other element is reported in an UnsupportedElementsError.
+//
+// Service tasks run the action type in their pm:type attribute, http by default. Args are read from a
+// pm:args json element in extensionElements. The on_failure of a task is the target of its error boundary
+// event, without one a failure ends the session. Call activities call the process in calledElement.
+func ImportBpmn(r io.Reader) (Actions, error) {
+	definitions := xmlElement{}
+	err := xml.NewDecoder(r).Decode(&definitions)
+	if err != nil {
+		return nil, fmt.Errorf("reading bpmn: %w", err)
+	}
+	if definitions.XMLName.Local != "definitions" {
+		return nil, fmt.Errorf("reading bpmn: expected definitions, got %s", definitions.XMLName.Local)
+	}
+	importer := &bpmnImporter{
+		nodes:      map[string]xmlElement{},
+		outgoing:   map[string][]bpmnFlow{},
+		boundaries: map[string]string{},
+	}
+	var process *xmlElement
+	for i, child := range definitions.Children {
+		if child.XMLName.Local != "process" || len(child.Children) == 0 {
+			continue
+		}
+		if process != nil {
+			importer.report(child, "only a single process per definition is supported")
+			continue
+		}
+		process = &definitions.Children[i]
+	}
+	if process == nil {
+		return nil, fmt.Errorf("reading bpmn: no process found")
+	}
+	importer.read(*process)
+	actions := importer.actions()
+	if len(importer.unsupported) != 0 {
+		return nil, importer.unsupported
+	}
+	actions.setIds()
+	return actions, nil
+}
+
+func (im *bpmnImporter) report(element xmlElement, reason string) {
+	im.unsupported = append(im.unsupported, UnsupportedElement{ID: element.attr("id"), Element: element.XMLName.Local, Reason: reason})
+}
+
+func (im *bpmnImporter) read(process xmlElement) {
+	for _, element := range process.Children {
+		name := element.XMLName.Local
+		switch name {
+		case "sequenceFlow":
+			flow := bpmnFlow{id: element.attr("id"), source: element.attr("sourceRef"), target: element.attr("targetRef")}
+			if condition := element.child("conditionExpression"); condition != nil {
+				flow.condition = strings.TrimSpace(condition.Text)
+			}
+			im.outgoing[flow.source] = append(im.outgoing[flow.source], flow)
+		case "startEvent", "endEvent", "serviceTask", "userTask", "callActivity", "exclusiveGateway", "intermediateCatchEvent":
+			im.nodes[element.attr("id")] = element
+			im.order = append(im.order, element.attr("id"))
+		case "boundaryEvent":
+			if element.child("errorEventDefinition") == nil {
+				im.report(element, "only error boundary events are supported, they lead to on_failure")
+				continue
+			}
+			im.boundaries[element.attr("attachedToRef")] = element.attr("id")
+			im.nodes[element.attr("id")] = element
+		default:
+			if ignoredBpmnElements[name] {
+				continue
+			}
+			reason, ok := unsupportedBpmnElements[name]
+			if !ok {
+				reason = "not supported by the engine"
+			}
+			im.report(element, reason)
+		}
+	}
+}
+
+func (im *bpmnImporter) actions() Actions {
+	actions := Actions{}
+	starts := 0
+	for _, id := range im.order {
+		element := im.nodes[id]
+		switch element.XMLName.Local {
+		case "startEvent":
+			starts++
+			if len(element.eventDefinitions()) != 0 {
+				im.report(element, "only none start events are supported")
+			}
+			actions[StartNode] = &Action{ActionType: StartNode, Args: Args{}, OnSuccess: im.next(element)}
+		case "endEvent":
+			for _, definition := range element.eventDefinitions() {
+				if definition != "terminateEventDefinition" {
+					im.report(element, fmt.Sprintf("end events with %s are not supported", definition))
+				}
+			}
+		case "serviceTask":
+			actionType := element.attr("type")
+			if actionType == "" {
+				actionType = HttpAction
+			}
+			actions[id] = &Action{ActionType: actionType, Args: im.args(element), OnSuccess: im.next(element), OnFailure: im.failure(id)}
+		case "userTask":
+			args := im.args(element)
+			if _, ok := args["name"]; !ok && element.attr("name") != "" {
+				args["name"] = element.attr("name")
+			}
+			if _, ok := args["wait"]; !ok {
+				args["wait"] = true
+			}
+			actions[id] = &Action{ActionType: TaskAction, Args: args, OnSuccess: im.next(element), OnFailure: im.failure(id)}
+		case "callActivity":
+			args := im.args(element)
+			if element.attr("calledElement") == "" {
+				im.report(element, "call activities need the key of the called process in calledElement")
+			}
+			args["process"] = element.attr("calledElement")
+			actions[id] = &Action{ActionType: CallActivityAction, Args: args, OnSuccess: im.next(element), OnFailure: im.failure(id)}
+		case "exclusiveGateway":
+			if len(im.outgoing[id]) == 1 {
+				// merging gateways only join paths, flows into them continue at their single target
+				continue
+			}
+			if action := im.gateway(element); action != nil {
+				actions[id] = action
+			}
+		case "intermediateCatchEvent":
+			if action := im.timer(element); action != nil {
+				actions[id] = action
+			}
+		}
+	}
+	if starts != 1 {
+		im.unsupported = append(im.unsupported, UnsupportedElement{
+			Element: "startEvent",
+			Reason:  fmt.Sprintf("a process needs exactly one start event, found %d", starts),
+		})
+	}
+	return actions
+}
+
+// next is the action the single outgoing flow of an element leads to.
+func (im *bpmnImporter) next(element xmlElement) string {
+	flows := im.outgoing[element.attr("id")]
+	if len(flows) != 1 {
+		im.report(element, fmt.Sprintf("expected a single outgoing sequence flow, found %d, branch with an exclusive gateway", len(flows)))
+		return ""
+	}
+	return im.resolve(flows[0].target)
+}
+
+// resolve skips merging gateways, a flow into one continues at the gateway's target.
+func (im *bpmnImporter) resolve(target string) string {
+	for i := 0; i < len(im.nodes); i++ {
+		element, ok := im.nodes[target]
+		if !ok || element.XMLName.Local != "exclusiveGateway" || len(im.outgoing[target]) != 1 {
+			return target
+		}
+		target = im.outgoing[target][0].target
+	}
+	return target
+}
+
+func (im *bpmnImporter) failure(id string) string {
+	boundary, ok := im.boundaries[id]
+	if !ok {
+		return bpmnUnhandledError
+	}
+	return im.next(im.nodes[boundary])
+}
+
+func (im *bpmnImporter) args(element xmlElement) Args {
+	args := Args{}
+	extensions := element.child("extensionElements")
+	if extensions == nil {
+		return args
+	}
+	for _, extension := range extensions.Children {
+		if extension.XMLName.Space != BpmnExtensionNamespace || extension.XMLName.Local != "args" {
+			continue
+		}
+		err := json.Unmarshal([]byte(extension.Text), &args)
+		if err != nil {
+			im.report(element, fmt.Sprintf("invalid pm:args: %s", err))
+		}
+	}
+	return args
+}
+
+// gateway converts an exclusive gateway with one conditional and one default flow into a comparison.
+func (im *bpmnImporter) gateway(element xmlElement) *Action {
+	flows := im.outgoing[element.attr("id")]
+	if len(flows) != 2 {
+		im.report(element, fmt.Sprintf("expected a conditional and a default outgoing flow, found %d flows", len(flows)))
+		return nil
+	}
+	conditional, fallback := flows[0], flows[1]
+	if conditional.id == element.attr("default") || conditional.condition == "" {
+		conditional, fallback = fallback, conditional
+	}
+	if conditional.condition == "" || (fallback.condition != "" && fallback.id != element.attr("default")) {
+		im.report(element, "expected exactly one conditional and one default outgoing flow")
+		return nil
+	}
+	actionType, comparing, compareTo, err := parseBpmnCondition(conditional.condition)
+	if err != nil {
+		im.report(element, err.Error())
+		return nil
+	}
+	args := im.args(element)
+	args[comparingKey] = comparing
+	args[compareToKey] = compareTo
+	return &Action{ActionType: actionType, Args: args, OnSuccess: im.resolve(conditional.target), OnFailure: im.resolve(fallback.target)}
+}
+
+func (im *bpmnImporter) timer(element xmlElement) *Action {
+	definition := element.child("timerEventDefinition")
+	if definition == nil {
+		im.report(element, "only timer catch events are supported")
+		return nil
+	}
+	args := im.args(element)
+	switch {
+	case definition.child("timeDuration") != nil:
+		duration, err := fromIsoDuration(strings.TrimSpace(definition.child("timeDuration").Text))
+		if err != nil {
+			im.report(element, err.Error())
+			return nil
+		}
+		args["duration"] = duration
+	case definition.child("timeDate") != nil:
+		args["until"] = strings.TrimSpace(definition.child("timeDate").Text)
+	default:
+		im.report(element, "only timeDuration and timeDate timers are supported")
+		return nil
+	}
+	return &Action{ActionType: TimerAction, Args: args, OnSuccess: im.next(element), OnFailure: bpmnUnhandledError}
+}
+
+// parseBpmnCondition reads conditions like "{{input_data.amount}} > 10" or "${amount > 10}".
+func parseBpmnCondition(condition string) (string, string, string, error) {
+	expression := condition
+	if strings.HasPrefix(expression, "${") && strings.HasSuffix(expression, "}") {
+		expression = strings.TrimSpace(expression[2 : len(expression)-1])
+	}
+	match := bpmnComparison.FindStringSubmatch(expression)
+	if match == nil {
+		return "", "", "", fmt.Errorf("condition %q is not a comparison", condition)
+	}
+	actionType, ok := bpmnOperators[match[2]]
+	if !ok {
+		return "", "", "", fmt.Errorf("operator %s in condition %q is not supported, use >, < or ==", match[2], condition)
+	}
+	return actionType, strings.TrimSpace(match[1]), strings.TrimSpace(match[3]), nil
+}
+
+// fromIsoDuration converts ISO 8601 durations like PT1H30M to go notation, placeholders and go durations are kept.
+func fromIsoDuration(value string) (string, error) {
+	if IsPlaceholder(value) {
+		return value, nil
+	}
+	if _, err := time.ParseDuration(value); err == nil {
+		return value, nil
+	}
+	match := bpmnIsoDuration.FindStringSubmatch(value)
+	if match == nil || value == "P" || value == "PT" {
+		return "", fmt.Errorf("timer duration %s is not supported, use days, hours, minutes and seconds", value)
+	}
+	units := []time.Duration{24 * time.Hour, time.Hour, time.Minute, time.Second}
+	var duration time.Duration
+	for i, unit := range units {
+		if match[i+1] == "" {
+			continue
+		}
+		amount, _ := strconv.ParseFloat(match[i+1], 64)
+		duration += time.Duration(amount * float64(unit))
+	}
+	return duration.String(), nil
+}
+
+// toIsoDuration converts go durations to ISO 8601, anything else is kept as is.
+func toIsoDuration(value string) string {
+	duration, err := time.ParseDuration(value)
+	if err != nil {
+		return value
+	}
+	iso := "PT"
+	if hours := duration / time.Hour; hours != 0 {
+		iso += fmt.Sprintf("%dH", hours)
+		duration -= hours * time.Hour
+	}
+	if minutes := duration / time.Minute; minutes != 0 {
+		iso += fmt.Sprintf("%dM", minutes)
+		duration -= minutes * time.Minute
+	}
+	if duration != 0 || iso == "PT" {
+		iso += strconv.FormatFloat(duration.Seconds(), 'f', -1, 64) + "S"
+	}
+	return iso
+}
+
+type bpmnDefinitions struct {
+	XMLName         xml.Name    `xml:"bpmn:definitions"`
+	Bpmn            string      `xml:"xmlns:bpmn,attr"`
+	BpmnDi          string      `xml:"xmlns:bpmndi,attr"`
+	Dc              string      `xml:"xmlns:dc,attr"`
+	Di              string      `xml:"xmlns:di,attr"`
+	Xsi             string      `xml:"xmlns:xsi,attr"`
+	Pm              string      `xml:"xmlns:pm,attr"`
+	ID              string      `xml:"id,attr"`
+	TargetNamespace string      `xml:"targetNamespace,attr"`
+	Process         bpmnProcess `xml:"bpmn:process"`
+	Diagram         bpmnDiagram `xml:"bpmndi:BPMNDiagram"`
+}
+
+type bpmnProcess struct {
+	ID           string             `xml:"id,attr"`
+	Name         string             `xml:"name,attr"`
+	IsExecutable bool               `xml:"isExecutable,attr"`
+	Nodes        []*bpmnNode        `xml:",any"`
+	Flows        []bpmnSequenceFlow `xml:"bpmn:sequenceFlow"`
+}
+
+type bpmnNode struct {
+	XMLName       xml.Name
+	ID            string          `xml:"id,attr"`
+	Name          string          `xml:"name,attr,omitempty"`
+	Type          string          `xml:"pm:type,attr,omitempty"`
+	Default       string          `xml:"default,attr,omitempty"`
+	AttachedToRef string          `xml:"attachedToRef,attr,omitempty"`
+	CalledElement string          `xml:"calledElement,attr,omitempty"`
+	Extensions    *bpmnExtensions `xml:"bpmn:extensionElements"`
+	Incoming      []string        `xml:"bpmn:incoming"`
+	Outgoing      []string        `xml:"bpmn:outgoing"`
+	Timer         *bpmnTimer      `xml:"bpmn:timerEventDefinition"`
+	Error         *struct{}       `xml:"bpmn:errorEventDefinition"`
+}
+
+type bpmnExtensions struct {
+	Args bpmnCdata `xml:"pm:args"`
+}
+
+type bpmnCdata struct {
+	Value string `xml:",cdata"`
+}
+
+type bpmnTimer struct {
+	Duration *bpmnExpression `xml:"bpmn:timeDuration"`
+	Date     *bpmnExpression `xml:"bpmn:timeDate"`
+}
+
+type bpmnExpression struct {
+	Type  string `xml:"xsi:type,attr"`
+	Value string `xml:",chardata"`
+}
+
+type bpmnSequenceFlow struct {
+	ID        string          `xml:"id,attr"`
+	SourceRef string          `xml:"sourceRef,attr"`
+	TargetRef string          `xml:"targetRef,attr"`
+	Condition *bpmnExpression `xml:"bpmn:conditionExpression"`
+}
+
+type bpmnDiagram struct {
+	ID    string    `xml:"id,attr"`
+	Plane bpmnPlane `xml:"bpmndi:BPMNPlane"`
+}
+
+type bpmnPlane struct {
+	ID      string      `xml:"id,attr"`
+	Element string      `xml:"bpmnElement,attr"`
+	Shapes  []bpmnShape `xml:"bpmndi:BPMNShape"`
+	Edges   []bpmnEdge  `xml:"bpmndi:BPMNEdge"`
+}
+
+type bpmnShape struct {
+	ID      string     `xml:"id,attr"`
+	Element string     `xml:"bpmnElement,attr"`
+	Bounds  bpmnBounds `xml:"dc:Bounds"`
+}
+
+type bpmnBounds struct {
+	X      int `xml:"x,attr"`
+	Y      int `xml:"y,attr"`
+	Width  int `xml:"width,attr"`
+	Height int `xml:"height,attr"`
+}
+
+type bpmnEdge struct {
+	ID        string         `xml:"id,attr"`
+	Element   string         `xml:"bpmnElement,attr"`
+	Waypoints []bpmnWaypoint `xml:"di:waypoint"`
+}
+
+type bpmnWaypoint struct {
+	X int `xml:"x,attr"`
+	Y int `xml:"y,attr"`
+}
+
+type bpmnExporter struct {
+	actions Actions
+	process *bpmnProcess
+	nodes   map[string]*bpmnNode
+}
+
+// ExportBpmn writes the actions as an executable BPMN 2.0 process with diagram interchange, so modeling tools can
+// open it. Action types and args are kept in the pm extension namespace, ImportBpmn reads them back.
+func ExportBpmn(w io.Writer, key string, actions Actions) error {
+	exporter := &bpmnExporter{
+		actions: actions,
+		process: &bpmnProcess{ID: key, Name: key, IsExecutable: true},
+		nodes:   map[string]*bpmnNode{},
+	}
+	for _, id := range sortedActionIds(actions) {
+		exporter.action(id, actions[id])
+	}
+	for _, flow := range exporter.process.Flows {
+		if _, ok := exporter.nodes[flow.TargetRef]; !ok {
+			exporter.node("endEvent", flow.TargetRef)
+		}
+		exporter.nodes[flow.SourceRef].Outgoing = append(exporter.nodes[flow.SourceRef].Outgoing, flow.ID)
+		exporter.nodes[flow.TargetRef].Incoming = append(exporter.nodes[flow.TargetRef].Incoming, flow.ID)
+	}
+
+	definitions := bpmnDefinitions{
+		Bpmn:            BpmnNamespace,
+		BpmnDi:          bpmnDiNamespace,
+		Dc:              dcNamespace,
+		Di:              diNamespace,
+		Xsi:             xsiNamespace,
+		Pm:              BpmnExtensionNamespace,
+		ID:              "definitions_" + key,
+		TargetNamespace: BpmnExtensionNamespace,
+		Process:         *exporter.process,
+		Diagram:         exporter.diagram(),
+	}
+	_, err := io.WriteString(w, xml.Header)
+	if err != nil {
+		return err
+	}
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	err = encoder.Encode(definitions)
+	if err != nil {
+		return err
+	}
+	_, err = io.WriteString(w, "\n")
+	return err
+}
+
+func (ex *bpmnExporter) node(element, id string) *bpmnNode {
+	node := &bpmnNode{XMLName: xml.Name{Local: "bpmn:" + element}, ID: id}
+	ex.process.Nodes = append(ex.process.Nodes, node)
+	ex.nodes[id] = node
+	return node
+}
+
+func (ex *bpmnExporter) flow(source, target, suffix string) *bpmnSequenceFlow {
+	if target == "" {
+		target = bpmnUnhandledError
+	}
+	ex.process.Flows = append(ex.process.Flows, bpmnSequenceFlow{ID: source + "_" + suffix, SourceRef: source, TargetRef: target})
+	return &ex.process.Flows[len(ex.process.Flows)-1]
+}
+
+func (ex *bpmnExporter) action(id string, action *Action) {
+	args := Args{}
+	for key, value := range action.Args {
+		args[key] = value
+	}
+	switch action.ActionType {
+	case StartNode:
+		ex.node("startEvent", id)
+		ex.flow(id, action.OnSuccess, edgeOnSuccess)
+		return
+	case IsGreater, IsLower, IsEqual:
+		node := ex.node("exclusiveGateway", id)
+		node.Name = id
+		node.Default = id + "_" + edgeOnFailure
+		operator := map[string]string{IsGreater: ">", IsLower: "<", IsEqual: "=="}[action.ActionType]
+		condition := fmt.Sprintf("%v %s %v", args.Get(comparingKey), operator, args.Get(compareToKey))
+		delete(args, comparingKey)
+		delete(args, compareToKey)
+		node.Extensions = bpmnArgs(args)
+		ex.flow(id, action.OnSuccess, edgeOnSuccess).Condition = &bpmnExpression{Type: "bpmn:tFormalExpression", Value: condition}
+		ex.flow(id, action.OnFailure, edgeOnFailure)
+		return
+	case TimerAction:
+		node := ex.node("intermediateCatchEvent", id)
+		node.Timer = &bpmnTimer{}
+		if until := args.GetString("until"); until != "" {
+			node.Name = "until " + until
+			node.Timer.Date = &bpmnExpression{Type: "bpmn:tFormalExpression", Value: until}
+		} else {
+			node.Name = "wait " + args.GetString("duration")
+			node.Timer.Duration = &bpmnExpression{Type: "bpmn:tFormalExpression", Value: toIsoDuration(args.GetString("duration"))}
+		}
+		delete(args, "until")
+		delete(args, "duration")
+		node.Extensions = bpmnArgs(args)
+		ex.flow(id, action.OnSuccess, edgeOnSuccess)
+		return
+	case CallActivityAction:
+		node := ex.node("callActivity", id)
+		node.Name = id
+		node.CalledElement = args.GetString("process")
+		delete(args, "process")
+		node.Extensions = bpmnArgs(args)
+		ex.flow(id, action.OnSuccess, edgeOnSuccess)
+	case TaskAction:
+		node := ex.node("userTask", id)
+		node.Name = args.GetString("name")
+		node.Extensions = bpmnArgs(args)
+		ex.flow(id, args.GetString(edgeNext, action.OnSuccess), edgeOnSuccess)
+	default:
+		node := ex.node("serviceTask", id)
+		node.Name = id
+		node.Type = action.ActionType
+		node.Extensions = bpmnArgs(args)
+		ex.flow(id, action.OnSuccess, edgeOnSuccess)
+	}
+	if action.OnFailure != "" {
+		boundary := ex.node("boundaryEvent", id+"_error")
+		boundary.AttachedToRef = id
+		boundary.Error = &struct{}{}
+		ex.flow(boundary.ID, action.OnFailure, edgeOnFailure)
+	}
+}
+
+func bpmnArgs(args Args) *bpmnExtensions {
+	if len(args) == 0 {
+		return nil
+	}
+	return &bpmnExtensions{Args: bpmnCdata{Value: shared.ToJsonString(args)}}
+}
+
+// diagram lays nodes out left to right by their distance from the start event.
+func (ex *bpmnExporter) diagram() bpmnDiagram {
+	columns := map[string]int{StartNode: 0}
+	queue := []string{StartNode}
+	for len(queue) != 0 {
+		id := queue[0]
+		queue = queue[1:]
+		for _, flow := range ex.process.Flows {
+			source := flow.SourceRef
+			if node := ex.nodes[source]; node.AttachedToRef != "" {
+				source = node.AttachedToRef
+			}
+			if _, seen := columns[flow.TargetRef]; source != id || seen {
+				continue
+			}
+			columns[flow.TargetRef] = columns[id] + 1
+			queue = append(queue, flow.TargetRef)
+		}
+	}
+	last := 0
+	for _, column := range columns {
+		if column > last {
+			last = column
+		}
+	}
+
+	bounds := map[string]bpmnBounds{}
+	rows := map[int]int{}
+	plane := bpmnPlane{ID: ex.process.ID + "_plane", Element: ex.process.ID}
+	for _, node := range ex.process.Nodes {
+		if node.AttachedToRef != "" {
+			continue
+		}
+		column, ok := columns[node.ID]
+		if !ok {
+			column = last + 1
+		}
+		width, height := 100, 80
+		switch node.XMLName.Local {
+		case "bpmn:startEvent", "bpmn:endEvent", "bpmn:intermediateCatchEvent":
+			width, height = 36, 36
+		case "bpmn:exclusiveGateway":
+			width, height = 50, 50
+		}
+		x, y := 150+column*180, 100+rows[column]*140
+		rows[column]++
+		bounds[node.ID] = bpmnBounds{X: x - width/2, Y: y - height/2, Width: width, Height: height}
+	}
+	for _, node := range ex.process.Nodes {
+		if task, ok := bounds[node.AttachedToRef]; ok && node.AttachedToRef != "" {
+			bounds[node.ID] = bpmnBounds{X: task.X + task.Width/2 - 18, Y: task.Y + task.Height - 18, Width: 36, Height: 36}
+		}
+	}
+	for _, node := range ex.process.Nodes {
+		plane.Shapes = append(plane.Shapes, bpmnShape{ID: node.ID + "_di", Element: node.ID, Bounds: bounds[node.ID]})
+	}
+
+	for _, flow := range ex.process.Flows {
+		source, target := bounds[flow.SourceRef], bounds[flow.TargetRef]
+		targetX, targetY := target.X, target.Y+target.Height/2
+		var waypoints []bpmnWaypoint
+		if ex.nodes[flow.SourceRef].AttachedToRef != "" {
+			sourceX, sourceY := source.X+source.Width/2, source.Y+source.Height
+			waypoints = []bpmnWaypoint{{sourceX, sourceY}, {sourceX, targetY}, {targetX, targetY}}
+		} else {
+			sourceX, sourceY := source.X+source.Width, source.Y+source.Height/2
+			middle := (sourceX + targetX) / 2
+			waypoints = []bpmnWaypoint{{sourceX, sourceY}, {middle, sourceY}, {middle, targetY}, {targetX, targetY}}
+		}
+		plane.Edges = append(plane.Edges, bpmnEdge{ID: flow.ID + "_di", Element: flow.ID, Waypoints: waypoints})
+	}
+	return bpmnDiagram{ID: ex.process.ID + "_diagram", Plane: plane}
+}
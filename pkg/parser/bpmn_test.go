@@ -0,0 +1,263 @@
+package parser
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const approvalBpmn = `<?xml version="1.0" encoding="UTF-8"?>
+<bpmn:definitions xmlns:bpmn="http://www.omg.org/spec/BPMN/20100524/MODEL"
+    xmlns:pm="https://github.com/AkronimBlack/process-manager/bpmn" id="definitions">
+  <bpmn:collaboration id="collaboration">
+    <bpmn:participant id="analyst" processRef="approval" />
+  </bpmn:collaboration>
+  <bpmn:process id="approval" isExecutable="true">
+    <bpmn:startEvent id="start" />
+    <bpmn:serviceTask id="fetch_score" name="Fetch score">
+      <bpmn:extensionElements>
+        <pm:args>{"url": "http://partner.test/score", "method": "get"}</pm:args>
+      </bpmn:extensionElements>
+    </bpmn:serviceTask>
+    <bpmn:boundaryEvent id="fetch_failed" attachedToRef="fetch_score">
+      <bpmn:errorEventDefinition />
+    </bpmn:boundaryEvent>
+    <bpmn:exclusiveGateway id="check_amount" default="small" />
+    <bpmn:userTask id="approve" name="Approve loan" />
+    <bpmn:exclusiveGateway id="merge" />
+    <bpmn:intermediateCatchEvent id="cool_down">
+      <bpmn:timerEventDefinition>
+        <bpmn:timeDuration>PT1H30M</bpmn:timeDuration>
+      </bpmn:timerEventDefinition>
+    </bpmn:intermediateCatchEvent>
+    <bpmn:endEvent id="done" />
+    <bpmn:endEvent id="rejected" />
+    <bpmn:sequenceFlow id="f1" sourceRef="start" targetRef="fetch_score" />
+    <bpmn:sequenceFlow id="f2" sourceRef="fetch_score" targetRef="check_amount" />
+    <bpmn:sequenceFlow id="f3" sourceRef="fetch_failed" targetRef="rejected" />
+    <bpmn:sequenceFlow id="large" sourceRef="check_amount" targetRef="approve">
+      <bpmn:conditionExpression>${ {{input_data.amount}} &gt; 1000 }</bpmn:conditionExpression>
+    </bpmn:sequenceFlow>
+    <bpmn:sequenceFlow id="small" sourceRef="check_amount" targetRef="merge" />
+    <bpmn:sequenceFlow id="f4" sourceRef="approve" targetRef="merge" />
+    <bpmn:sequenceFlow id="f5" sourceRef="merge" targetRef="cool_down" />
+    <bpmn:sequenceFlow id="f6" sourceRef="cool_down" targetRef="done" />
+  </bpmn:process>
+</bpmn:definitions>`
+
+func TestImportBpmn(t *testing.T) {
+	actions, err := ImportBpmn(strings.NewReader(approvalBpmn))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := Actions{
+		StartNode:      {ActionType: StartNode, Args: Args{}, OnSuccess: "fetch_score"},
+		"fetch_score":  {ActionType: HttpAction, Args: Args{"url": "http://partner.test/score", "method": "get"}, OnSuccess: "check_amount", OnFailure: "rejected"},
+		"check_amount": {ActionType: IsGreater, Args: Args{comparingKey: "{{input_data.amount}}", compareToKey: "1000"}, OnSuccess: "approve", OnFailure: "cool_down"},
+		"approve":      {ActionType: TaskAction, Args: Args{"name": "Approve loan", "wait": true}, OnSuccess: "cool_down", OnFailure: bpmnUnhandledError},
+		"cool_down":    {ActionType: TimerAction, Args: Args{"duration": "1h30m0s"}, OnSuccess: "done", OnFailure: bpmnUnhandledError},
+	}
+	expected.setIds()
+	if !reflect.DeepEqual(expected, actions) {
+		t.Errorf("expected %+v, got %+v", expected, actions)
+	}
+	if validationErrors := NewParser().validate(actions); !validationErrors.IsValid() {
+		t.Errorf("expected imported actions to be valid, got %v", validationErrors)
+	}
+}
+
+func TestImportBpmn_ReportsUnsupportedElements(t *testing.T) {
+	definition := `<definitions xmlns="http://www.omg.org/spec/BPMN/20100524/MODEL">
+  <process id="orders">
+    <startEvent id="start" />
+    <inclusiveGateway id="fork" />
+    <subProcess id="billing" />
+    <exclusiveGateway id="check" />
+    <sequenceFlow id="f1" sourceRef="start" targetRef="fork" />
+    <sequenceFlow id="f2" sourceRef="fork" targetRef="billing" />
+    <sequenceFlow id="f3" sourceRef="fork" targetRef="check" />
+    <sequenceFlow id="f4" sourceRef="check" targetRef="billing">
+      <conditionExpression>{{input_data.total}} &gt;= 10</conditionExpression>
+    </sequenceFlow>
+    <sequenceFlow id="f5" sourceRef="check" targetRef="end" />
+  </process>
+</definitions>`
+	_, err := ImportBpmn(strings.NewReader(definition))
+	var unsupported UnsupportedElementsError
+	if !errors.As(err, &unsupported) {
+		t.Fatalf("expected unsupported elements, got %v", err)
+	}
+	reported := map[string]string{}
+	for _, element := range unsupported {
+		reported[element.ID] = element.Element
+	}
+	expected := map[string]string{"fork": "inclusiveGateway", "billing": "subProcess", "check": "exclusiveGateway"}
+	if !reflect.DeepEqual(expected, reported) {
+		t.Errorf("expected %v reported, got %s", expected, err)
+	}
+}
+
+const fulfillmentBpmn = `<?xml version="1.0" encoding="UTF-8"?>
+<bpmn:definitions xmlns:bpmn="http://www.omg.org/spec/BPMN/20100524/MODEL"
+    xmlns:pm="https://github.com/AkronimBlack/process-manager/bpmn" id="definitions">
+  <bpmn:process id="fulfillment" isExecutable="true">
+    <bpmn:startEvent id="start" />
+    <bpmn:serviceTask id="reserve" pm:type="reserve_stock" />
+    <bpmn:callActivity id="bill" calledElement="billing">
+      <bpmn:extensionElements>
+        <pm:args>{"input": {"order_id": "{{input_data.order_id}}"}}</pm:args>
+      </bpmn:extensionElements>
+    </bpmn:callActivity>
+    <bpmn:boundaryEvent id="bill_failed" attachedToRef="bill">
+      <bpmn:errorEventDefinition />
+    </bpmn:boundaryEvent>
+    <bpmn:endEvent id="done" />
+    <bpmn:endEvent id="cancelled" />
+    <bpmn:sequenceFlow id="f1" sourceRef="start" targetRef="reserve" />
+    <bpmn:sequenceFlow id="f2" sourceRef="reserve" targetRef="bill" />
+    <bpmn:sequenceFlow id="f3" sourceRef="bill" targetRef="done" />
+    <bpmn:sequenceFlow id="f4" sourceRef="bill_failed" targetRef="cancelled" />
+  </bpmn:process>
+</bpmn:definitions>`
+
+func TestImportBpmn_CallActivities(t *testing.T) {
+	actions, err := ImportBpmn(strings.NewReader(fulfillmentBpmn))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := Actions{
+		StartNode: {ActionType: StartNode, Args: Args{}, OnSuccess: "reserve"},
+		"reserve": {ActionType: "reserve_stock", Args: Args{}, OnSuccess: "bill", OnFailure: bpmnUnhandledError},
+		"bill": {
+			ActionType: CallActivityAction,
+			Args:       Args{"process": "billing", "input": map[string]interface{}{"order_id": "{{input_data.order_id}}"}},
+			OnSuccess:  "done",
+			OnFailure:  "cancelled",
+		},
+	}
+	expected.setIds()
+	if !reflect.DeepEqual(expected, actions) {
+		t.Errorf("expected %+v, got %+v", expected, actions)
+	}
+	if validationErrors := NewParser().validate(actions); !validationErrors.IsValid() {
+		t.Errorf("expected imported actions to be valid, got %v", validationErrors)
+	}
+
+	buffer := bytes.Buffer{}
+	if err = ExportBpmn(&buffer, "fulfillment", actions); err != nil {
+		t.Fatal(err)
+	}
+	if expected := `<bpmn:callActivity id="bill" name="bill" calledElement="billing">`; !strings.Contains(buffer.String(), expected) {
+		t.Errorf("missing %s in\n%s", expected, buffer.String())
+	}
+	imported, err := ImportBpmn(&buffer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(actions, imported) {
+		t.Errorf("expected %+v after round trip, got %+v", actions, imported)
+	}
+}
+
+func TestImportBpmn_ReportsParallelGateways(t *testing.T) {
+	definition := `<definitions xmlns="http://www.omg.org/spec/BPMN/20100524/MODEL">
+  <process id="orders">
+    <startEvent id="start" />
+    <parallelGateway id="fork" />
+    <serviceTask id="a" />
+    <serviceTask id="b" />
+    <parallelGateway id="join" />
+    <sequenceFlow id="f1" sourceRef="start" targetRef="fork" />
+    <sequenceFlow id="f2" sourceRef="fork" targetRef="a" />
+    <sequenceFlow id="f3" sourceRef="fork" targetRef="b" />
+    <sequenceFlow id="f4" sourceRef="a" targetRef="join" />
+    <sequenceFlow id="f5" sourceRef="b" targetRef="join" />
+    <sequenceFlow id="f6" sourceRef="join" targetRef="end" />
+  </process>
+</definitions>`
+	_, err := ImportBpmn(strings.NewReader(definition))
+	var unsupported UnsupportedElementsError
+	if !errors.As(err, &unsupported) {
+		t.Fatalf("expected unsupported elements, got %v", err)
+	}
+	reported := map[string]string{}
+	for _, element := range unsupported {
+		reported[element.ID] = element.Element
+	}
+	if reported["fork"] != "parallelGateway" || reported["join"] != "parallelGateway" {
+		t.Errorf("expected the parallel gateways reported, got %s", err)
+	}
+}
+
+func TestExportBpmn_ParallelAsServiceTasks(t *testing.T) {
+	actions := Actions{
+		StartNode: {ActionType: StartNode, Args: Args{}, OnSuccess: "fork"},
+		"fork":    {ActionType: ParallelAction, Args: Args{branchesKey: []interface{}{"a", "b"}}, OnSuccess: "join", OnFailure: bpmnUnhandledError},
+		"a":       {ActionType: "reserve", Args: Args{}, OnSuccess: "join", OnFailure: bpmnUnhandledError},
+		"b":       {ActionType: "bill", Args: Args{}, OnSuccess: "join", OnFailure: bpmnUnhandledError},
+		"join":    {ActionType: JoinAction, Args: Args{}, OnSuccess: "done", OnFailure: bpmnUnhandledError},
+	}
+	actions.setIds()
+	buffer := bytes.Buffer{}
+	if err := ExportBpmn(&buffer, "orders", actions); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(buffer.String(), "parallelGateway") {
+		t.Errorf("expected no parallel gateways exported, got\n%s", buffer.String())
+	}
+	imported, err := ImportBpmn(&buffer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(actions, imported) {
+		t.Errorf("expected %+v after round trip, got %+v", actions, imported)
+	}
+}
+
+func TestExportBpmn_RoundTrip(t *testing.T) {
+	actions, err := ImportBpmn(strings.NewReader(approvalBpmn))
+	if err != nil {
+		t.Fatal(err)
+	}
+	buffer := bytes.Buffer{}
+	err = ExportBpmn(&buffer, "approval", actions)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, expected := range []string{
+		`<bpmn:serviceTask id="fetch_score" name="fetch_score" pm:type="http">`,
+		`<bpmn:boundaryEvent id="fetch_score_error" attachedToRef="fetch_score">`,
+		`<bpmn:timeDuration xsi:type="bpmn:tFormalExpression">PT1H30M</bpmn:timeDuration>`,
+		`<bpmndi:BPMNShape id="approve_di" bpmnElement="approve">`,
+		`<bpmndi:BPMNEdge id="check_amount_on_success_di" bpmnElement="check_amount_on_success">`,
+	} {
+		if !strings.Contains(buffer.String(), expected) {
+			t.Errorf("missing %s in\n%s", expected, buffer.String())
+		}
+	}
+
+	imported, err := ImportBpmn(&buffer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(actions, imported) {
+		t.Errorf("expected %+v after round trip, got %+v", actions, imported)
+	}
+}
+
+func TestIsoDuration(t *testing.T) {
+	for iso, expected := range map[string]string{"PT1H30M": "1h30m0s", "P1DT2S": "24h0m2s", "PT0.5S": "500ms", "{{input_data.wait}}": "{{input_data.wait}}"} {
+		duration, err := fromIsoDuration(iso)
+		if err != nil || duration != expected {
+			t.Errorf("expected %s for %s, got %s %v", expected, iso, duration, err)
+		}
+	}
+	if _, err := fromIsoDuration("P1M"); err == nil {
+		t.Error("expected months to be rejected")
+	}
+	if iso := toIsoDuration("1h30m0.5s"); iso != "PT1H30M0.5S" {
+		t.Errorf("expected PT1H30M0.5S, got %s", iso)
+	}
+}
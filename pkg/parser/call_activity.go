@@ -0,0 +1,144 @@
+package parser
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+)
+
+// CallActivityAction starts a session of a called process and waits until it finished, see AddCalledProcess.
+const CallActivityAction = "call_activity"
+
+var ErrUnknownCalledProcess = errors.New("called process is not registered")
+
+type CallActivityArgs struct {
+	ResultArgs
+	Process string `json:"process"`
+	// Input is the input data of the called session, string values are templates.
+	Input map[string]interface{} `json:"input"`
+}
+
+type callerKey struct{}
+
+// AddCalledProcess registers a parser call_activity actions start sessions of by its key. The called sessions run
+// on that parser, their tasks are completed through it.
+func (p *Parser) AddCalledProcess(called *Parser) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if p.calledProcesses == nil {
+		p.calledProcesses = map[string]*Parser{}
+	}
+	p.calledProcesses[called.Key()] = called
+}
+
+func (p *Parser) CalledProcesses() map[string]*Parser {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	return p.calledProcesses
+}
+
+// CallActivityHandler starts a session of the called process and parks the session until it finished. The uuid,
+// status and values of the called session are stored in the result, the process continues at on_success when it
+// completed and at on_failure when it failed or could not be started.
+func (p *Parser) CallActivityHandler(ctx context.Context, action *Action, session Session) string {
+	callArgs := CallActivityArgs{}
+	err := action.Args.Bind(&callArgs)
+	var called *Parser
+	if err == nil {
+		called = p.CalledProcesses()[callArgs.Process]
+		if called == nil {
+			err = fmt.Errorf("%w: %s", ErrUnknownCalledProcess, callArgs.Process)
+		}
+	}
+	if err != nil {
+		AddActionError(session, callArgs.ResultVariableAsError(action.ActionType), err)
+		session.AddExecutedAction(callActivityExecutedAction(*action, callArgs.Process, ""))
+		return action.OnFailure
+	}
+	input := map[string]interface{}{}
+	for key, value := range callArgs.Input {
+		if template, ok := value.(string); ok {
+			value = RenderTemplate(session, template)
+		}
+		input[key] = value
+	}
+	session.SetStatus(StatusWaiting)
+	callCtx := context.WithValue(ctx, callerKey{}, p.returnFromCall(action, callArgs, session))
+	calledSession, err := called.Enqueue(callCtx, input, nil)
+	if err != nil {
+		session.SetStatus(StatusRunning)
+		AddActionError(session, callArgs.ResultVariableAsError(action.ActionType), err)
+		session.AddExecutedAction(callActivityExecutedAction(*action, callArgs.Process, ""))
+		return action.OnFailure
+	}
+	LoggerFromContext(ctx).Info("called process started",
+		slog.String("process", callArgs.Process),
+		slog.String("called_session_uuid", calledSession.Uuid()),
+	)
+	session.AddExecutedAction(callActivityExecutedAction(*action, callArgs.Process, calledSession.Uuid()))
+	return ""
+}
+
+// returnFromCall stores the result of a called session and wakes the session waiting for it at the action.
+func (p *Parser) returnFromCall(action *Action, callArgs CallActivityArgs, session Session) func(Session) {
+	resultVariable := callArgs.ResultVariable(action.ActionType)
+	from, onSuccess, onFailure := action.ID, action.OnSuccess, action.OnFailure
+	return func(calledSession Session) {
+		session.Set(resultVariable, map[string]interface{}{
+			"session_uuid": calledSession.Uuid(),
+			"status":       calledSession.Status(),
+			"values":       calledSession.Values(),
+		})
+		next := onSuccess
+		if calledSession.Status() != StatusCompleted {
+			next = onFailure
+		}
+		p.wakeQueued(session, from, next, runInline)
+	}
+}
+
+// restoreCalledSession restores the checkpoint of the session a restored session waits for at the call_activity
+// action, the called session returns to it once it finished. False when the called session has no checkpoint.
+func (p *Parser) restoreCalledSession(ctx context.Context, action *Action, session Session) bool {
+	callArgs := CallActivityArgs{}
+	if action.Args.Bind(&callArgs) != nil {
+		return false
+	}
+	called := p.CalledProcesses()[callArgs.Process]
+	calledUuid := ""
+	for _, executed := range session.ExecutedActions() {
+		if executed.ID() == action.ID {
+			calledUuid, _ = executed.Parameters()["called_session_uuid"].(string)
+		}
+	}
+	if called == nil || called.SessionStore() == nil || calledUuid == "" {
+		return false
+	}
+	callCtx := context.WithValue(ctx, callerKey{}, p.returnFromCall(action, callArgs, session))
+	restored, err := called.restoreCheckpoint(callCtx, called.SessionStore(), calledUuid)
+	if err != nil {
+		p.sessionLogger(session).Warn("called session not restored",
+			slog.String("called_session_uuid", calledUuid),
+			slog.String("error", err.Error()),
+		)
+	}
+	return restored
+}
+
+// returnToCaller wakes the session that called the finished session, if any.
+func returnToCaller(ctx context.Context, session Session) {
+	if caller, ok := ctx.Value(callerKey{}).(func(Session)); ok {
+		caller(session)
+	}
+}
+
+func callActivityExecutedAction(action Action, process, calledSession string) *executedAction {
+	return &executedAction{
+		Action: action,
+		Params: map[string]interface{}{
+			"process":             process,
+			"called_session_uuid": calledSession,
+		},
+	}
+}
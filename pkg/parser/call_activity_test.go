@@ -0,0 +1,103 @@
+package parser
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func billingParser(actions Actions) *Parser {
+	billing := NewParser()
+	billing.SetKey("billing")
+	billing.SetActions(actions)
+	return billing
+}
+
+func callingParser(process string, called *Parser) *Parser {
+	parser := NewParser()
+	parser.AddCalledProcess(called)
+	parser.AddHandler("outcome", func(ctx context.Context, action *Action, session Session) string {
+		session.Set("outcome", action.ID)
+		return action.OnSuccess
+	})
+	parser.SetActions(Actions{
+		StartNode: {ActionType: StartNode, OnSuccess: "bill"},
+		"bill": {
+			ActionType: CallActivityAction,
+			Args:       Args{"process": process, "input": map[string]interface{}{"order": "order-{{input_data.id}}"}},
+			OnSuccess:  "billed",
+			OnFailure:  "unbilled",
+		},
+		"billed":   {ActionType: "outcome", OnSuccess: "end", OnFailure: "end"},
+		"unbilled": {ActionType: "outcome", OnSuccess: "end", OnFailure: "end"},
+	})
+	return parser
+}
+
+func waitStatus(t *testing.T, session Session, status string) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for session.Status() != status {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected session %s, got %s", status, session.Status())
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestParser_CallActivityWaitsForCalledSession(t *testing.T) {
+	billing := billingParser(Actions{
+		StartNode: {ActionType: StartNode, OnSuccess: "approve"},
+		"approve": {ActionType: TaskAction, Args: Args{"id": "approve", "name": "approve", "wait": true}, OnSuccess: "end", OnFailure: "end"},
+	})
+	parser := callingParser("billing", billing)
+	session := parser.Run(context.Background(), map[string]interface{}{"id": 7}, nil)
+	if session.Status() != StatusWaiting {
+		t.Fatalf("expected the session waiting for the called session, got %s", session.Status())
+	}
+	var called Session
+	for deadline := time.Now().Add(time.Second); len(billing.Sessions()) == 0 && time.Now().Before(deadline); {
+		time.Sleep(time.Millisecond)
+	}
+	if len(billing.Sessions()) != 1 {
+		t.Fatalf("expected a billing session, got %d", len(billing.Sessions()))
+	}
+	called = billing.Sessions()[0]
+	waitStatus(t, called, StatusWaiting)
+	if called.InputData()["order"] != "order-7" {
+		t.Errorf("expected the rendered input, got %v", called.InputData())
+	}
+
+	if err := billing.RunTask(context.Background(), called.Task("approve"), map[string]interface{}{}); err != nil {
+		t.Fatal(err)
+	}
+	waitStatus(t, session, StatusCompleted)
+	result, _ := session.Values()["call_activity.result"].(map[string]interface{})
+	if result["session_uuid"] != called.Uuid() || result["status"] != StatusCompleted {
+		t.Errorf("expected the called session in the result, got %v", result)
+	}
+	if session.Values()["outcome"] != "billed" {
+		t.Errorf("expected the session to continue at on_success, got %v", session.Values()["outcome"])
+	}
+}
+
+func TestParser_CallActivityFailures(t *testing.T) {
+	billing := billingParser(Actions{
+		StartNode: {ActionType: StartNode, OnSuccess: "charge"},
+		"charge":  {ActionType: "unregistered", OnSuccess: "end", OnFailure: "end"},
+	})
+	session := callingParser("billing", billing).Run(context.Background(), map[string]interface{}{}, nil)
+	waitStatus(t, session, StatusCompleted)
+	if session.Values()["outcome"] != "unbilled" {
+		t.Errorf("expected a failed called session to continue at on_failure, got %v", session.Values()["outcome"])
+	}
+
+	session = callingParser("invoicing", billing).Run(context.Background(), map[string]interface{}{}, nil)
+	if session.Status() != StatusCompleted || session.Values()["outcome"] != "unbilled" {
+		t.Errorf("expected an unknown process to continue at on_failure, got %s %v", session.Status(), session.Values()["outcome"])
+	}
+	if message, _ := session.Values()["call_activity.result_error"].(string); !strings.Contains(message, ErrUnknownCalledProcess.Error()) {
+		t.Errorf("expected the error stored, got %v", session.Values())
+	}
+}
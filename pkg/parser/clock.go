@@ -0,0 +1,75 @@
+package parser
+
+import (
+	"context"
+	"time"
+)
+
+// Clock is the time source of the parser. Tests replace it to control timers.
+type Clock interface {
+	Now() time.Time
+	// AfterFunc calls f in its own goroutine once d elapsed.
+	AfterFunc(d time.Duration, f func()) Timer
+}
+
+type Timer interface {
+	// Stop prevents the timer from firing, returns false if it already fired or was stopped.
+	Stop() bool
+}
+
+type clockKey struct{}
+
+// ContextWithClock stores the parser clock so handlers can read the time.
+func ContextWithClock(ctx context.Context, clock Clock) context.Context {
+	return context.WithValue(ctx, clockKey{}, clock)
+}
+
+// ClockFromContext returns the stored clock or the real clock.
+func ClockFromContext(ctx context.Context) Clock {
+	clock, ok := ctx.Value(clockKey{}).(Clock)
+	if !ok || clock == nil {
+		return realClock{}
+	}
+	return clock
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+func (realClock) AfterFunc(d time.Duration, f func()) Timer {
+	return time.AfterFunc(d, f)
+}
+
+// immediateClock fires every timer right away on the calling goroutine.
+type immediateClock struct{}
+
+func (immediateClock) Now() time.Time {
+	return time.Now()
+}
+
+func (immediateClock) AfterFunc(_ time.Duration, f func()) Timer {
+	f()
+	return firedTimer{}
+}
+
+type firedTimer struct{}
+
+func (firedTimer) Stop() bool {
+	return false
+}
+
+func (p *Parser) SetClock(clock Clock) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.clock = clock
+}
+
+func (p *Parser) Clock() Clock {
+	if p.clock == nil {
+		return realClock{}
+	}
+	return p.clock
+}
@@ -0,0 +1,108 @@
+package parser
+
+import (
+	"context"
+	"log/slog"
+)
+
+// waitingActionTypes are the built-in action types that park the session, they can not compensate an action. Tasks
+// only park the session with wait, see Action.waits.
+var waitingActionTypes = map[string]bool{
+	TaskAction:           true,
+	TimerAction:          true,
+	ReceiveMessageAction: true,
+	WaitSignalAction:     true,
+	CallActivityAction:   true,
+}
+
+// waits reports if the action parks the session.
+func (a *Action) waits() bool {
+	if a.ActionType == TaskAction {
+		taskArgs := TaskArgs{}
+		_ = a.Args.Bind(&taskArgs)
+		return taskArgs.Wait
+	}
+	return waitingActionTypes[a.ActionType]
+}
+
+// CompensateHandler runs the compensate_with action of every successfully executed action since the previous
+// compensate action, newest first. Compensating actions run once, their transitions are not followed. The list
+// of compensated and failed action ids is stored in the result, the process continues at on_failure when a
+// compensation failed.
+func (p *Parser) CompensateHandler(ctx context.Context, action *Action, session Session) string {
+	resultArgs := ResultArgs{}
+	_ = action.Args.Bind(&resultArgs)
+	executedActions := session.ExecutedActions()
+	compensated, failed := make([]string, 0), make([]string, 0)
+	for i := len(executedActions) - 1; i >= 0; i-- {
+		executed := executedActions[i]
+		if executed.Type() == CompensateAction {
+			break
+		}
+		if executed.Failed() {
+			continue
+		}
+		definition := p.actions[executed.ID()]
+		if definition == nil || definition.CompensateWith == "" {
+			continue
+		}
+		if p.compensate(ctx, session, definition.CompensateWith) {
+			compensated = append(compensated, executed.ID())
+			continue
+		}
+		failed = append(failed, executed.ID())
+	}
+	compensation := map[string]interface{}{
+		"compensated": compensated,
+		"failed":      failed,
+	}
+	session.Set(resultArgs.ResultVariable(action.ActionType), compensation)
+	session.AddExecutedAction(NewExecutedAction(*action, compensation))
+	if len(failed) != 0 {
+		return action.OnFailure
+	}
+	return action.OnSuccess
+}
+
+// compensate runs the handler of a compensating action and reports if it succeeded. A compensation that waits
+// counts as failed, the tasks it created are cancelled and its message and signal subscriptions dropped.
+func (p *Parser) compensate(ctx context.Context, session Session, actionId string) bool {
+	logger := LoggerFromContext(ctx).With(slog.String("compensate_with", actionId))
+	compensation := p.actions[actionId]
+	if compensation == nil {
+		logger.Error("compensating action is not defined")
+		return false
+	}
+	handler := p.ActionHandler(compensation.ActionType)
+	if handler == nil {
+		logger.Error("no handler registered for compensating action type")
+		return false
+	}
+	executed, created := len(session.ExecutedActions()), len(session.Tasks())
+	next, err := callHandler(ctx, handler, compensation, session)
+	succeeded := false
+	switch {
+	case session.Status() == StatusWaiting:
+		logger.Error("compensating action waited")
+		for _, pendingTask := range session.Tasks()[created:] {
+			pendingTask.Cancel()
+		}
+		p.lock.Lock()
+		p.unsubscribe(session)
+		delete(p.pendingWakes, session.Uuid())
+		p.lock.Unlock()
+		session.SetStatus(StatusRunning)
+	case err != nil:
+		logger.Error("compensating action raised an error", slog.String("error", err.Error()))
+		p.addError(session, actionId, compensation.ActionType, err)
+	case next == compensation.OnFailure && next != compensation.OnSuccess:
+		logger.Warn("compensating action failed")
+	default:
+		logger.Info("action compensated")
+		succeeded = true
+	}
+	if !succeeded {
+		markFailed(session.ExecutedActions()[executed:])
+	}
+	return succeeded
+}
@@ -0,0 +1,166 @@
+package parser
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func bookingActions() Actions {
+	return Actions{
+		StartNode: {ActionType: StartNode, OnSuccess: "book_hotel"},
+		"book_hotel": {
+			ActionType:     "book",
+			Args:           Args{"outcome": "success"},
+			OnSuccess:      "book_flight",
+			OnFailure:      "end",
+			CompensateWith: "cancel_hotel",
+		},
+		"book_flight": {
+			ActionType:     "book",
+			Args:           Args{"outcome": "{{input_data.flight}}"},
+			OnSuccess:      "book_car",
+			OnFailure:      "undo",
+			CompensateWith: "cancel_flight",
+		},
+		"book_car": {
+			ActionType:     "book",
+			Args:           Args{"outcome": "failure"},
+			OnSuccess:      "end",
+			OnFailure:      "undo",
+			CompensateWith: "cancel_car",
+		},
+		"undo":          {ActionType: CompensateAction, Args: Args{result: "undone"}, OnSuccess: "cancelled", OnFailure: "stuck"},
+		"cancel_hotel":  {ActionType: "book", Args: Args{"outcome": "success"}, OnSuccess: "end", OnFailure: "stuck"},
+		"cancel_flight": {ActionType: "book", Args: Args{"outcome": "failure"}, OnSuccess: "end", OnFailure: "stuck"},
+		"cancel_car":    {ActionType: "book", Args: Args{"outcome": "success"}, OnSuccess: "end", OnFailure: "stuck"},
+	}
+}
+
+func bookHandler(ctx context.Context, action *Action, session Session) string {
+	outcome := session.PlaceholderOrStringValue(action.Args.GetString("outcome"))
+	session.AddExecutedAction(NewExecutedAction(*action, map[string]interface{}{"outcome": outcome}))
+	switch outcome {
+	case "panic":
+		panic("booking service unavailable")
+	case "unknown":
+		return "missing"
+	case "failure":
+		return action.OnFailure
+	}
+	return action.OnSuccess
+}
+
+func TestParser_CompensateUndoesCompletedActions(t *testing.T) {
+	parser := NewParser()
+	parser.AddHandler("book", bookHandler)
+	parser.SetActions(bookingActions())
+
+	session := parser.Run(context.Background(), map[string]interface{}{"flight": "success"}, nil)
+	if session.Status() != StatusCompleted {
+		t.Fatalf("expected session completed, got %s", session.Status())
+	}
+	visited := make([]string, 0)
+	for _, executed := range session.ExecutedActions() {
+		visited = append(visited, executed.ID())
+	}
+	expected := []string{"book_hotel", "book_flight", "book_car", "cancel_flight", "cancel_hotel", "undo"}
+	if len(visited) != len(expected) {
+		t.Fatalf("expected %v, got %v", expected, visited)
+	}
+	for i := range expected {
+		if visited[i] != expected[i] {
+			t.Fatalf("expected %v, got %v", expected, visited)
+		}
+	}
+	if !session.ExecutedActions()[2].Failed() || !session.ExecutedActions()[3].Failed() {
+		t.Error("expected the failed booking and the failed compensation marked failed")
+	}
+	undone := session.Values()["undone"].(map[string]interface{})
+	if failed := undone["failed"].([]string); len(failed) != 1 || failed[0] != "book_flight" {
+		t.Errorf("expected the book_flight compensation failed, got %v", undone)
+	}
+	if compensated := undone["compensated"].([]string); len(compensated) != 1 || compensated[0] != "book_hotel" {
+		t.Errorf("expected book_hotel compensated, got %v", undone)
+	}
+}
+
+func TestParser_RaiseErrorContinuesAtOnError(t *testing.T) {
+	for _, outcome := range []string{"panic", "unknown"} {
+		actions := bookingActions()
+		actions[StartNode].OnError = "undo"
+		parser := NewParser()
+		parser.AddHandler("book", bookHandler)
+		parser.SetActions(actions)
+
+		session := parser.Run(context.Background(), map[string]interface{}{"flight": outcome}, nil)
+		if session.Status() != StatusCompleted {
+			t.Fatalf("%s: expected session completed, got %s", outcome, session.Status())
+		}
+		if session.StringValueOf("values.error.action_id", "") != "book_flight" {
+			t.Errorf("%s: expected the error of book_flight stored, got %v", outcome, session.ValueOf("values.error"))
+		}
+		undone := session.Values()["undone"].(map[string]interface{})
+		if compensated := undone["compensated"].([]string); len(compensated) != 1 || compensated[0] != "book_hotel" {
+			t.Errorf("%s: expected book_hotel compensated, got %v", outcome, undone)
+		}
+	}
+}
+
+func TestParser_RaiseErrorFailsSessionWithoutOnError(t *testing.T) {
+	parser := NewParser()
+	parser.AddHandler("book", bookHandler)
+	parser.SetActions(bookingActions())
+
+	session := parser.Run(context.Background(), map[string]interface{}{"flight": "panic"}, nil)
+	if session.Status() != StatusFailed {
+		t.Fatalf("expected session failed, got %s", session.Status())
+	}
+	if session.StringValueOf("values.error.error", "") != "handler panicked: booking service unavailable" {
+		t.Errorf("expected the panic stored, got %v", session.ValueOf("values.error"))
+	}
+}
+
+func TestParser_ValidateCompensationReferences(t *testing.T) {
+	actions := bookingActions()
+	actions["book_car"].CompensateWith = "cancel_boat"
+	actions[StartNode].OnError = "rescue"
+	errors := NewParser().validate(actions)
+	if len(errors["book_car"]["compensate_with"]) != 1 || len(errors[StartNode]["on_error"]) != 1 {
+		t.Errorf("expected undefined compensate_with and on_error reported, got %v", errors)
+	}
+
+	actions = bookingActions()
+	actions["cancel_hotel"] = &Action{ActionType: TaskAction, Args: Args{"name": "call the hotel", "wait": true}, OnSuccess: "end", OnFailure: "stuck"}
+	if errors = NewParser().validate(actions); len(errors["book_hotel"]["compensate_with"]) != 1 {
+		t.Errorf("expected a waiting compensate_with reported, got %v", errors)
+	}
+	delete(actions["cancel_hotel"].Args, "wait")
+	if errors = NewParser().validate(actions); len(errors["book_hotel"]) != 0 {
+		t.Errorf("expected a task without wait to compensate, got %v", errors)
+	}
+}
+
+func TestParser_CompensationThatWaitsIsCleanedUp(t *testing.T) {
+	parser := NewParser()
+	parser.AddHandler("book", bookHandler)
+	parser.AddHandler("ask_hotel", func(ctx context.Context, action *Action, session Session) string {
+		TaskHandler(ctx, action, session)
+		return parser.ReceiveMessageHandler(ctx, action, session)
+	})
+	actions := bookingActions()
+	actions["cancel_hotel"] = &Action{ActionType: "ask_hotel", Args: Args{"id": "cancel", "name": "cancelled"}, OnSuccess: "end", OnFailure: "stuck"}
+	parser.SetActions(actions)
+
+	session := parser.Run(context.Background(), map[string]interface{}{"flight": "success"}, nil)
+	if session.Status() != StatusCompleted || session.CurrentAction() != "undo" {
+		t.Fatalf("expected the session to continue past the compensation, got %s at %s", session.Status(), session.CurrentAction())
+	}
+	if session.Task("cancel").Status() != TaskStatusCancelled {
+		t.Errorf("expected the compensation task cancelled, got %s", session.Task("cancel").Status())
+	}
+	_, err := parser.RunMessage(context.Background(), Message{Name: "cancelled"}, nil)
+	if !errors.Is(err, ErrMessageNotCorrelated) {
+		t.Errorf("expected the compensation subscription dropped, got %v", err)
+	}
+}
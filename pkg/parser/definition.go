@@ -0,0 +1,117 @@
+package parser
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/AkronimBlack/process-manager/shared"
+	"gopkg.in/yaml.v3"
+	"path"
+	"strings"
+)
+
+const (
+	DefinitionFormatJson = "json"
+	DefinitionFormatYaml = "yaml"
+
+	// yamlExtensionPrefix marks top level keys that hold shared fragments and are not actions.
+	yamlExtensionPrefix = "x-"
+)
+
+// DefinitionFormat detects the format of a definition file by its extension. Files without an extension return
+// an empty format, their content decides.
+func DefinitionFormat(location string) (string, error) {
+	switch strings.ToLower(path.Ext(location)) {
+	case ".json":
+		return DefinitionFormatJson, nil
+	case ".yaml", ".yml":
+		return DefinitionFormatYaml, nil
+	case "":
+		return "", nil
+	}
+	return "", fmt.Errorf("%s is not a json or yaml file", location)
+}
+
+// ParseDefinition reads actions in the given format, an empty format is detected from the content.
+// Yaml definitions may use comments, anchors, aliases and merge keys. Top level keys starting with x- are not
+// actions and can hold shared fragments.
+func ParseDefinition(data []byte, format string) (Actions, error) {
+	if format == "" {
+		format = DefinitionFormatYaml
+		if trimmed := bytes.TrimSpace(data); len(trimmed) != 0 && trimmed[0] == '{' {
+			format = DefinitionFormatJson
+		}
+	}
+	var actions Actions
+	switch format {
+	case DefinitionFormatJson:
+		definition := map[string]json.RawMessage{}
+		err := json.Unmarshal(data, &definition)
+		if err != nil {
+			return nil, err
+		}
+		actions = Actions{}
+		for key, raw := range definition {
+			if strings.HasPrefix(key, yamlExtensionPrefix) {
+				continue
+			}
+			action := &Action{}
+			err = json.Unmarshal(raw, action)
+			if err != nil {
+				return nil, fmt.Errorf("action %s: %w", key, err)
+			}
+			actions[key] = action
+		}
+	case DefinitionFormatYaml:
+		definition := map[string]interface{}{}
+		err := yaml.Unmarshal(data, &definition)
+		if err != nil {
+			return nil, err
+		}
+		for key := range definition {
+			if strings.HasPrefix(key, yamlExtensionPrefix) {
+				delete(definition, key)
+			}
+		}
+		// yaml is mapped through json so args hold the same types for both formats
+		data, err = json.Marshal(definition)
+		if err != nil {
+			return nil, fmt.Errorf("converting yaml definition: %w", err)
+		}
+		err = json.Unmarshal(data, &actions)
+		if err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unknown definition format %s", format)
+	}
+	actions.setIds()
+	return actions, nil
+}
+
+// MarshalDefinition writes actions in the given format.
+func MarshalDefinition(actions Actions, format string) ([]byte, error) {
+	switch format {
+	case DefinitionFormatJson:
+		data, err := json.MarshalIndent(actions, "", "    ")
+		if err != nil {
+			return nil, err
+		}
+		return append(data, '\n'), nil
+	case DefinitionFormatYaml:
+		var definition map[string]interface{}
+		err := json.Unmarshal(shared.ToJsonByte(actions), &definition)
+		if err != nil {
+			return nil, err
+		}
+		buffer := bytes.Buffer{}
+		encoder := yaml.NewEncoder(&buffer)
+		encoder.SetIndent(2)
+		err = encoder.Encode(definition)
+		if err != nil {
+			return nil, err
+		}
+		return buffer.Bytes(), encoder.Close()
+	}
+	return nil, fmt.Errorf("unknown definition format %s", format)
+}
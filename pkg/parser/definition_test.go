@@ -0,0 +1,65 @@
+package parser
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParser_LoadFileYaml(t *testing.T) {
+	jsonParser := Parser{}
+	err := jsonParser.LoadFile("test.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	yamlParser := Parser{}
+	err = yamlParser.LoadFile("test.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(jsonParser.Actions(), yamlParser.Actions()) {
+		t.Errorf("expected yaml definition to match json, got %+v", yamlParser.Actions())
+	}
+	if yamlParser.Key() != "test" {
+		t.Errorf("expected key test, got %s", yamlParser.Key())
+	}
+}
+
+func TestParseDefinition_DetectsFormat(t *testing.T) {
+	for name, definition := range map[string]string{
+		DefinitionFormatJson: `{"start_node": {"type": "start_node", "args": {"retries": 3}, "on_success": "end"}}`,
+		DefinitionFormatYaml: "start_node:\n  type: start_node\n  args:\n    retries: 3\n  on_success: end\n",
+	} {
+		actions, err := ParseDefinition([]byte(definition), "")
+		if err != nil {
+			t.Fatalf("%s: %s", name, err)
+		}
+		start := actions[StartNode]
+		if start == nil || start.ID != StartNode || start.OnSuccess != "end" || start.Args["retries"] != float64(3) {
+			t.Errorf("%s: unexpected start node %+v", name, start)
+		}
+	}
+}
+
+func TestMarshalDefinition_RoundTrip(t *testing.T) {
+	parser := Parser{}
+	err := parser.LoadFile("test.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, format := range []string{DefinitionFormatJson, DefinitionFormatYaml} {
+		data, err := MarshalDefinition(parser.Actions(), format)
+		if err != nil {
+			t.Fatal(err)
+		}
+		actions, err := ParseDefinition(data, format)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(parser.Actions(), actions) {
+			t.Errorf("%s: expected %+v, got %+v", format, parser.Actions(), actions)
+		}
+	}
+	if _, err := DefinitionFormat("test.xml"); err == nil {
+		t.Error("expected xml files to be rejected")
+	}
+}
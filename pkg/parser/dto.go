@@ -1,28 +1,87 @@
 package parser
 
+import (
+	"fmt"
+	"time"
+)
+
 func NewSessionDto(session Session) SessionDto {
 	if session == nil {
 		return SessionDto{}
 	}
 	return SessionDto{
 		Uuid:                    session.Uuid(),
+		ProcessKey:              session.ProcessKey(),
+		Status:                  session.Status(),
+		StartedAt:               session.Started(),
+		FinishedAt:              finishedAt(session),
 		Values:                  session.Values(),
 		ExecutedActions:         NewExecutedActionsDto(session.ExecutedActions()),
 		InputData:               session.InputData(),
 		OnFinishWebhook:         NewOnFinishWebhookDto(session.OnFinishWebhook()),
 		OnFinishWebhookResponse: session.OnFinishWebhookResponse(),
 		Tasks:                   NewTasksDto(session.Tasks()),
+		Errors:                  session.Errors(),
+		Steps:                   session.Steps(),
+		CurrentAction:           session.CurrentAction(),
+		Limits:                  NewLimitsDto(session.Limits()),
 	}
 }
 
 type SessionDto struct {
 	Uuid                    string                 `json:"uuid"`
+	ProcessKey              string                 `json:"process_key"`
+	Status                  string                 `json:"status"`
+	StartedAt               time.Time              `json:"started_at"`
+	FinishedAt              *time.Time             `json:"finished_at,omitempty"`
 	Values                  map[string]interface{} `json:"values"`
 	ExecutedActions         []ExecutedActionDto    `json:"executed_actions"`
 	InputData               map[string]interface{} `json:"input_data"`
 	OnFinishWebhook         *OnFinishWebhook       `json:"on_finish_webhook"`
 	OnFinishWebhookResponse map[string]interface{} `json:"on_finish_webhook_response"`
 	Tasks                   []TaskDto              `json:"tasks"`
+	Errors                  []ActionError          `json:"errors"`
+	Steps                   int                    `json:"steps"`
+	CurrentAction           string                 `json:"current_action"`
+	Limits                  LimitsDto              `json:"limits"`
+}
+
+func finishedAt(session Session) *time.Time {
+	finished := session.Finished()
+	if finished.IsZero() {
+		return nil
+	}
+	return &finished
+}
+
+func NewLimitsDto(limits Limits) LimitsDto {
+	dto := LimitsDto{MaxSteps: limits.MaxSteps}
+	if limits.MaxDuration > 0 {
+		dto.MaxDuration = limits.MaxDuration.String()
+	}
+	return dto
+}
+
+// LimitsDto are the Limits of a session, the max duration is a go duration. Zero values do not limit.
+type LimitsDto struct {
+	MaxSteps    int    `json:"max_steps"`
+	MaxDuration string `json:"max_duration,omitempty"`
+}
+
+func (l LimitsDto) Limits() (Limits, error) {
+	limits := Limits{MaxSteps: l.MaxSteps}
+	if l.MaxSteps < 0 {
+		return limits, fmt.Errorf("max_steps must not be negative")
+	}
+	if l.MaxDuration == "" {
+		return limits, nil
+	}
+	duration, err := time.ParseDuration(l.MaxDuration)
+	if err != nil {
+		return limits, fmt.Errorf("invalid max_duration: %w", err)
+	}
+	limits.MaxDuration = duration
+	return limits, nil
 }
 
 func NewOnFinishWebhookDto(onFinishWebhook Webhook) *OnFinishWebhook {
@@ -48,20 +107,24 @@ func NewExecutedActionsDto(executedActions []ExecutedAction) []ExecutedActionDto
 
 func NewExecutedActionDto(executedAction ExecutedAction) ExecutedActionDto {
 	return ExecutedActionDto{
+		ID:         executedAction.ID(),
 		ActionType: executedAction.Type(),
 		Args:       executedAction.Arguments(),
 		OnSuccess:  executedAction.OnSuccess(),
 		OnFailure:  executedAction.OnFailure(),
 		Params:     executedAction.Parameters(),
+		Failed:     executedAction.Failed(),
 	}
 }
 
 type ExecutedActionDto struct {
+	ID         string `json:"id"`
 	ActionType string `json:"type"`
 	Args       Args   `json:"args"`
 	OnSuccess  string `json:"on_success"`
 	OnFailure  string `json:"on_failure"`
 	Params     map[string]interface{}
+	Failed     bool `json:"failed"`
 }
 
 func NewTasksDto(tasks []Task) []TaskDto {
@@ -73,17 +136,151 @@ func NewTasksDto(tasks []Task) []TaskDto {
 }
 
 func NewTaskDto(task Task) TaskDto {
+	assignment := task.Assignment()
+	var dueAt *time.Time
+	if due := task.Deadline().Due; !due.IsZero() {
+		dueAt = &due
+	}
+	var sessionUuid, processKey string
+	if task.Session() != nil {
+		sessionUuid, processKey = task.Session().Uuid(), task.Session().ProcessKey()
+	}
 	return TaskDto{
-		ID:         task.ID(),
-		Name:       task.Name(),
-		Next:       task.Next(),
-		Parameters: task.Parameters(),
+		ID:              task.ID(),
+		DefinitionKey:   task.DefinitionKey(),
+		ActionId:        task.ActionId(),
+		BusinessKey:     task.BusinessKey(),
+		SessionUuid:     sessionUuid,
+		ProcessKey:      processKey,
+		CreatedAt:       task.Created(),
+		DueAt:           dueAt,
+		Name:            task.Name(),
+		Next:            task.Next(),
+		Parameters:      task.Parameters(),
+		Status:          task.Status(),
+		Assignee:        assignment.Assignee,
+		CandidateUsers:  assignment.CandidateUsers,
+		CandidateGroups: assignment.CandidateGroups,
+		Form:            task.Form(),
+		Completed:       task.Completed(),
 	}
 }
 
 type TaskDto struct {
-	ID         string                 `json:"ID"`
-	Name       string                 `json:"name"`
-	Next       string                 `json:"next"`
-	Parameters map[string]interface{} `json:"parameters"`
+	ID              string                 `json:"ID"`
+	DefinitionKey   string                 `json:"definition_key"`
+	ActionId        string                 `json:"action_id"`
+	BusinessKey     string                 `json:"business_key,omitempty"`
+	SessionUuid     string                 `json:"session_uuid"`
+	ProcessKey      string                 `json:"process_key"`
+	CreatedAt       time.Time              `json:"created_at"`
+	DueAt           *time.Time             `json:"due_at,omitempty"`
+	Name            string                 `json:"name"`
+	Next            string                 `json:"next"`
+	Parameters      map[string]interface{} `json:"parameters"`
+	Status          string                 `json:"status"`
+	Assignee        string                 `json:"assignee,omitempty"`
+	CandidateUsers  []string               `json:"candidate_users,omitempty"`
+	CandidateGroups []string               `json:"candidate_groups,omitempty"`
+	Form            JsonSchema             `json:"form,omitempty"`
+	Completed       bool                   `json:"completed"`
+}
+
+// MessageCorrelationDto lists the uuids of the sessions a message resumed or started.
+type MessageCorrelationDto struct {
+	Resumed []string `json:"resumed"`
+	Started string   `json:"started,omitempty"`
+}
+
+func NewMessageCorrelationDto(correlation MessageCorrelation) MessageCorrelationDto {
+	dto := MessageCorrelationDto{Resumed: sessionUuids(correlation.Resumed)}
+	if correlation.Started != nil {
+		dto.Started = correlation.Started.Uuid()
+	}
+	return dto
+}
+
+// SignalBroadcastDto lists the uuids of the sessions a signal resumed or interrupted.
+type SignalBroadcastDto struct {
+	Resumed     []string `json:"resumed"`
+	Interrupted []string `json:"interrupted"`
+}
+
+func NewSignalBroadcastDto(broadcast SignalBroadcast) SignalBroadcastDto {
+	return SignalBroadcastDto{Resumed: sessionUuids(broadcast.Resumed), Interrupted: sessionUuids(broadcast.Interrupted)}
+}
+
+func sessionUuids(sessions []Session) []string {
+	uuids := make([]string, 0, len(sessions))
+	for _, activeSession := range sessions {
+		uuids = append(uuids, activeSession.Uuid())
+	}
+	return uuids
+}
+
+// TaskPageDto is a page of a task query.
+type TaskPageDto struct {
+	Items  []TaskDto `json:"items"`
+	Total  int       `json:"total"`
+	Offset int       `json:"offset"`
+	Limit  int       `json:"limit"`
+}
+
+// SessionSummaryDto is the summary of a session in session queries.
+type SessionSummaryDto struct {
+	Uuid          string    `json:"uuid"`
+	ProcessKey    string    `json:"process_key"`
+	Status        string    `json:"status"`
+	StartedAt     time.Time `json:"started_at"`
+	CurrentAction string    `json:"current_action"`
+	Steps         int       `json:"steps"`
+	Errors        int       `json:"errors"`
+}
+
+func NewSessionSummaryDto(session Session) SessionSummaryDto {
+	return SessionSummaryDto{
+		Uuid:          session.Uuid(),
+		ProcessKey:    session.ProcessKey(),
+		Status:        session.Status(),
+		StartedAt:     session.Started(),
+		CurrentAction: session.CurrentAction(),
+		Steps:         session.Steps(),
+		Errors:        len(session.Errors()),
+	}
+}
+
+// SessionPageDto is a page of a session query, items are SessionSummaryDto or SessionDto depending on the fields.
+type SessionPageDto struct {
+	Items      interface{} `json:"items"`
+	Total      int         `json:"total"`
+	NextCursor string      `json:"next_cursor,omitempty"`
+	Limit      int         `json:"limit"`
+}
+
+func NewWorkerPoolDto(stats WorkerPoolStats) WorkerPoolDto {
+	queuedByPriority := make(map[string]int, len(priorityNames))
+	for priority, name := range priorityNames {
+		queuedByPriority[name] = stats.QueuedByPriority[priority]
+	}
+	return WorkerPoolDto{
+		Workers:          stats.Workers,
+		QueueSize:        stats.QueueSize,
+		Queued:           stats.Queued,
+		Running:          stats.Running,
+		QueuedByPriority: queuedByPriority,
+		RunningByProcess: stats.RunningByProcess,
+		DefinitionLimits: stats.DefinitionLimits,
+		Rejected:         stats.Rejected,
+	}
+}
+
+type WorkerPoolDto struct {
+	Workers          int            `json:"workers"`
+	QueueSize        int            `json:"queue_size"`
+	Queued           int            `json:"queued"`
+	Running          int            `json:"running"`
+	QueuedByPriority map[string]int `json:"queued_by_priority"`
+	RunningByProcess map[string]int `json:"running_by_process"`
+	DefinitionLimits map[string]int `json:"definition_limits"`
+	Rejected         int            `json:"rejected"`
 }
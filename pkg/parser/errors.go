@@ -0,0 +1,109 @@
+package parser
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime/debug"
+	"time"
+)
+
+// ErrorHandler is a Handler that reports why it failed, see HandlerWithError.
+type ErrorHandler func(ctx context.Context, action *Action, session Session) (string, error)
+
+// ActionError is an error a handler reported, raised or panicked with.
+type ActionError struct {
+	ActionId   string `json:"action_id"`
+	ActionType string `json:"action_type"`
+	Message    string `json:"message"`
+	// Stack is the stack of the goroutine a handler panicked on.
+	Stack string `json:"stack,omitempty"`
+	// Fatal errors end the session or continue it at the on_error action of the start_node.
+	Fatal bool      `json:"fatal"`
+	At    time.Time `json:"at"`
+}
+
+type handlerErrorKey struct{}
+
+type fatalError struct {
+	err error
+}
+
+func (e fatalError) Error() string {
+	return e.err.Error()
+}
+
+func (e fatalError) Unwrap() error {
+	return e.err
+}
+
+type panicError struct {
+	value interface{}
+	stack string
+}
+
+func (e panicError) Error() string {
+	return fmt.Sprintf("handler panicked: %v", e.value)
+}
+
+// Fatal marks an error returned by an ErrorHandler as fatal, the session then continues at the on_error action of
+// the start_node or fails instead of continuing at on_failure.
+func Fatal(err error) error {
+	if err == nil {
+		return nil
+	}
+	return fatalError{err: err}
+}
+
+// IsFatal reports if the error is fatal or a recovered panic.
+func IsFatal(err error) bool {
+	return errors.As(err, &fatalError{}) || errors.As(err, &panicError{})
+}
+
+// HandlerWithError adapts an ErrorHandler to a Handler. The returned error is recorded on the session, the process
+// continues at the returned action or at on_failure when the handler returned none. See Fatal for errors that
+// should end the session.
+func HandlerWithError(handler ErrorHandler) Handler {
+	return func(ctx context.Context, action *Action, session Session) string {
+		next, err := handler(ctx, action, session)
+		if err == nil {
+			return next
+		}
+		if reported, ok := ctx.Value(handlerErrorKey{}).(*error); ok {
+			*reported = err
+		}
+		if next == "" {
+			return action.OnFailure
+		}
+		return next
+	}
+}
+
+// callHandler runs the handler and returns the error it reported, a panic is recovered into a fatal error.
+func callHandler(ctx context.Context, handler Handler, action *Action, session Session) (next string, err error) {
+	reported := new(error)
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			next, err = "", panicError{value: recovered, stack: string(debug.Stack())}
+		}
+	}()
+	next = handler(context.WithValue(ctx, handlerErrorKey{}, reported), action, session)
+	return next, *reported
+}
+
+// addError records the error on the session.
+func (p *Parser) addError(session Session, actionId, actionType string, err error) ActionError {
+	actionError := ActionError{
+		ActionId:   actionId,
+		ActionType: actionType,
+		Message:    err.Error(),
+		Fatal:      IsFatal(err),
+		At:         p.Clock().Now(),
+	}
+	var recovered panicError
+	if errors.As(err, &recovered) {
+		actionError.Stack = recovered.stack
+	}
+	session.AddError(actionError)
+	return actionError
+}
@@ -0,0 +1,99 @@
+package parser
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/AkronimBlack/process-manager/shared"
+)
+
+var errReservation = errors.New("reservation rejected")
+
+func reserveActions() Actions {
+	return Actions{
+		StartNode: {ActionType: StartNode, OnSuccess: "reserve"},
+		"reserve": {ActionType: "reserve", Args: Args{"outcome": "{{input_data.outcome}}"}, OnSuccess: "end", OnFailure: "rejected"},
+	}
+}
+
+func reserveHandler(ctx context.Context, action *Action, session Session) (string, error) {
+	switch session.PlaceholderOrStringValue(action.Args.GetString("outcome")) {
+	case "error":
+		return "", errReservation
+	case "fatal":
+		return "", Fatal(errReservation)
+	case "panic":
+		var reservations map[string]string
+		reservations["room"] = "taken"
+	}
+	return action.OnSuccess, nil
+}
+
+func TestHandlerWithError_ContinuesAtOnFailure(t *testing.T) {
+	parser := NewParser()
+	parser.AddHandler("reserve", HandlerWithError(reserveHandler))
+	parser.SetActions(reserveActions())
+
+	session := parser.Run(context.Background(), map[string]interface{}{"outcome": "error"}, nil)
+	if session.Status() != StatusCompleted {
+		t.Fatalf("expected session completed at on_failure, got %s", session.Status())
+	}
+	sessionErrors := session.Errors()
+	if len(sessionErrors) != 1 || sessionErrors[0].ActionId != "reserve" || sessionErrors[0].Fatal {
+		t.Fatalf("expected a non fatal error of reserve, got %+v", sessionErrors)
+	}
+	if sessionErrors[0].Message != errReservation.Error() {
+		t.Errorf("expected %s, got %s", errReservation, sessionErrors[0].Message)
+	}
+}
+
+func TestHandlerWithError_FatalFailsSession(t *testing.T) {
+	parser := NewParser()
+	parser.AddHandler("reserve", HandlerWithError(reserveHandler))
+	parser.SetActions(reserveActions())
+
+	session := parser.Run(context.Background(), map[string]interface{}{"outcome": "fatal"}, nil)
+	if session.Status() != StatusFailed {
+		t.Fatalf("expected session failed, got %s", session.Status())
+	}
+	if sessionErrors := session.Errors(); len(sessionErrors) != 1 || !sessionErrors[0].Fatal || sessionErrors[0].Stack != "" {
+		t.Errorf("expected a fatal error without stack, got %+v", sessionErrors)
+	}
+}
+
+func TestParser_RecoversHandlerPanic(t *testing.T) {
+	parser := NewParser()
+	parser.AddHandler("reserve", HandlerWithError(reserveHandler))
+	parser.SetActions(reserveActions())
+
+	session := parser.Run(context.Background(), map[string]interface{}{"outcome": "panic"}, nil)
+	if session.Status() != StatusFailed {
+		t.Fatalf("expected session failed, got %s", session.Status())
+	}
+	var dto SessionDto
+	if err := json.Unmarshal([]byte(shared.ToJsonString(NewSessionDto(session))), &dto); err != nil {
+		t.Fatal(err)
+	}
+	if len(dto.Errors) != 1 || dto.Errors[0].ActionId != "reserve" || !dto.Errors[0].Fatal {
+		t.Fatalf("expected the panic of reserve in the session dto, got %+v", dto.Errors)
+	}
+	if !strings.Contains(dto.Errors[0].Stack, "reserveHandler") {
+		t.Errorf("expected the stack of the handler, got %s", dto.Errors[0].Stack)
+	}
+}
+
+func TestParser_UnknownActionTypeFailsSession(t *testing.T) {
+	parser := NewParser()
+	parser.SetActions(reserveActions())
+
+	session := parser.Run(context.Background(), map[string]interface{}{}, nil)
+	if session.Status() != StatusFailed {
+		t.Fatalf("expected session failed, got %s", session.Status())
+	}
+	if sessionErrors := session.Errors(); len(sessionErrors) != 1 || !strings.Contains(sessionErrors[0].Message, ErrNoHandler.Error()) {
+		t.Errorf("expected the missing handler reported, got %+v", sessionErrors)
+	}
+}
@@ -0,0 +1,158 @@
+package parser
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"regexp"
+)
+
+// ValidateForm validates a task payload against the form json schema of the task. The supported keywords are
+// required, additionalProperties and per property type, enum, minimum, maximum, minLength, maxLength and pattern.
+// Errors are keyed by property.
+func ValidateForm(form JsonSchema, payload map[string]interface{}) ValidationErrors {
+	errors := make(ValidationErrors)
+	if len(form) == 0 {
+		return errors
+	}
+	properties := asSchema(form["properties"])
+	for _, name := range stringList(form["required"]) {
+		if _, ok := payload[name]; !ok {
+			errors.Add(name, []string{fmt.Sprintf("%s is a required field", name)})
+		}
+	}
+	for name, value := range payload {
+		property, ok := properties[name]
+		if !ok {
+			if additional, ok := form["additionalProperties"].(bool); ok && !additional {
+				errors.Add(name, []string{fmt.Sprintf("%s is not a field of the form", name)})
+			}
+			continue
+		}
+		if fieldErrors := validateFormField(name, asSchema(property), value); len(fieldErrors) != 0 {
+			errors.Add(name, fieldErrors)
+		}
+	}
+	return errors
+}
+
+func validateFormField(name string, schema map[string]interface{}, value interface{}) []string {
+	errors := make([]string, 0)
+	if expected, ok := schema["type"].(string); ok && !hasJsonType(value, expected) {
+		return append(errors, fmt.Sprintf("%s must be of type %s", name, expected))
+	}
+	if enum, ok := schema["enum"].([]interface{}); ok {
+		found := false
+		for _, allowed := range enum {
+			if formEqual(allowed, value) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			errors = append(errors, fmt.Sprintf("%s must be one of %v", name, enum))
+		}
+	}
+	if number, ok := toFloat(value); ok {
+		if minimum, ok := toFloat(schema["minimum"]); ok && number < minimum {
+			errors = append(errors, fmt.Sprintf("%s must be at least %v", name, minimum))
+		}
+		if maximum, ok := toFloat(schema["maximum"]); ok && number > maximum {
+			errors = append(errors, fmt.Sprintf("%s must be at most %v", name, maximum))
+		}
+	}
+	if text, ok := value.(string); ok {
+		length := float64(len([]rune(text)))
+		if minLength, ok := toFloat(schema["minLength"]); ok && length < minLength {
+			errors = append(errors, fmt.Sprintf("%s must be at least %v characters", name, minLength))
+		}
+		if maxLength, ok := toFloat(schema["maxLength"]); ok && length > maxLength {
+			errors = append(errors, fmt.Sprintf("%s must be at most %v characters", name, maxLength))
+		}
+		if pattern, ok := schema["pattern"].(string); ok {
+			matched, err := regexp.MatchString(pattern, text)
+			if err != nil || !matched {
+				errors = append(errors, fmt.Sprintf("%s must match %s", name, pattern))
+			}
+		}
+	}
+	return errors
+}
+
+func hasJsonType(value interface{}, expected string) bool {
+	switch expected {
+	case "string":
+		_, ok := value.(string)
+		return ok
+	case "boolean":
+		_, ok := value.(bool)
+		return ok
+	case "number":
+		_, ok := toFloat(value)
+		return ok
+	case "integer":
+		number, ok := toFloat(value)
+		return ok && number == math.Trunc(number)
+	case "object":
+		_, ok := value.(map[string]interface{})
+		return ok
+	case "array":
+		_, ok := value.([]interface{})
+		return ok
+	case "null":
+		return value == nil
+	}
+	return true
+}
+
+func toFloat(value interface{}) (float64, bool) {
+	switch number := value.(type) {
+	case float64:
+		return number, true
+	case float32:
+		return float64(number), true
+	case int:
+		return float64(number), true
+	case int64:
+		return float64(number), true
+	case int32:
+		return float64(number), true
+	}
+	return 0, false
+}
+
+func formEqual(a, b interface{}) bool {
+	if numberA, ok := toFloat(a); ok {
+		numberB, ok := toFloat(b)
+		return ok && numberA == numberB
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+// asSchema reads a schema from a decoded json object or a JsonSchema.
+func asSchema(value interface{}) map[string]interface{} {
+	switch schema := value.(type) {
+	case JsonSchema:
+		return schema
+	case map[string]interface{}:
+		return schema
+	}
+	return nil
+}
+
+// stringList reads a list of strings from a decoded json array or a go string slice.
+func stringList(value interface{}) []string {
+	switch list := value.(type) {
+	case []string:
+		return list
+	case []interface{}:
+		values := make([]string, 0, len(list))
+		for _, item := range list {
+			if text, ok := item.(string); ok {
+				values = append(values, text)
+			}
+		}
+		return values
+	}
+	return nil
+}
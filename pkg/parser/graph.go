@@ -0,0 +1,272 @@
+package parser
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+const (
+	GraphFormatDot     = "dot"
+	GraphFormatMermaid = "mermaid"
+
+	edgeOnSuccess  = "on_success"
+	edgeOnFailure  = "on_failure"
+	edgeNext       = "next"
+	edgeOnTimeout  = "on_timeout"
+	edgeCompensate = "compensate"
+	edgeOnError    = "on_error"
+)
+
+// graphNode is a rendered action or a terminal that ends the process.
+type graphNode struct {
+	id       string
+	name     string
+	label    []string
+	terminal bool
+}
+
+type graphEdge struct {
+	from  string
+	to    string
+	label string
+}
+
+type graph struct {
+	nodes   []graphNode
+	edges   []graphEdge
+	visited map[string]bool
+	// traversed holds "from->to" pairs taken by the overlaid session.
+	traversed map[string]bool
+}
+
+// RenderGraph renders the actions as a graphviz dot or mermaid flowchart. Visited action ids,
+// e.g. the executed path of a session, are highlighted.
+func RenderGraph(actions Actions, format string, visited []string) (string, error) {
+	g := newGraph(actions, visited)
+	switch format {
+	case GraphFormatDot, "":
+		return g.dot(), nil
+	case GraphFormatMermaid:
+		return g.mermaid(), nil
+	}
+	return "", fmt.Errorf("unknown graph format %s", format)
+}
+
+func newGraph(actions Actions, visited []string) *graph {
+	ids := sortedActionIds(actions)
+	g := &graph{visited: map[string]bool{}, traversed: map[string]bool{}}
+	names := map[string]string{}
+	name := func(id string) string {
+		if _, ok := names[id]; !ok {
+			names[id] = fmt.Sprintf("n%d", len(names))
+		}
+		return names[id]
+	}
+	for _, id := range ids {
+		name(id)
+	}
+	terminals := map[string]bool{}
+	for _, id := range ids {
+		action := actions[id]
+		if action == nil {
+			// an id without an action ends the session like an undefined one
+			terminals[id] = true
+			g.nodes = append(g.nodes, graphNode{id: id, name: name(id), label: terminalLabel(id), terminal: true})
+			continue
+		}
+		g.nodes = append(g.nodes, graphNode{id: id, name: name(id), label: actionLabel(id, action)})
+		for _, edge := range actionEdges(action) {
+			if _, ok := actions[edge.to]; !ok && !terminals[edge.to] {
+				terminals[edge.to] = true
+				g.nodes = append(g.nodes, graphNode{id: edge.to, name: name(edge.to), label: terminalLabel(edge.to), terminal: true})
+			}
+			g.edges = append(g.edges, graphEdge{from: name(id), to: name(edge.to), label: edge.label})
+		}
+	}
+
+	if len(visited) != 0 {
+		visited = append([]string{StartNode}, visited...)
+	}
+	for i, id := range visited {
+		g.visited[names[id]] = true
+		if i > 0 {
+			g.traversed[names[visited[i-1]]+"->"+names[id]] = true
+		}
+	}
+	return g
+}
+
+// sortedActionIds returns the action ids in a stable order, start_node first.
+func sortedActionIds(actions Actions) []string {
+	ids := make([]string, 0, len(actions))
+	for id := range actions {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		if ids[i] == StartNode || ids[j] == StartNode {
+			return ids[i] == StartNode
+		}
+		return ids[i] < ids[j]
+	})
+	return ids
+}
+
+func actionEdges(action *Action) []graphEdge {
+	edges := make([]graphEdge, 0, 4)
+	if action.OnSuccess != "" && action.OnSuccess == action.OnFailure {
+		edges = append(edges, graphEdge{to: action.OnSuccess, label: edgeOnSuccess + ", " + edgeOnFailure})
+	} else {
+		if action.OnSuccess != "" {
+			edges = append(edges, graphEdge{to: action.OnSuccess, label: edgeOnSuccess})
+		}
+		if action.OnFailure != "" {
+			edges = append(edges, graphEdge{to: action.OnFailure, label: edgeOnFailure})
+		}
+	}
+	if next := action.Args.GetString(edgeNext); next != "" && next != action.OnSuccess {
+		edges = append(edges, graphEdge{to: next, label: edgeNext})
+	}
+	if onTimeout := action.Args.GetString(edgeOnTimeout); onTimeout != "" && onTimeout != action.OnFailure {
+		edges = append(edges, graphEdge{to: onTimeout, label: edgeOnTimeout})
+	}
+	for _, branch := range action.branches() {
+		edges = append(edges, graphEdge{to: branch, label: edgeBranch})
+	}
+	if action.CompensateWith != "" {
+		edges = append(edges, graphEdge{to: action.CompensateWith, label: edgeCompensate})
+	}
+	if action.OnError != "" {
+		edges = append(edges, graphEdge{to: action.OnError, label: edgeOnError})
+	}
+	signals := make([]string, 0, len(action.OnSignal))
+	for signal := range action.OnSignal {
+		signals = append(signals, signal)
+	}
+	sort.Strings(signals)
+	for _, signal := range signals {
+		edges = append(edges, graphEdge{to: action.OnSignal[signal], label: "signal " + signal})
+	}
+	return edges
+}
+
+// actionLabel describes an action by its id, type and the args that matter for its type.
+func actionLabel(id string, action *Action) []string {
+	if action.ActionType == StartNode {
+		return []string{id}
+	}
+	label := []string{id, action.ActionType}
+	args := action.Args
+	switch action.ActionType {
+	case IsGreater:
+		label = append(label, fmt.Sprintf("%v > %v", args.Get(comparingKey), args.Get(compareToKey)))
+	case IsLower:
+		label = append(label, fmt.Sprintf("%v < %v", args.Get(comparingKey), args.Get(compareToKey)))
+	case IsEqual:
+		label = append(label, fmt.Sprintf("%v == %v", args.Get(comparingKey), args.Get(compareToKey)))
+	case HttpAction:
+		label = append(label, strings.ToUpper(args.GetString("method"))+" "+args.GetString("url"))
+	case TaskAction:
+		label = append(label, args.GetString("name"))
+	case ReceiveMessageAction:
+		label = append(label, "message "+args.GetString("name"))
+	case WaitSignalAction:
+		label = append(label, "signal "+args.GetString("name"))
+	case TimerAction:
+		if until := args.GetString("until"); until != "" {
+			label = append(label, "until "+until)
+		} else {
+			label = append(label, "wait "+args.GetString("duration"))
+		}
+	}
+	return label
+}
+
+// terminalLabel describes an action id that is not part of the definition, reaching it ends the process.
+func terminalLabel(id string) []string {
+	if id == "end" {
+		return []string{id}
+	}
+	return []string{id, "end"}
+}
+
+func (g *graph) dot() string {
+	var out strings.Builder
+	out.WriteString("digraph process {\n")
+	out.WriteString("  rankdir=TB;\n")
+	out.WriteString("  node [shape=box, style=rounded];\n")
+	for _, node := range g.nodes {
+		attributes := []string{fmt.Sprintf("label=\"%s\"", dotEscape(strings.Join(node.label, "\n")))}
+		if node.id == StartNode {
+			attributes = append(attributes, "shape=oval")
+		}
+		if node.terminal {
+			attributes = append(attributes, "shape=doublecircle")
+		}
+		if g.visited[node.name] {
+			attributes = append(attributes, "style=\"rounded,filled\"", "fillcolor=lightblue")
+		}
+		out.WriteString(fmt.Sprintf("  %s [%s];\n", node.name, strings.Join(attributes, ", ")))
+	}
+	for _, edge := range g.edges {
+		attributes := []string{fmt.Sprintf("label=\"%s\"", dotEscape(edge.label))}
+		if strings.Contains(edge.label, edgeOnFailure) && !strings.Contains(edge.label, edgeOnSuccess) {
+			attributes = append(attributes, "style=dashed")
+		}
+		if g.traversed[edge.from+"->"+edge.to] {
+			attributes = append(attributes, "color=blue", "penwidth=2")
+		}
+		out.WriteString(fmt.Sprintf("  %s -> %s [%s];\n", edge.from, edge.to, strings.Join(attributes, ", ")))
+	}
+	out.WriteString("}\n")
+	return out.String()
+}
+
+func (g *graph) mermaid() string {
+	var out strings.Builder
+	out.WriteString("flowchart TD\n")
+	for _, node := range g.nodes {
+		label := mermaidEscape(strings.Join(node.label, "<br/>"))
+		switch {
+		case node.id == StartNode:
+			out.WriteString(fmt.Sprintf("  %s([\"%s\"])\n", node.name, label))
+		case node.terminal:
+			out.WriteString(fmt.Sprintf("  %s(((\"%s\")))\n", node.name, label))
+		default:
+			out.WriteString(fmt.Sprintf("  %s[\"%s\"]\n", node.name, label))
+		}
+	}
+	traversed := make([]string, 0)
+	for i, edge := range g.edges {
+		arrow := "-->"
+		if strings.Contains(edge.label, edgeOnFailure) && !strings.Contains(edge.label, edgeOnSuccess) {
+			arrow = "-.->"
+		}
+		out.WriteString(fmt.Sprintf("  %s %s|%s| %s\n", edge.from, arrow, mermaidEscape(edge.label), edge.to))
+		if g.traversed[edge.from+"->"+edge.to] {
+			traversed = append(traversed, fmt.Sprintf("%d", i))
+		}
+	}
+	if len(g.visited) != 0 {
+		visited := make([]string, 0, len(g.visited))
+		for _, node := range g.nodes {
+			if g.visited[node.name] {
+				visited = append(visited, node.name)
+			}
+		}
+		out.WriteString("  classDef visited fill:#add8e6,stroke:#1f4e79\n")
+		out.WriteString(fmt.Sprintf("  class %s visited\n", strings.Join(visited, ",")))
+	}
+	if len(traversed) != 0 {
+		out.WriteString(fmt.Sprintf("  linkStyle %s stroke:#1f4e79,stroke-width:3px\n", strings.Join(traversed, ",")))
+	}
+	return out.String()
+}
+
+func dotEscape(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value)
+}
+
+func mermaidEscape(value string) string {
+	return strings.NewReplacer(`"`, "#quot;", "|", "#124;").Replace(value)
+}
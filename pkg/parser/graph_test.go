@@ -0,0 +1,112 @@
+package parser
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func graphActions() Actions {
+	actions := Actions{
+		StartNode: {
+			ActionType: StartNode,
+			OnSuccess:  "fetch",
+		},
+		"fetch": {
+			ActionType: HttpAction,
+			Args:       map[string]interface{}{"url": "http://partner.test/score", "method": "get"},
+			OnSuccess:  "check",
+			OnFailure:  "rejected",
+		},
+		"check": {
+			ActionType: IsGreater,
+			Args:       map[string]interface{}{comparingKey: "{{input_data.amount}}", compareToKey: "10"},
+			OnSuccess:  "end",
+			OnFailure:  "end",
+		},
+	}
+	actions.setIds()
+	return actions
+}
+
+func TestRenderGraph_Dot(t *testing.T) {
+	graph, err := RenderGraph(graphActions(), GraphFormatDot, []string{"fetch"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{
+		`n0 [label="start_node", shape=oval, style="rounded,filled", fillcolor=lightblue];`,
+		`n1 [label="check\nis_greater\n{{input_data.amount}} > 10"];`,
+		`n2 [label="fetch\nhttp\nGET http://partner.test/score", style="rounded,filled", fillcolor=lightblue];`,
+		`n3 [label="end", shape=doublecircle];`,
+		`n4 [label="rejected\nend", shape=doublecircle];`,
+		`n0 -> n2 [label="on_success", color=blue, penwidth=2];`,
+		`n1 -> n3 [label="on_success, on_failure"];`,
+		`n2 -> n4 [label="on_failure", style=dashed];`,
+	}
+	for _, line := range expected {
+		if !strings.Contains(graph, line) {
+			t.Errorf("missing %s in\n%s", line, graph)
+		}
+	}
+}
+
+func TestRenderGraph_Mermaid(t *testing.T) {
+	graph, err := RenderGraph(graphActions(), GraphFormatMermaid, []string{"fetch", "check"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{
+		"flowchart TD",
+		`n0(["start_node"])`,
+		`n3((("end")))`,
+		`n2 -.->|on_failure| n4`,
+		"class n0,n1,n2 visited",
+	}
+	for _, line := range expected {
+		if !strings.Contains(graph, line) {
+			t.Errorf("missing %s in\n%s", line, graph)
+		}
+	}
+}
+
+func TestRenderGraph_EmptyActionIsDangling(t *testing.T) {
+	actions := graphActions()
+	actions["rejected"] = nil
+	graph, err := RenderGraph(actions, GraphFormatDot, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Count(graph, `label="rejected\nend", shape=doublecircle`) != 1 {
+		t.Errorf("expected rejected rendered once as an end node in\n%s", graph)
+	}
+	if errors := (&Parser{}).validate(actions); errors["rejected"] == nil {
+		t.Errorf("expected the empty action reported, got %v", errors)
+	}
+}
+
+func TestRenderGraph_RejectsUnknownFormat(t *testing.T) {
+	if _, err := RenderGraph(graphActions(), "svg", nil); err == nil {
+		t.Error("expected error for unknown format")
+	}
+}
+
+func TestParserHttpHandler_Graph(t *testing.T) {
+	parser := NewParser()
+	parser.SetKey("scoring")
+	parser.SetActions(graphActions())
+	router := newTestRouter(parser)
+
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/api/definitions/scoring/graph?format=mermaid", nil))
+	if recorder.Code != http.StatusOK || !strings.HasPrefix(recorder.Body.String(), "flowchart TD") {
+		t.Errorf("expected mermaid graph, got %d %s", recorder.Code, recorder.Body.String())
+	}
+
+	recorder = httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/api/definitions/unknown/graph", nil))
+	if recorder.Code != http.StatusNotFound {
+		t.Errorf("expected status 404 for unknown definition, got %d", recorder.Code)
+	}
+}
@@ -2,20 +2,32 @@ package parser
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/propagation"
 	"io"
+	"log/slog"
 	"net/http"
 	"net/url"
+	"regexp"
 	"strings"
 	"time"
 )
 
 const (
-	IsGreater  = "is_greater"
-	IsLower    = "is_lower"
-	IsEqual    = "is_equal"
-	HttpAction = "http"
-	TaskAction = "task"
+	IsGreater   = "is_greater"
+	IsLower     = "is_lower"
+	IsEqual     = "is_equal"
+	HttpAction  = "http"
+	TaskAction  = "task"
+	TimerAction = "timer"
+	// ReceiveMessageAction waits for a message, see Parser.CorrelateMessage.
+	ReceiveMessageAction = "receive_message"
+	// WaitSignalAction waits for a broadcast signal, see Parser.BroadcastSignal.
+	WaitSignalAction = "wait_signal"
+	// CompensateAction undoes the actions executed since the last compensation, see Action.CompensateWith.
+	CompensateAction = "compensate"
 
 	comparingKey = "comparing"
 	compareToKey = "compare_to"
@@ -34,6 +46,16 @@ func CleanPlaceHolder(value string) string {
 	return strings.TrimSpace(strings.TrimRight(strings.TrimLeft(value, "{{"), "}}"))
 }
 
+var placeholderPattern = regexp.MustCompile(`{{[^{}]+}}`)
+
+// RenderTemplate replaces every placeholder inside value, e.g. loan-{{input_data.loan_id}}. Placeholders without
+// a session value are kept.
+func RenderTemplate(session Session, value string) string {
+	return placeholderPattern.ReplaceAllStringFunc(value, func(placeholder string) string {
+		return session.StringValueOf(CleanPlaceHolder(placeholder), placeholder)
+	})
+}
+
 type ResultArgs struct {
 	Result string `json:"result"`
 }
@@ -134,6 +156,8 @@ type HttpHandlerArgs struct {
 	Url        string `json:"url"`
 	HttpMethod string `json:"method"`
 	Timeout    int    `json:"timeout"`
+	// RateLimit names the rate limiter the request waits for, see Parser.AddRateLimiter.
+	RateLimit string `json:"rate_limit"`
 }
 
 func (h HttpHandlerArgs) Method() string {
@@ -157,12 +181,32 @@ func HttpHandler(ctx context.Context, action *Action, session Session) string {
 
 	var req *http.Request
 	req, err = http.NewRequest(httpArgs.Method(), httpArgs.Url, nil)
+	if err != nil {
+		AddActionError(session, httpArgs.ResultVariableAsError(action.ActionType), err)
+		return action.OnFailure
+	}
+	if httpArgs.RateLimit != "" {
+		release, err := acquireRateLimit(ctx, httpArgs.RateLimit)
+		if err != nil {
+			AddActionError(session, httpArgs.ResultVariableAsError(action.ActionType), err)
+			return action.OnFailure
+		}
+		defer release()
+	}
 	client := &http.Client{}
 
 	ctx, cancel := context.WithTimeout(ctx, time.Duration(httpArgs.Timeout)*time.Millisecond)
 	defer cancel()
+	Propagator.Inject(ctx, propagation.HeaderCarrier(req.Header))
+	logger := LoggerFromContext(ctx)
+	logger.Debug("sending http request", slog.String("method", httpArgs.Method()), slog.String("url", RedactUrl(httpArgs.Url)))
 	resp, err := client.Do(req.WithContext(ctx))
 	if err != nil {
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			urlErr.URL = RedactUrl(urlErr.URL)
+		}
+		logger.Warn("http request failed", slog.String("error", err.Error()))
 		AddActionError(session, httpArgs.ResultVariableAsError(action.ActionType), err)
 		return action.OnFailure
 	}
@@ -179,6 +223,23 @@ func HttpHandler(ctx context.Context, action *Action, session Session) string {
 	return action.OnSuccess
 }
 
+// acquireRateLimit waits until the named rate limiter lets the request through.
+func acquireRateLimit(ctx context.Context, name string) (func(), error) {
+	limiter, err := RateLimiterFromContext(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	start := time.Now()
+	release, err := limiter.Acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if waited := time.Since(start); waited > time.Millisecond {
+		LoggerFromContext(ctx).Debug("waited for rate limit", slog.String("rate_limit", name), slog.Duration("waited", waited))
+	}
+	return release, nil
+}
+
 func httpExecutedAction(action Action, url, method string, timeout int) *executedAction {
 	return &executedAction{
 		Action: action,
@@ -190,14 +251,99 @@ func httpExecutedAction(action Action, url, method string, timeout int) *execute
 	}
 }
 
+const (
+	taskGenerated = "task_generated"
+	taskTimedOut  = "task_timed_out"
+	taskEscalated = "task_escalated"
+)
+
 type TaskArgs struct {
 	ResultArgs
-	ID         string                 `json:"id"`
-	TaskName   string                 `json:"name"`
-	Parameters map[string]interface{} `json:"parameters"`
-	Next       string                 `json:"next"`
+	TaskAssignment
+	// ID is the definition key of the task, the generated task id is unique.
+	ID       string `json:"id"`
+	TaskName string `json:"name"`
+	// BusinessKey identifies the task for clients, placeholders inside it are rendered from the session.
+	BusinessKey string                 `json:"business_key"`
+	Parameters  map[string]interface{} `json:"parameters"`
+	// Wait parks the session until the task is completed, without it the session continues at on_success right away.
+	Wait bool   `json:"wait"`
+	Next string `json:"next"`
+	// Form is a json schema the completion payload is validated against.
+	Form JsonSchema `json:"form"`
+	// Due is an RFC3339 deadline, DueIn a go duration from the creation of the task. Placeholders are resolved
+	// from the session.
+	Due   string `json:"due"`
+	DueIn string `json:"due_in"`
+	// RemindBefore are go durations before the deadline a reminder is sent at.
+	RemindBefore    []string `json:"remind_before"`
+	ReminderWebhook string   `json:"reminder_webhook"`
+	// OnTimeout is the action to continue at once the task expired, on_failure by default.
+	OnTimeout string `json:"on_timeout"`
+	// EscalateTo reassigns the expired task instead of cancelling it.
+	EscalateTo *TaskAssignment `json:"escalate_to"`
+}
+
+// resolveAssignment resolves placeholders of the assignee and candidates.
+func resolveAssignment(assignment TaskAssignment, session Session) TaskAssignment {
+	resolve := func(values []string) []string {
+		resolved := make([]string, 0, len(values))
+		for _, value := range values {
+			resolved = append(resolved, session.PlaceholderOrStringValue(value))
+		}
+		return resolved
+	}
+	return TaskAssignment{
+		Assignee:        session.PlaceholderOrStringValue(assignment.Assignee),
+		CandidateUsers:  resolve(assignment.CandidateUsers),
+		CandidateGroups: resolve(assignment.CandidateGroups),
+	}
 }
 
+// deadline resolves the due time and reminders of a task the action created at created, a task without due or
+// due_in has no deadline.
+func (a TaskArgs) deadline(action *Action, session Session, created time.Time) (TaskDeadline, error) {
+	deadline := TaskDeadline{OnTimeout: a.OnTimeout, Result: a.ResultVariable(action.ActionType)}
+	if deadline.OnTimeout == "" {
+		deadline.OnTimeout = action.OnFailure
+	}
+	switch {
+	case a.Due != "":
+		due, err := time.Parse(time.RFC3339, session.PlaceholderOrStringValue(a.Due))
+		if err != nil {
+			return deadline, err
+		}
+		deadline.Due = due
+	case a.DueIn != "":
+		dueIn, err := time.ParseDuration(session.PlaceholderOrStringValue(a.DueIn))
+		if err != nil {
+			return deadline, err
+		}
+		deadline.Due = created.Add(dueIn)
+	default:
+		return deadline, nil
+	}
+	for _, remindBefore := range a.RemindBefore {
+		before, err := time.ParseDuration(session.PlaceholderOrStringValue(remindBefore))
+		if err != nil {
+			return deadline, err
+		}
+		deadline.Reminders = append(deadline.Reminders, deadline.Due.Add(-before))
+	}
+	if a.ReminderWebhook != "" {
+		deadline.ReminderWebhook = NewWebHook(session.PlaceholderOrStringValue(a.ReminderWebhook))
+	}
+	if a.EscalateTo != nil {
+		escalateTo := resolveAssignment(*a.EscalateTo, session)
+		deadline.EscalateTo = &escalateTo
+	}
+	return deadline, nil
+}
+
+// TaskHandler generates a task and continues at on_success, completing the task merges its payload into the input
+// data. With wait the session is parked until the task is completed instead, completing the task continues the
+// process at next, or at on_success when next is not set. A task with a deadline is escalated by the parser once
+// it expires, see TaskDeadline.
 func TaskHandler(ctx context.Context, action *Action, session Session) string {
 	taskArgs := TaskArgs{}
 	err := action.Args.Bind(&taskArgs)
@@ -206,14 +352,47 @@ func TaskHandler(ctx context.Context, action *Action, session Session) string {
 		session.AddExecutedAction(taskExecutedAction(*action, taskArgs.TaskName, taskArgs.Parameters))
 		return action.OnFailure
 	}
+	created := ClockFromContext(ctx).Now()
+	deadline, err := taskArgs.deadline(action, session, created)
+	if err != nil {
+		AddActionError(session, taskArgs.ResultVariableAsError(action.ActionType), err)
+		session.AddExecutedAction(taskExecutedAction(*action, taskArgs.TaskName, taskArgs.Parameters))
+		return action.OnFailure
+	}
 
-	session.AddTask(NewTask(taskArgs.ID, taskArgs.TaskName, taskArgs.Next, taskArgs.Parameters, session))
+	next := ""
+	if taskArgs.Wait {
+		next = taskArgs.Next
+		if next == "" {
+			next = action.OnSuccess
+		}
+	}
+	newTask := NewTaskWithOptions(uuid.NewString(), taskArgs.TaskName, next, taskArgs.Parameters, TaskOptions{
+		DefinitionKey: taskArgs.ID,
+		ActionId:      action.ID,
+		BusinessKey:   RenderTemplate(session, taskArgs.BusinessKey),
+		Assignment:    resolveAssignment(taskArgs.TaskAssignment, session),
+		Form:          taskArgs.Form,
+		Created:       created,
+		Deadline:      deadline,
+	}, session)
+	session.AddTask(newTask)
+	LoggerFromContext(ctx).Info("task generated",
+		slog.String("task_id", newTask.ID()),
+		slog.String("definition_key", taskArgs.ID),
+		slog.String("business_key", newTask.BusinessKey()),
+		slog.String("task_name", taskArgs.TaskName),
+	)
 	session.Set(
 		taskArgs.ResultVariable(action.ActionType),
-		"task_generated",
+		taskGenerated,
 	)
 	session.AddExecutedAction(taskExecutedAction(*action, taskArgs.TaskName, taskArgs.Parameters))
-	return action.OnSuccess
+	if !taskArgs.Wait {
+		return action.OnSuccess
+	}
+	session.SetStatus(StatusWaiting)
+	return ""
 }
 
 func taskExecutedAction(action Action, name string, parameters map[string]interface{}) *executedAction {
@@ -225,3 +404,62 @@ func taskExecutedAction(action Action, name string, parameters map[string]interf
 		},
 	}
 }
+
+type TimerArgs struct {
+	ResultArgs
+	// Duration to wait in go duration notation, e.g. 1h30m. Placeholders are resolved from the session.
+	Duration string `json:"duration"`
+	// Until is an RFC3339 timestamp to wait for. Placeholders are resolved from the session.
+	Until string `json:"until"`
+}
+
+func (a TimerArgs) wait(session Session, now time.Time) (time.Duration, error) {
+	if a.Until != "" {
+		until, err := time.Parse(time.RFC3339, session.PlaceholderOrStringValue(a.Until))
+		if err != nil {
+			return 0, err
+		}
+		return until.Sub(now), nil
+	}
+	return time.ParseDuration(session.PlaceholderOrStringValue(a.Duration))
+}
+
+// TimerHandler parks the session and continues at on_success once the duration elapsed on the parser clock.
+func (p *Parser) TimerHandler(ctx context.Context, action *Action, session Session) string {
+	timerArgs := TimerArgs{}
+	err := action.Args.Bind(&timerArgs)
+	if err != nil {
+		AddActionError(session, timerArgs.ResultVariableAsError(action.ActionType), err)
+		session.AddExecutedAction(timerExecutedAction(*action, time.Time{}))
+		return action.OnFailure
+	}
+	now := p.Clock().Now()
+	wait, err := timerArgs.wait(session, now)
+	if err != nil {
+		AddActionError(session, timerArgs.ResultVariableAsError(action.ActionType), err)
+		session.AddExecutedAction(timerExecutedAction(*action, time.Time{}))
+		return action.OnFailure
+	}
+	firesAt := now.Add(wait)
+	session.Set(timerArgs.ResultVariable(action.ActionType), firesAt.Format(time.RFC3339))
+	session.AddExecutedAction(timerExecutedAction(*action, firesAt))
+	if wait <= 0 {
+		return action.OnSuccess
+	}
+	LoggerFromContext(ctx).Info("timer started", slog.Time("fires_at", firesAt))
+	session.SetStatus(StatusWaiting)
+	from, next := action.ID, action.OnSuccess
+	p.Clock().AfterFunc(wait, func() {
+		p.wakeQueued(session, from, next, runInline)
+	})
+	return ""
+}
+
+func timerExecutedAction(action Action, firesAt time.Time) *executedAction {
+	return &executedAction{
+		Action: action,
+		Params: map[string]interface{}{
+			"fires_at": firesAt,
+		},
+	}
+}
@@ -1,7 +1,10 @@
 package parser
 
 import (
+	"bytes"
 	"context"
+	"log/slog"
+	"strings"
 	"testing"
 )
 
@@ -160,3 +163,100 @@ func TestTaskHandler(t *testing.T) {
 		t.Error("no task generated")
 	}
 }
+
+func TestTaskHandler_GeneratesUniqueIds(t *testing.T) {
+	action := &Action{
+		ActionType: TaskAction,
+		Args: map[string]interface{}{
+			"id":           "approve",
+			"name":         "approve loan",
+			"business_key": "loan-{{input_data.loan_id}}",
+		},
+		OnSuccess: "check",
+		OnFailure: "end",
+	}
+	session := NewSession(map[string]interface{}{"loan_id": 42}, nil)
+	TaskHandler(context.Background(), action, session)
+	TaskHandler(context.Background(), action, session)
+
+	first, second := session.Tasks()[0], session.Tasks()[1]
+	if first.ID() == second.ID() || first.ID() == "approve" {
+		t.Errorf("expected generated unique ids, got %s and %s", first.ID(), second.ID())
+	}
+	if first.DefinitionKey() != "approve" || first.BusinessKey() != "loan-42" {
+		t.Errorf("expected definition key approve and business key loan-42, got %s and %s", first.DefinitionKey(), first.BusinessKey())
+	}
+	if session.Task(first.ID()) != first {
+		t.Error("expected lookup by id")
+	}
+	if session.Task("loan-42") != second || session.Task("approve") != second {
+		t.Error("expected lookup by key to return the latest task")
+	}
+}
+
+func TestRenderTemplate(t *testing.T) {
+	session := NewSession(map[string]interface{}{"loan_id": 42, "region": "eu"}, nil)
+	rendered := RenderTemplate(session, "{{ input_data.region }}/loan-{{input_data.loan_id}}/{{input_data.missing}}")
+	if rendered != "eu/loan-42/{{input_data.missing}}" {
+		t.Errorf("unexpected rendered template %s", rendered)
+	}
+}
+
+func TestTimerHandler(t *testing.T) {
+	parser := NewParser()
+	action := &Action{
+		ActionType: TimerAction,
+		Args: map[string]interface{}{
+			"duration": "{{input_data.wait}}",
+		},
+		OnSuccess: "test_1",
+		OnFailure: "test_2",
+	}
+	session := NewSession(map[string]interface{}{"wait": "5m"}, nil)
+	next := parser.TimerHandler(context.Background(), action, session)
+	if next != "" || session.Status() != StatusWaiting {
+		t.Errorf("expected timer to park the session, got next %s and status %s", next, session.Status())
+	}
+
+	action.Args["duration"] = "not a duration"
+	session = NewSession(map[string]interface{}{}, nil)
+	if next = parser.TimerHandler(context.Background(), action, session); next != action.OnFailure {
+		t.Errorf("expected invalid duration to take on_failure, got %s", next)
+	}
+}
+
+func TestParser_EmptyWebhookIsSkipped(t *testing.T) {
+	logs := &bytes.Buffer{}
+	logger, err := NewLogger(logs, slog.LevelDebug, LogFormatText)
+	if err != nil {
+		t.Fatal(err)
+	}
+	parser := NewParser()
+	parser.SetLogger(logger)
+	parser.SetActions(Actions{
+		StartNode: {ActionType: StartNode, OnSuccess: "approve"},
+		"approve": {
+			ActionType: TaskAction,
+			Args:       Args{"id": "approve", "name": "approve", "due_in": "48h", "remind_before": []interface{}{"24h"}, "wait": true},
+			OnSuccess:  "end",
+			OnFailure:  "end",
+		},
+	})
+	// start requests without a webhook carry one with an empty url
+	session := parser.Run(context.Background(), nil, NewWebHook(""))
+	task := session.Task("approve")
+	if task == nil {
+		t.Fatal("expected a pending task")
+	}
+	parser.remindTask(task)
+	if !strings.Contains(logs.String(), "no webhook for task reminder") || strings.Contains(logs.String(), "task reminder sent") {
+		t.Errorf("expected the reminder skipped, got\n%s", logs.String())
+	}
+
+	if err := parser.RunTask(context.Background(), task, nil); err != nil {
+		t.Fatal(err)
+	}
+	if session.Status() != StatusCompleted || session.OnFinishWebhookResponse() != nil || len(parser.failedWebhooks) != 0 {
+		t.Errorf("expected the finish webhook skipped, got %s %v", session.Status(), session.OnFinishWebhookResponse())
+	}
+}
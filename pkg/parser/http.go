@@ -2,8 +2,22 @@ package parser
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/propagation"
+	"io"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// UserHeader identifies the user claiming, delegating or completing a task.
+	UserHeader = "X-User"
+	// GroupsHeader lists the comma separated groups of the user.
+	GroupsHeader = "X-User-Groups"
 )
 
 type MessageResponse struct {
@@ -28,33 +42,128 @@ func NewParserHttpHandler(file string) ParserHttpHandler {
 }
 
 func BuildHttp(router *gin.Engine, file string) {
-	httpHandler := NewParserHttpHandler(file)
+	BuildParserHttp(router, NewParserHttpHandler(file).parser)
+}
+
+// BuildParserHttp registers the api routes for an already configured parser.
+func BuildParserHttp(router *gin.Engine, parser *Parser) {
+	httpHandler := ParserHttpHandler{parser: parser}
+	router.Use(httpHandler.parser.Metrics().GinMiddleware())
+	router.GET("/metrics", gin.WrapH(httpHandler.parser.Metrics().Handler()))
 	router.Group("api").
 		GET("/sessions", httpHandler.GetSessions).
 		GET("/sessions/:id", httpHandler.Session).
+		DELETE("/sessions/:id", httpHandler.DeleteSession).
 		POST("/sessions", httpHandler.StartSession).
 		GET("/sessions/:id/tasks", httpHandler.Tasks).
-		POST("/sessions/:id/tasks/:task_id", httpHandler.CompleteTask)
+		POST("/sessions/:id/tasks/:task_id", httpHandler.CompleteTask).
+		POST("/sessions/:id/tasks/:task_id/claim", httpHandler.ClaimTask).
+		POST("/sessions/:id/tasks/:task_id/unclaim", httpHandler.UnclaimTask).
+		POST("/sessions/:id/tasks/:task_id/delegate", httpHandler.DelegateTask).
+		GET("/tasks", httpHandler.QueryTasks).
+		GET("/tasks/:task_id", httpHandler.Task).
+		POST("/messages", httpHandler.CorrelateMessage).
+		POST("/signals/:name", httpHandler.BroadcastSignal).
+		GET("/pool", httpHandler.WorkerPool).
+		GET("/definitions/:key/graph", httpHandler.Graph).
+		GET("/schema/definition", httpHandler.DefinitionSchema)
 }
 
+const (
+	defaultSessionPageLimit = 50
+	maxSessionPageLimit     = 500
+	sessionFieldsSummary    = "summary"
+	sessionFieldsFull       = "full"
+)
+
+// GetSessions lists the sessions oldest first. Filters are status, process_key, business_key, started_after,
+// started_before and repeated value predicates, sort is one of SessionSorts. Pages are selected with limit and the
+// next_cursor of the previous page, fields is summary or full.
 func (p *ParserHttpHandler) GetSessions(ctx *gin.Context) {
-	sessions := p.parser.Sessions()
-	dtoSessions := make([]SessionDto, len(sessions))
-	for i, activeSession := range sessions {
-		dtoSessions[i] = NewSessionDto(activeSession)
+	query, err := sessionQuery(ctx)
+	fields := ctx.DefaultQuery("fields", sessionFieldsSummary)
+	if err == nil && fields != sessionFieldsSummary && fields != sessionFieldsFull {
+		err = fmt.Errorf("unknown fields %s, expected summary or full", fields)
+	}
+	if err != nil {
+		ctx.JSON(http.StatusUnprocessableEntity, MessageResponse{Message: err.Error()})
+		return
+	}
+	page, err := p.parser.QuerySessions(query)
+	if err != nil {
+		ctx.JSON(http.StatusUnprocessableEntity, MessageResponse{Message: err.Error()})
+		return
 	}
-	ctx.JSON(http.StatusOK, dtoSessions)
+	var items interface{}
+	if fields == sessionFieldsFull {
+		full := make([]SessionDto, len(page.Sessions))
+		for i, activeSession := range page.Sessions {
+			full[i] = NewSessionDto(activeSession)
+		}
+		items = full
+	} else {
+		summaries := make([]SessionSummaryDto, len(page.Sessions))
+		for i, activeSession := range page.Sessions {
+			summaries[i] = NewSessionSummaryDto(activeSession)
+		}
+		items = summaries
+	}
+	ctx.JSON(http.StatusOK, SessionPageDto{
+		Items:      items,
+		Total:      page.Total,
+		NextCursor: page.NextCursor,
+		Limit:      query.Limit,
+	})
+}
+
+func sessionQuery(ctx *gin.Context) (SessionQuery, error) {
+	query := SessionQuery{
+		Status:      ctx.Query("status"),
+		ProcessKey:  ctx.Query("process_key"),
+		BusinessKey: ctx.Query("business_key"),
+		Sort:        ctx.DefaultQuery("sort", SessionSortStarted),
+		Cursor:      ctx.Query("cursor"),
+		Limit:       defaultSessionPageLimit,
+	}
+	var err error
+	for name, target := range map[string]*time.Time{"started_after": &query.StartedAfter, "started_before": &query.StartedBefore} {
+		if value := ctx.Query(name); value != "" {
+			*target, err = time.Parse(time.RFC3339, value)
+			if err != nil {
+				return query, fmt.Errorf("invalid %s: %w", name, err)
+			}
+		}
+	}
+	for _, value := range ctx.QueryArray("value") {
+		predicate, err := ParseValuePredicate(value)
+		if err != nil {
+			return query, err
+		}
+		query.Values = append(query.Values, predicate)
+	}
+	if value := ctx.Query("limit"); value != "" {
+		query.Limit, err = strconv.Atoi(value)
+		if err != nil || query.Limit < 1 || query.Limit > maxSessionPageLimit {
+			return query, fmt.Errorf("limit must be between 1 and %d", maxSessionPageLimit)
+		}
+	}
+	return query, nil
 }
 
 type StartSessionRequest struct {
 	Data    map[string]interface{}     `json:"data"`
 	Webhook StartSessionWebhookRequest `json:"webhook"`
+	// Limits lower the limits of the parser for the session, zero values keep the limits of the parser.
+	Limits *LimitsDto `json:"limits"`
+	// Priority is low, normal or high, it orders the sessions queued by the worker pool.
+	Priority string `json:"priority"`
 }
 
 type StartSessionWebhookRequest struct {
 	Url string `json:"url"`
 }
 
+// StartSession starts a session, 202 is returned while the session is queued and 429 when the queue is full.
 func (p *ParserHttpHandler) StartSession(ctx *gin.Context) {
 	var request StartSessionRequest
 	if err := ctx.BindJSON(&request); err != nil {
@@ -68,13 +177,160 @@ func (p *ParserHttpHandler) StartSession(ctx *gin.Context) {
 		request.Data = map[string]interface{}{}
 	}
 
-	sessionUuid := p.parser.Execute(context.Background(), request.Data, NewWebHook(request.Webhook.Url))
+	wait, timeout, err := waitQuery(ctx)
+	if err != nil {
+		ctx.JSON(
+			http.StatusUnprocessableEntity,
+			MessageResponse{Message: err.Error()},
+		)
+		return
+	}
+
+	traceCtx := Propagator.Extract(context.Background(), propagation.HeaderCarrier(ctx.Request.Header))
+	if request.Limits != nil {
+		limits, err := request.Limits.Limits()
+		if err != nil {
+			ctx.JSON(http.StatusUnprocessableEntity, MessageResponse{Message: err.Error()})
+			return
+		}
+		traceCtx = ContextWithLimits(traceCtx, limits.within(p.parser.Limits()))
+	}
+	priority, err := ParsePriority(request.Priority)
+	if err != nil {
+		ctx.JSON(http.StatusUnprocessableEntity, MessageResponse{Message: err.Error()})
+		return
+	}
+	traceCtx = ContextWithPriority(traceCtx, priority)
+	if wait {
+		activeSession, done, err := p.parser.ExecuteSync(traceCtx, request.Data, NewWebHook(request.Webhook.Url), timeout)
+		if err != nil {
+			ctx.JSON(rejectionStatus(err), MessageResponse{Message: err.Error()})
+			return
+		}
+		if !done {
+			ctx.JSON(
+				http.StatusAccepted,
+				MessageResponse{Message: activeSession.Uuid()},
+			)
+			return
+		}
+		ctx.JSON(http.StatusCreated, NewSessionDto(activeSession))
+		return
+	}
+	activeSession, err := p.parser.Enqueue(traceCtx, request.Data, NewWebHook(request.Webhook.Url))
+	if err != nil {
+		ctx.JSON(rejectionStatus(err), MessageResponse{Message: err.Error()})
+		return
+	}
+	status := http.StatusCreated
+	if activeSession.Status() == StatusQueued {
+		status = http.StatusAccepted
+	}
 	ctx.JSON(
-		http.StatusCreated,
-		MessageResponse{Message: sessionUuid},
+		status,
+		MessageResponse{Message: activeSession.Uuid()},
 	)
 }
 
+// rejectionStatus is 503 for sessions rejected during shutdown, 500 without a definition and 429 for a full queue.
+func rejectionStatus(err error) int {
+	if errors.Is(err, ErrShuttingDown) {
+		return http.StatusServiceUnavailable
+	}
+	if errors.Is(err, ErrNoStartNode) {
+		return http.StatusInternalServerError
+	}
+	return http.StatusTooManyRequests
+}
+
+// WorkerPool returns the queue and the running sessions of the worker pool, 404 when the parser has none.
+func (p *ParserHttpHandler) WorkerPool(ctx *gin.Context) {
+	pool := p.parser.WorkerPool()
+	if pool == nil {
+		ctx.JSON(http.StatusNotFound, MessageResponse{Message: "no worker pool configured"})
+		return
+	}
+	ctx.JSON(http.StatusOK, NewWorkerPoolDto(pool.Stats()))
+}
+
+type CorrelateMessageRequest struct {
+	Message
+	// Webhook is the on finish webhook of a session the message starts.
+	Webhook StartSessionWebhookRequest `json:"webhook"`
+}
+
+// CorrelateMessage resumes the sessions waiting for the message, or starts a session of a definition that starts
+// with it. Messages nobody waits for are rejected with 404.
+func (p *ParserHttpHandler) CorrelateMessage(ctx *gin.Context) {
+	var request CorrelateMessageRequest
+	if err := ctx.BindJSON(&request); err != nil {
+		ctx.JSON(http.StatusUnprocessableEntity, MessageResponse{Message: err.Error()})
+		return
+	}
+	if request.Name == "" {
+		ctx.JSON(http.StatusUnprocessableEntity, MessageResponse{Message: ErrMessageNameRequired.Error()})
+		return
+	}
+	var webhook Webhook
+	if request.Webhook.Url != "" {
+		webhook = NewWebHook(request.Webhook.Url)
+	}
+	traceCtx := Propagator.Extract(context.Background(), propagation.HeaderCarrier(ctx.Request.Header))
+	correlation, err := p.parser.CorrelateMessage(traceCtx, request.Message, webhook)
+	if errors.Is(err, ErrMessageNotCorrelated) {
+		ctx.JSON(http.StatusNotFound, MessageResponse{Message: err.Error()})
+		return
+	}
+	if errors.Is(err, ErrShuttingDown) {
+		ctx.JSON(http.StatusServiceUnavailable, MessageResponse{Message: err.Error()})
+		return
+	}
+	if errors.Is(err, ErrQueueFull) {
+		ctx.JSON(http.StatusTooManyRequests, MessageResponse{Message: err.Error()})
+		return
+	}
+	ctx.JSON(http.StatusAccepted, NewMessageCorrelationDto(correlation))
+}
+
+type BroadcastSignalRequest struct {
+	Payload map[string]interface{} `json:"payload"`
+}
+
+// BroadcastSignal resumes or interrupts every session waiting for the signal, the request body is optional.
+func (p *ParserHttpHandler) BroadcastSignal(ctx *gin.Context) {
+	var request BroadcastSignalRequest
+	if err := ctx.ShouldBindJSON(&request); err != nil && !errors.Is(err, io.EOF) {
+		ctx.JSON(http.StatusUnprocessableEntity, MessageResponse{Message: err.Error()})
+		return
+	}
+	broadcast := p.parser.BroadcastSignal(ctx.Param("name"), request.Payload)
+	ctx.JSON(http.StatusAccepted, NewSignalBroadcastDto(broadcast))
+}
+
+const (
+	defaultWaitTimeout = 5 * time.Second
+	maxWaitTimeout     = time.Minute
+)
+
+// waitQuery reads the wait and timeout query parameters of a start session request.
+func waitQuery(ctx *gin.Context) (bool, time.Duration, error) {
+	wait, err := strconv.ParseBool(ctx.DefaultQuery("wait", "false"))
+	if err != nil {
+		return false, 0, fmt.Errorf("invalid wait %s", ctx.Query("wait"))
+	}
+	timeout := defaultWaitTimeout
+	if value := ctx.Query("timeout"); value != "" {
+		timeout, err = time.ParseDuration(value)
+		if err != nil || timeout <= 0 {
+			return false, 0, fmt.Errorf("invalid timeout %s", value)
+		}
+	}
+	if timeout > maxWaitTimeout {
+		timeout = maxWaitTimeout
+	}
+	return wait, timeout, nil
+}
+
 func (p *ParserHttpHandler) Session(ctx *gin.Context) {
 	activeSession := p.parser.Session(ctx.Param("id"))
 	if activeSession == nil {
@@ -84,6 +340,19 @@ func (p *ParserHttpHandler) Session(ctx *gin.Context) {
 	ctx.JSON(http.StatusOK, NewSessionDto(activeSession))
 }
 
+// DeleteSession removes a finished or waiting session without archiving it, 409 for queued and running sessions.
+func (p *ParserHttpHandler) DeleteSession(ctx *gin.Context) {
+	err := p.parser.DeleteSession(ctx.Param("id"))
+	switch {
+	case errors.Is(err, ErrSessionNotFound):
+		ctx.JSON(http.StatusNotFound, MessageResponse{Message: err.Error()})
+	case errors.Is(err, ErrSessionActive):
+		ctx.JSON(http.StatusConflict, MessageResponse{Message: err.Error()})
+	default:
+		ctx.Status(http.StatusNoContent)
+	}
+}
+
 func (p *ParserHttpHandler) Tasks(ctx *gin.Context) {
 	activeSession := p.parser.Session(ctx.Param("id"))
 	if activeSession == nil {
@@ -93,15 +362,10 @@ func (p *ParserHttpHandler) Tasks(ctx *gin.Context) {
 	ctx.JSON(http.StatusOK, NewTasksDto(activeSession.Tasks()))
 }
 
+// CompleteTask completes a task as the user of the request, the payload is validated against the task form.
 func (p *ParserHttpHandler) CompleteTask(ctx *gin.Context) {
-	activeSession := p.parser.Session(ctx.Param("id"))
-	if activeSession == nil {
-		ctx.JSON(http.StatusNotFound, nil)
-		return
-	}
-	activeTask := activeSession.Task(ctx.Param("task_id"))
+	activeTask := p.task(ctx)
 	if activeTask == nil {
-		ctx.JSON(http.StatusNotFound, nil)
 		return
 	}
 	var payload map[string]interface{}
@@ -112,6 +376,220 @@ func (p *ParserHttpHandler) CompleteTask(ctx *gin.Context) {
 		})
 		return
 	}
-	activeTask.Execute(payload)
+	err = p.parser.CompleteTask(ContextWithTaskUser(context.Background(), taskUser(ctx)), activeTask, payload)
+	if err != nil {
+		taskError(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, NewTaskDto(activeTask))
+}
+
+func (p *ParserHttpHandler) ClaimTask(ctx *gin.Context) {
+	activeTask := p.task(ctx)
+	if activeTask == nil {
+		return
+	}
+	err := activeTask.Claim(taskUser(ctx))
+	if err != nil {
+		taskError(ctx, err)
+		return
+	}
 	ctx.JSON(http.StatusOK, NewTaskDto(activeTask))
 }
+
+func (p *ParserHttpHandler) UnclaimTask(ctx *gin.Context) {
+	activeTask := p.task(ctx)
+	if activeTask == nil {
+		return
+	}
+	err := activeTask.Unclaim(taskUser(ctx))
+	if err != nil {
+		taskError(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, NewTaskDto(activeTask))
+}
+
+type DelegateTaskRequest struct {
+	Assignee string `json:"assignee" binding:"required"`
+}
+
+func (p *ParserHttpHandler) DelegateTask(ctx *gin.Context) {
+	activeTask := p.task(ctx)
+	if activeTask == nil {
+		return
+	}
+	request := DelegateTaskRequest{}
+	err := ctx.ShouldBindJSON(&request)
+	if err != nil {
+		ctx.JSON(http.StatusUnprocessableEntity, MessageResponse{Message: err.Error()})
+		return
+	}
+	err = activeTask.Delegate(taskUser(ctx), request.Assignee)
+	if err != nil {
+		taskError(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, NewTaskDto(activeTask))
+}
+
+const (
+	defaultTaskPageLimit = 50
+	maxTaskPageLimit     = 500
+)
+
+// QueryTasks lists the tasks of all sessions. Filters are name, definition_key, business_key, status, assignee,
+// candidate_group, process_key, created_after and created_before, sort is one of TaskSorts, pages are selected with offset and limit.
+func (p *ParserHttpHandler) QueryTasks(ctx *gin.Context) {
+	query, err := taskQuery(ctx)
+	if err != nil {
+		ctx.JSON(http.StatusUnprocessableEntity, MessageResponse{Message: err.Error()})
+		return
+	}
+	tasks, total := p.parser.TaskIndex().Query(query)
+	ctx.JSON(http.StatusOK, TaskPageDto{
+		Items:  NewTasksDto(tasks),
+		Total:  total,
+		Offset: query.Offset,
+		Limit:  query.Limit,
+	})
+}
+
+// Task returns a task by id, business key or definition key. Keys shared by tasks of several sessions are narrowed
+// down with the session query.
+func (p *ParserHttpHandler) Task(ctx *gin.Context) {
+	tasks := p.parser.TaskIndex().Find(ctx.Param("task_id"))
+	if sessionUuid := ctx.Query("session"); sessionUuid != "" {
+		matching := make([]Task, 0, 1)
+		for _, candidate := range tasks {
+			if candidate.Session() != nil && candidate.Session().Uuid() == sessionUuid {
+				matching = append(matching, candidate)
+			}
+		}
+		tasks = matching
+	}
+	switch len(tasks) {
+	case 0:
+		ctx.JSON(http.StatusNotFound, nil)
+	case 1:
+		ctx.JSON(http.StatusOK, NewTaskDto(tasks[0]))
+	default:
+		ctx.JSON(http.StatusConflict, MessageResponse{
+			Message: fmt.Sprintf("%d tasks share the key %s, select one with the session query", len(tasks), ctx.Param("task_id")),
+		})
+	}
+}
+
+func taskQuery(ctx *gin.Context) (TaskQuery, error) {
+	query := TaskQuery{
+		Name:           ctx.Query("name"),
+		DefinitionKey:  ctx.Query("definition_key"),
+		BusinessKey:    ctx.Query("business_key"),
+		Status:         ctx.Query("status"),
+		Assignee:       ctx.Query("assignee"),
+		CandidateGroup: ctx.Query("candidate_group"),
+		ProcessKey:     ctx.Query("process_key"),
+		Sort:           ctx.DefaultQuery("sort", TaskSortCreated),
+		Limit:          defaultTaskPageLimit,
+	}
+	if !TaskSorts[query.Sort] {
+		return query, fmt.Errorf("unknown sort %s", query.Sort)
+	}
+	var err error
+	for name, target := range map[string]*time.Time{"created_after": &query.CreatedAfter, "created_before": &query.CreatedBefore} {
+		if value := ctx.Query(name); value != "" {
+			*target, err = time.Parse(time.RFC3339, value)
+			if err != nil {
+				return query, fmt.Errorf("invalid %s: %w", name, err)
+			}
+		}
+	}
+	for name, target := range map[string]*int{"offset": &query.Offset, "limit": &query.Limit} {
+		if value := ctx.Query(name); value != "" {
+			*target, err = strconv.Atoi(value)
+			if err != nil || *target < 0 {
+				return query, fmt.Errorf("invalid %s %s", name, value)
+			}
+		}
+	}
+	if query.Limit == 0 || query.Limit > maxTaskPageLimit {
+		return query, fmt.Errorf("limit must be between 1 and %d", maxTaskPageLimit)
+	}
+	return query, nil
+}
+
+// task looks up the task of the request and responds with 404 when the session or task does not exist.
+func (p *ParserHttpHandler) task(ctx *gin.Context) Task {
+	activeSession := p.parser.Session(ctx.Param("id"))
+	if activeSession == nil {
+		ctx.JSON(http.StatusNotFound, nil)
+		return nil
+	}
+	activeTask := activeSession.Task(ctx.Param("task_id"))
+	if activeTask == nil {
+		ctx.JSON(http.StatusNotFound, nil)
+		return nil
+	}
+	return activeTask
+}
+
+// taskUser reads the user working on a task from the UserHeader and GroupsHeader headers.
+func taskUser(ctx *gin.Context) TaskUser {
+	user := TaskUser{ID: strings.TrimSpace(ctx.GetHeader(UserHeader))}
+	for _, group := range strings.Split(ctx.GetHeader(GroupsHeader), ",") {
+		if group = strings.TrimSpace(group); group != "" {
+			user.Groups = append(user.Groups, group)
+		}
+	}
+	return user
+}
+
+// taskError responds 422 with the form errors, 403 when the user may not work on the task and 409 otherwise.
+func taskError(ctx *gin.Context, err error) {
+	var formError *FormError
+	switch {
+	case errors.As(err, &formError):
+		ctx.JSON(http.StatusUnprocessableEntity, map[string]interface{}{
+			"error":  err.Error(),
+			"errors": formError.Errors,
+		})
+	case errors.Is(err, ErrNotCandidate), errors.Is(err, ErrNotAssignee):
+		ctx.JSON(http.StatusForbidden, MessageResponse{Message: err.Error()})
+	default:
+		ctx.JSON(http.StatusConflict, MessageResponse{Message: err.Error()})
+	}
+}
+
+// Graph renders the process definition as dot or mermaid. With a session query the executed path is highlighted.
+func (p *ParserHttpHandler) Graph(ctx *gin.Context) {
+	if ctx.Param("key") != p.parser.Key() {
+		ctx.JSON(http.StatusNotFound, nil)
+		return
+	}
+	var visited []string
+	if sessionUuid := ctx.Query("session"); sessionUuid != "" {
+		activeSession := p.parser.Session(sessionUuid)
+		if activeSession == nil {
+			ctx.JSON(http.StatusNotFound, MessageResponse{Message: fmt.Sprintf("session %s not found", sessionUuid)})
+			return
+		}
+		visited = VisitedActions(activeSession)
+	}
+	format := ctx.DefaultQuery("format", GraphFormatDot)
+	graph, err := RenderGraph(p.parser.Actions(), format, visited)
+	if err != nil {
+		ctx.JSON(http.StatusUnprocessableEntity, MessageResponse{Message: err.Error()})
+		return
+	}
+	contentType := "text/vnd.graphviz; charset=utf-8"
+	if format == GraphFormatMermaid {
+		contentType = "text/vnd.mermaid; charset=utf-8"
+	}
+	ctx.Data(http.StatusOK, contentType, []byte(graph))
+}
+
+// DefinitionSchema serves the json schema of definitions, including args of custom handlers registered with a schema.
+func (p *ParserHttpHandler) DefinitionSchema(ctx *gin.Context) {
+	ctx.Header("Content-Type", "application/schema+json")
+	ctx.JSON(http.StatusOK, p.parser.DefinitionSchema())
+}
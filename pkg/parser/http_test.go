@@ -0,0 +1,158 @@
+package parser
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func newTestRouter(parser *Parser) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	BuildParserHttp(router, parser)
+	return router
+}
+
+func syncActions() Actions {
+	return map[string]*Action{
+		StartNode: {
+			ActionType: StartNode,
+			OnSuccess:  "test_id_1",
+		},
+		"test_id_1": {
+			ActionType: IsEqual,
+			Args:       map[string]interface{}{comparingKey: "10", compareToKey: "10", result: "equal"},
+			OnSuccess:  "test_id_2",
+			OnFailure:  "test_id_2",
+		},
+		"test_id_2": {
+			ActionType: "block",
+			OnSuccess:  "end",
+			OnFailure:  "end",
+		},
+	}
+}
+
+func TestParserHttpHandler_StartSessionWaitsForResult(t *testing.T) {
+	parser := NewParser()
+	parser.SetActions(syncActions())
+	parser.AddHandler("block", func(ctx context.Context, action *Action, session Session) string {
+		return action.OnSuccess
+	})
+	router := newTestRouter(parser)
+
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/api/sessions?wait=true&timeout=1s", strings.NewReader(`{"data":{}}`)))
+	if recorder.Code != http.StatusCreated {
+		t.Fatalf("expected status 201, got %d %s", recorder.Code, recorder.Body.String())
+	}
+	var session SessionDto
+	if err := json.Unmarshal(recorder.Body.Bytes(), &session); err != nil {
+		t.Fatal(err)
+	}
+	if session.Status != StatusCompleted || session.Values["equal"] != true {
+		t.Errorf("expected completed session with values, got %s", recorder.Body.String())
+	}
+}
+
+func TestParserHttpHandler_StartSessionFallsBackToAccepted(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+	parser := NewParser()
+	parser.SetActions(syncActions())
+	parser.AddHandler("block", func(ctx context.Context, action *Action, session Session) string {
+		<-release
+		return action.OnSuccess
+	})
+	router := newTestRouter(parser)
+
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/api/sessions?wait=true&timeout=10ms", strings.NewReader(`{"data":{}}`)))
+	if recorder.Code != http.StatusAccepted {
+		t.Fatalf("expected status 202, got %d %s", recorder.Code, recorder.Body.String())
+	}
+	var response MessageResponse
+	if err := json.Unmarshal(recorder.Body.Bytes(), &response); err != nil {
+		t.Fatal(err)
+	}
+	if parser.Session(response.Message) == nil {
+		t.Errorf("expected session uuid in response, got %s", recorder.Body.String())
+	}
+}
+
+func TestParserHttpHandler_StartSessionRejectsInvalidTimeout(t *testing.T) {
+	parser := NewParser()
+	parser.SetActions(syncActions())
+	router := newTestRouter(parser)
+
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/api/sessions?wait=true&timeout=soon", strings.NewReader(`{"data":{}}`)))
+	if recorder.Code != http.StatusUnprocessableEntity {
+		t.Errorf("expected status 422, got %d", recorder.Code)
+	}
+}
+
+func TestParserHttpHandler_TaskLifecycle(t *testing.T) {
+	parser := NewParser()
+	parser.SetActions(Actions{
+		StartNode: {ActionType: StartNode, OnSuccess: "approve"},
+		"approve": {
+			ActionType: TaskAction,
+			Args: Args{
+				"id":               "approve",
+				"name":             "approve",
+				"wait":             true,
+				"candidate_groups": []interface{}{"managers"},
+				"form":             map[string]interface{}{"required": []interface{}{"approved"}},
+			},
+			OnSuccess: "end",
+			OnFailure: "end",
+		},
+	})
+	session := parser.Run(context.Background(), map[string]interface{}{}, nil)
+	router := newTestRouter(parser)
+	request := func(path, user, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/api/sessions/"+session.Uuid()+"/tasks/approve"+path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set(UserHeader, user)
+		req.Header.Set(GroupsHeader, "staff, managers")
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, req)
+		return recorder
+	}
+
+	if recorder := request("/claim", "", ""); recorder.Code != http.StatusForbidden {
+		t.Errorf("expected anonymous claim to be forbidden, got %d", recorder.Code)
+	}
+	if recorder := request("/delegate", "alice", `{"assignee": "mallory"}`); recorder.Code != http.StatusConflict {
+		t.Errorf("expected delegating an open task to conflict, got %d", recorder.Code)
+	}
+	if recorder := request("/claim", "alice", ""); recorder.Code != http.StatusOK {
+		t.Fatalf("expected claim, got %d %s", recorder.Code, recorder.Body.String())
+	}
+	if recorder := request("", "bob", `{"approved": true}`); recorder.Code != http.StatusForbidden {
+		t.Errorf("expected completion by other user to be forbidden, got %d", recorder.Code)
+	}
+	if recorder := request("/delegate", "alice", `{"assignee": "bob"}`); recorder.Code != http.StatusOK {
+		t.Fatalf("expected delegation, got %d %s", recorder.Code, recorder.Body.String())
+	}
+	if recorder := request("", "bob", `{}`); recorder.Code != http.StatusUnprocessableEntity || !strings.Contains(recorder.Body.String(), "approved is a required field") {
+		t.Errorf("expected form errors, got %d %s", recorder.Code, recorder.Body.String())
+	}
+	recorder := request("", "bob", `{"approved": true}`)
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("expected completion, got %d %s", recorder.Code, recorder.Body.String())
+	}
+	var task TaskDto
+	if err := json.Unmarshal(recorder.Body.Bytes(), &task); err != nil || task.Status != TaskStatusCompleted || task.Assignee != "bob" {
+		t.Errorf("expected task completed by bob, got %s", recorder.Body.String())
+	}
+	if recorder := request("", "bob", `{"approved": true}`); recorder.Code != http.StatusConflict {
+		t.Errorf("expected double completion to conflict, got %d", recorder.Code)
+	}
+}
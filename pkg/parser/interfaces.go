@@ -1,6 +1,9 @@
 package parser
 
-import "context"
+import (
+	"context"
+	"time"
+)
 
 // Handler interface. Expects id of next action to execute. Returning empty string finished the process execution
 type Handler func(ctx context.Context, action *Action, session Session) string
@@ -13,6 +16,10 @@ func (a Args) Get(key string) interface{} {
 
 type Session interface {
 	Uuid() string
+	ProcessKey() string
+	SetProcessKey(processKey string)
+	Status() string
+	SetStatus(status string)
 	Values() map[string]interface{}
 	ExecutedActions() []ExecutedAction
 	InputData() map[string]interface{}
@@ -29,17 +36,30 @@ type Session interface {
 	StringValueOf(key string, defaultValue string) string
 	IntValueOf(key string, defaultValue int64) int64
 	Tasks() []Task
-	Task(id string) Task
+	Task(idOrKey string) Task
 	AddTask(task Task)
 	UpdateData(parameters map[string]interface{})
+	Errors() []ActionError
+	AddError(actionError ActionError)
+	Started() time.Time
+	Finished() time.Time
+	SetFinished(finished time.Time)
+	Limits() Limits
+	SetLimits(limits Limits)
+	Steps() int
+	AddStep() int
+	CurrentAction() string
+	SetCurrentAction(actionId string)
 }
 
 type ExecutedAction interface {
+	ID() string
 	Type() string
 	Arguments() Args
 	OnSuccess() string
 	OnFailure() string
 	Parameters() map[string]interface{}
+	Failed() bool
 }
 
 type Webhook interface {
@@ -48,9 +68,24 @@ type Webhook interface {
 
 type Task interface {
 	ID() string
+	DefinitionKey() string
+	ActionId() string
+	BusinessKey() string
 	Name() string
 	Next() string
 	Parameters() map[string]interface{}
+	Created() time.Time
+	Form() JsonSchema
+	Deadline() TaskDeadline
+	Status() string
+	Assignment() TaskAssignment
 	Execute(parameters map[string]interface{})
+	Complete(user TaskUser, parameters map[string]interface{}) error
+	Claim(user TaskUser) error
+	Unclaim(user TaskUser) error
+	Delegate(user TaskUser, assignee string) error
+	Reassign(assignment TaskAssignment) error
+	Cancel()
+	Completed() bool
 	Session() Session
 }
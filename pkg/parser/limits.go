@@ -0,0 +1,75 @@
+package parser
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+)
+
+var (
+	ErrStepLimitExceeded = errors.New("step limit exceeded")
+	ErrTimeLimitExceeded = errors.New("time limit exceeded")
+)
+
+// Limits bound the actions a session executes and the wall-clock time since it started, zero values do not limit.
+// A session exceeding a limit fails, its on_error action is not run.
+type Limits struct {
+	MaxSteps    int
+	MaxDuration time.Duration
+}
+
+func (l Limits) check(steps int, started time.Time) error {
+	if l.MaxSteps > 0 && steps > l.MaxSteps {
+		return fmt.Errorf("%w: %d steps", ErrStepLimitExceeded, l.MaxSteps)
+	}
+	if l.MaxDuration > 0 && time.Since(started) > l.MaxDuration {
+		return fmt.Errorf("%w: %s", ErrTimeLimitExceeded, l.MaxDuration)
+	}
+	return nil
+}
+
+// within lowers the limits to the maxima, a zero value takes the maximum and a zero maximum does not limit.
+func (l Limits) within(maxima Limits) Limits {
+	if l.MaxSteps <= 0 || (maxima.MaxSteps > 0 && l.MaxSteps > maxima.MaxSteps) {
+		l.MaxSteps = maxima.MaxSteps
+	}
+	if l.MaxDuration <= 0 || (maxima.MaxDuration > 0 && l.MaxDuration > maxima.MaxDuration) {
+		l.MaxDuration = maxima.MaxDuration
+	}
+	return l
+}
+
+type limitsKey struct{}
+
+// ContextWithLimits overrides the limits of the parser for a session started with the context.
+func ContextWithLimits(ctx context.Context, limits Limits) context.Context {
+	return context.WithValue(ctx, limitsKey{}, limits)
+}
+
+// LimitsFromContext returns the limits stored with ContextWithLimits.
+func LimitsFromContext(ctx context.Context) (Limits, bool) {
+	limits, ok := ctx.Value(limitsKey{}).(Limits)
+	return limits, ok
+}
+
+// SetLimits sets the limits of new sessions.
+func (p *Parser) SetLimits(limits Limits) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.limits = limits
+}
+
+func (p *Parser) Limits() Limits {
+	return p.limits
+}
+
+// exceedLimit fails the session before it executes the action.
+func (p *Parser) exceedLimit(ctx context.Context, session Session, actionId, actionType string, err error) {
+	p.sessionLogger(session).Error("session exceeded a limit", slog.String("action_id", actionId), slog.String("error", err.Error()))
+	err = Fatal(err)
+	p.addError(session, actionId, actionType, err)
+	session.Set(errorValue, map[string]interface{}{"action_id": actionId, "error": err.Error()})
+	p.finish(ctx, session, StatusFailed)
+}
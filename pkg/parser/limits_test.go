@@ -0,0 +1,169 @@
+package parser
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+// countdownActions loop at countdown until the counter of the session reached 0.
+func countdownActions() Actions {
+	return Actions{
+		StartNode:   {ActionType: StartNode, OnSuccess: "countdown"},
+		"countdown": {ActionType: "countdown", OnSuccess: "end", OnFailure: "end"},
+	}
+}
+
+// countdownHandler records the stack depth of the first and the last step.
+func countdownHandler(depths *[]int) Handler {
+	return func(ctx context.Context, action *Action, session Session) string {
+		remaining := session.Values()["remaining"].(int)
+		if depths != nil && (len(*depths) == 0 || remaining == 1) {
+			*depths = append(*depths, runtime.Callers(0, make([]uintptr, 1024)))
+		}
+		if remaining == 0 {
+			return action.OnSuccess
+		}
+		session.Set("remaining", remaining-1)
+		return action.ID
+	}
+}
+
+func runCountdown(ctx context.Context, parser *Parser, steps int) Session {
+	activeSession := NewSession(map[string]interface{}{}, nil)
+	activeSession.Set("remaining", steps)
+	activeSession.SetLimits(parser.Limits())
+	if limits, ok := LimitsFromContext(ctx); ok {
+		activeSession.SetLimits(limits)
+	}
+	parser.runActionById(ctx, "countdown", activeSession)
+	return activeSession
+}
+
+func TestParser_LoopsWithConstantStack(t *testing.T) {
+	depths := make([]int, 0, 2)
+	parser := NewParser()
+	parser.AddHandler("countdown", countdownHandler(&depths))
+	parser.SetActions(countdownActions())
+
+	session := runCountdown(context.Background(), parser, 10000)
+	if session.Status() != StatusCompleted || session.Steps() != 10001 {
+		t.Fatalf("expected session completed after 10001 steps, got %s after %d", session.Status(), session.Steps())
+	}
+	if len(depths) != 2 || depths[0] != depths[1] {
+		t.Errorf("expected the same stack depth at the first and last step, got %v", depths)
+	}
+}
+
+func TestParser_StepLimitFailsSession(t *testing.T) {
+	parser := NewParser()
+	parser.AddHandler("countdown", countdownHandler(nil))
+	parser.SetActions(countdownActions())
+	parser.SetLimits(Limits{MaxSteps: 100})
+
+	session := runCountdown(context.Background(), parser, 1000)
+	if session.Status() != StatusFailed || session.Steps() != 101 {
+		t.Fatalf("expected session failed at step 101, got %s at %d", session.Status(), session.Steps())
+	}
+	sessionErrors := session.Errors()
+	if len(sessionErrors) != 1 || sessionErrors[0].ActionId != "countdown" || sessionErrors[0].Message != "step limit exceeded: 100 steps" {
+		t.Errorf("expected the step limit reported, got %+v", sessionErrors)
+	}
+
+	session = runCountdown(ContextWithLimits(context.Background(), Limits{}), parser, 1000)
+	if session.Status() != StatusCompleted {
+		t.Errorf("expected the session limits to override the parser, got %s", session.Status())
+	}
+}
+
+func TestParser_TimeLimitFailsSession(t *testing.T) {
+	parser := NewParser()
+	parser.AddHandler("countdown", func(ctx context.Context, action *Action, session Session) string {
+		time.Sleep(time.Millisecond)
+		return action.ID
+	})
+	parser.SetActions(countdownActions())
+
+	session := parser.Run(ContextWithLimits(context.Background(), Limits{MaxDuration: 10 * time.Millisecond}), map[string]interface{}{}, nil)
+	if session.Status() != StatusFailed {
+		t.Fatalf("expected session failed, got %s", session.Status())
+	}
+	if sessionErrors := session.Errors(); len(sessionErrors) != 1 || sessionErrors[0].Message != "time limit exceeded: 10ms" {
+		t.Errorf("expected the time limit reported, got %+v", sessionErrors)
+	}
+	if dto := NewSessionDto(session); dto.Limits.MaxDuration != "10ms" {
+		t.Errorf("expected the session limits in the dto, got %+v", dto.Limits)
+	}
+}
+
+func TestLimits_Within(t *testing.T) {
+	maxima := Limits{MaxSteps: 100, MaxDuration: time.Minute}
+	for name, test := range map[string]struct {
+		limits, maxima, expected Limits
+	}{
+		"lower":     {Limits{MaxSteps: 10, MaxDuration: time.Second}, maxima, Limits{MaxSteps: 10, MaxDuration: time.Second}},
+		"higher":    {Limits{MaxSteps: 1000, MaxDuration: time.Hour}, maxima, maxima},
+		"zero":      {Limits{}, maxima, maxima},
+		"unlimited": {Limits{MaxSteps: 1000}, Limits{}, Limits{MaxSteps: 1000}},
+	} {
+		if limits := test.limits.within(test.maxima); limits != test.expected {
+			t.Errorf("%s: expected %+v, got %+v", name, test.expected, limits)
+		}
+	}
+}
+
+func TestParserHttpHandler_StartSessionLimitsWithinParser(t *testing.T) {
+	parser := NewParser()
+	parser.AddHandler("countdown", func(ctx context.Context, action *Action, session Session) string {
+		return action.ID
+	})
+	parser.SetActions(countdownActions())
+	parser.SetLimits(Limits{MaxSteps: 100})
+	router := newTestRouter(parser)
+
+	for body, expected := range map[string]int{`{}`: 100, `{"max_steps": 1000000}`: 100, `{"max_steps": 10}`: 10} {
+		recorder := httptest.NewRecorder()
+		request := httptest.NewRequest(http.MethodPost, "/api/sessions?wait=true", strings.NewReader(`{"data": {}, "limits": `+body+`}`))
+		request.Header.Set("Content-Type", "application/json")
+		router.ServeHTTP(recorder, request)
+		var session SessionDto
+		if err := json.Unmarshal(recorder.Body.Bytes(), &session); err != nil {
+			t.Fatal(err)
+		}
+		if session.Limits.MaxSteps != expected || session.Status != StatusFailed {
+			t.Errorf("expected %s limited to %d steps, got %s with %+v", body, expected, session.Status, session.Limits)
+		}
+	}
+}
+
+func BenchmarkParser_MillionStepLoop(b *testing.B) {
+	parser := NewParser()
+	parser.AddHandler("countdown", countdownHandler(nil))
+	parser.SetActions(countdownActions())
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if session := runCountdown(context.Background(), parser, 1000000); session.Status() != StatusCompleted {
+			b.Fatalf("expected session completed, got %s", session.Status())
+		}
+	}
+}
+
+func BenchmarkParser_MillionStepLoopStack(b *testing.B) {
+	depths := make([]int, 0, 2)
+	parser := NewParser()
+	parser.AddHandler("countdown", countdownHandler(&depths))
+	parser.SetActions(countdownActions())
+	for i := 0; i < b.N; i++ {
+		depths = depths[:0]
+		runCountdown(context.Background(), parser, 1000000)
+		if len(depths) != 2 || depths[0] != depths[1] {
+			b.Fatalf("expected a constant stack depth, got %v", depths)
+		}
+	}
+	b.ReportMetric(float64(depths[1]), "frames/step")
+}
@@ -0,0 +1,150 @@
+package parser
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/url"
+	"strings"
+)
+
+const (
+	LogFormatText = "text"
+	LogFormatJson = "json"
+
+	redacted = "[REDACTED]"
+)
+
+// SensitiveKeys are matched case-insensitively against log attribute and map keys, values of matching keys are redacted.
+var SensitiveKeys = []string{"password", "secret", "token", "authorization", "api_key", "apikey", "cookie"}
+
+type loggerKey struct{}
+
+// NewLogger builds a leveled logger writing text or json lines with sensitive values redacted.
+func NewLogger(w io.Writer, level slog.Level, format string) (*slog.Logger, error) {
+	options := &slog.HandlerOptions{
+		Level:       level,
+		ReplaceAttr: redactAttr,
+	}
+	switch format {
+	case LogFormatJson:
+		return slog.New(slog.NewJSONHandler(w, options)), nil
+	case LogFormatText, "":
+		return slog.New(slog.NewTextHandler(w, options)), nil
+	}
+	return nil, fmt.Errorf("unknown log format %s", format)
+}
+
+func ParseLogLevel(level string) (slog.Level, error) {
+	var l slog.Level
+	err := l.UnmarshalText([]byte(level))
+	return l, err
+}
+
+// ContextWithLogger stores a logger so handlers can log with the session context attached.
+func ContextWithLogger(ctx context.Context, logger *slog.Logger) context.Context {
+	return context.WithValue(ctx, loggerKey{}, logger)
+}
+
+// LoggerFromContext returns the logger stored by the parser or the default logger.
+func LoggerFromContext(ctx context.Context) *slog.Logger {
+	logger, ok := ctx.Value(loggerKey{}).(*slog.Logger)
+	if !ok || logger == nil {
+		return slog.Default()
+	}
+	return logger
+}
+
+func (p *Parser) SetLogger(logger *slog.Logger) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.logger = logger
+}
+
+func (p *Parser) Logger() *slog.Logger {
+	if p.logger == nil {
+		return slog.Default()
+	}
+	return p.logger
+}
+
+func (p *Parser) sessionLogger(session Session) *slog.Logger {
+	return p.Logger().With(
+		slog.String("session_uuid", session.Uuid()),
+		slog.String("process_key", session.ProcessKey()),
+	)
+}
+
+func isSensitiveKey(key string) bool {
+	key = strings.ToLower(key)
+	for _, sensitive := range SensitiveKeys {
+		if strings.Contains(key, sensitive) {
+			return true
+		}
+	}
+	return false
+}
+
+func redactAttr(_ []string, a slog.Attr) slog.Attr {
+	if isSensitiveKey(a.Key) {
+		return slog.String(a.Key, redacted)
+	}
+	if a.Value.Kind() == slog.KindAny {
+		switch v := a.Value.Any().(type) {
+		case map[string]interface{}, []interface{}:
+			return slog.Any(a.Key, redactValue(v))
+		}
+	}
+	return a
+}
+
+// Redact returns a copy of values with the values of sensitive keys replaced, nested maps and lists included.
+func Redact(values map[string]interface{}) map[string]interface{} {
+	if values == nil {
+		return nil
+	}
+	clean := make(map[string]interface{}, len(values))
+	for k, v := range values {
+		if isSensitiveKey(k) {
+			clean[k] = redacted
+			continue
+		}
+		clean[k] = redactValue(v)
+	}
+	return clean
+}
+
+func redactValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		return Redact(v)
+	case []interface{}:
+		clean := make([]interface{}, len(v))
+		for i, item := range v {
+			clean[i] = redactValue(item)
+		}
+		return clean
+	}
+	return value
+}
+
+// RedactUrl replaces the password and the values of sensitive query parameters of the url. Urls that do not parse
+// are redacted entirely.
+func RedactUrl(rawUrl string) string {
+	parsed, err := url.Parse(rawUrl)
+	if err != nil {
+		return redacted
+	}
+	if parsed.RawQuery != "" {
+		parameters := strings.Split(parsed.RawQuery, "&")
+		for i, parameter := range parameters {
+			key, _, _ := strings.Cut(parameter, "=")
+			if name, err := url.QueryUnescape(key); err != nil || isSensitiveKey(name) {
+				parameters[i] = key + "=" + redacted
+			}
+		}
+		parsed.RawQuery = strings.Join(parameters, "&")
+	}
+	return parsed.Redacted()
+}
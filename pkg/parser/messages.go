@@ -0,0 +1,196 @@
+package parser
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+)
+
+// startMessageKey is the start_node arg naming the message that starts a new session.
+const startMessageKey = "message"
+
+var (
+	ErrMessageNameRequired  = errors.New("message name is required")
+	ErrMessageNotCorrelated = errors.New("no session is waiting for the message")
+	ErrSignalNameRequired   = errors.New("signal name is required")
+)
+
+// Message is an outside event a session can wait for.
+type Message struct {
+	Name string `json:"name"`
+	// CorrelationKeys select the waiting sessions, every key a session waits with has to match.
+	CorrelationKeys map[string]string      `json:"correlation_keys"`
+	Payload         map[string]interface{} `json:"payload"`
+}
+
+// MessageCorrelation holds the sessions a message resumed or started.
+type MessageCorrelation struct {
+	Resumed []Session
+	Started Session
+}
+
+type ReceiveMessageArgs struct {
+	ResultArgs
+	Name string `json:"name"`
+	// CorrelationKeys are rendered from the session, see RenderTemplate.
+	CorrelationKeys map[string]string `json:"correlation_keys"`
+}
+
+// subscription is a session waiting at an action for a message or signal.
+type subscription struct {
+	name     string
+	keys     map[string]string
+	session  Session
+	actionId string
+	next     string
+	result   string
+}
+
+func (s subscription) matches(message Message) bool {
+	if s.name != message.Name {
+		return false
+	}
+	for key, value := range s.keys {
+		if received, ok := message.CorrelationKeys[key]; !ok || received != value {
+			return false
+		}
+	}
+	return true
+}
+
+// ReceiveMessageHandler parks the session until a message with the name and correlation keys arrives, see
+// CorrelateMessage. The message payload is stored in the result and the process continues at on_success.
+func (p *Parser) ReceiveMessageHandler(ctx context.Context, action *Action, session Session) string {
+	messageArgs := ReceiveMessageArgs{}
+	err := action.Args.Bind(&messageArgs)
+	if err == nil && messageArgs.Name == "" {
+		err = ErrMessageNameRequired
+	}
+	if err != nil {
+		AddActionError(session, messageArgs.ResultVariableAsError(action.ActionType), err)
+		session.AddExecutedAction(receiveMessageExecutedAction(*action, messageArgs.Name, nil))
+		return action.OnFailure
+	}
+	keys := make(map[string]string, len(messageArgs.CorrelationKeys))
+	for key, value := range messageArgs.CorrelationKeys {
+		keys[key] = RenderTemplate(session, value)
+	}
+	session.AddExecutedAction(receiveMessageExecutedAction(*action, messageArgs.Name, keys))
+	session.SetStatus(StatusWaiting)
+	p.lock.Lock()
+	p.subscriptions = append(p.subscriptions, subscription{
+		name:     messageArgs.Name,
+		keys:     keys,
+		session:  session,
+		actionId: action.ID,
+		next:     action.OnSuccess,
+		result:   messageArgs.ResultVariable(action.ActionType),
+	})
+	p.lock.Unlock()
+	LoggerFromContext(ctx).Info("waiting for message", slog.String("message", messageArgs.Name), slog.Any("correlation_keys", keys))
+	return ""
+}
+
+func receiveMessageExecutedAction(action Action, name string, keys map[string]string) *executedAction {
+	return &executedAction{
+		Action: action,
+		Params: map[string]interface{}{
+			"name":             name,
+			"correlation_keys": keys,
+		},
+	}
+}
+
+// StartMessage is the message that starts a new session of the loaded definition, empty when sessions are only
+// started explicitly.
+func (p *Parser) StartMessage() string {
+	startAction := p.Actions()[StartNode]
+	if startAction == nil {
+		return ""
+	}
+	return startAction.Args.GetString(startMessageKey)
+}
+
+// CorrelateMessage resumes every session waiting for the message and continues them in the background, on the
+// worker pool when the parser has one. When no
+// session waits for it and the definition starts with the message, a new session is started with the payload as
+// input data, it is queued like Enqueue. ErrMessageNotCorrelated is returned when the message neither resumed nor
+// started a session, ErrQueueFull when the worker pool rejected the new session.
+func (p *Parser) CorrelateMessage(ctx context.Context, message Message, webhook Webhook) (MessageCorrelation, error) {
+	return p.correlateMessage(ctx, message, webhook, false)
+}
+
+// RunMessage correlates the message like CorrelateMessage and continues the sessions on the calling goroutine
+// until they finish or wait again.
+func (p *Parser) RunMessage(ctx context.Context, message Message, webhook Webhook) (MessageCorrelation, error) {
+	return p.correlateMessage(ctx, message, webhook, true)
+}
+
+func (p *Parser) correlateMessage(ctx context.Context, message Message, webhook Webhook, sync bool) (MessageCorrelation, error) {
+	payload := message.Payload
+	if payload == nil {
+		payload = map[string]interface{}{}
+	}
+	correlation := MessageCorrelation{Resumed: make([]Session, 0)}
+	for _, waiting := range p.takeSubscriptions(&p.subscriptions, message) {
+		waiting := waiting
+		waiting.session.Set(waiting.result, payload)
+		p.sessionLogger(waiting.session).Info("message correlated", slog.String("message", message.Name))
+		correlation.Resumed = append(correlation.Resumed, waiting.session)
+		if sync {
+			p.wake(waiting.session, waiting.actionId, waiting.next)
+		} else {
+			p.wakeQueued(waiting.session, waiting.actionId, waiting.next, runInBackground)
+		}
+	}
+	if len(correlation.Resumed) != 0 {
+		return correlation, nil
+	}
+	if message.Name == "" || message.Name != p.StartMessage() {
+		return correlation, ErrMessageNotCorrelated
+	}
+	data := make(map[string]interface{}, len(payload))
+	for key, value := range payload {
+		data[key] = value
+	}
+	newSession, done, err := p.enqueue(ctx, data, webhook)
+	if err != nil {
+		return correlation, err
+	}
+	correlation.Started = newSession
+	// the session runs in the background or on the worker pool, RunMessage waits until it finished or waits
+	if sync {
+		<-done
+	}
+	return correlation, nil
+}
+
+// takeSubscriptions removes and returns the subscriptions of the list matching the message.
+func (p *Parser) takeSubscriptions(list *[]subscription, message Message) []subscription {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	matching := make([]subscription, 0)
+	remaining := (*list)[:0]
+	for _, waiting := range *list {
+		if waiting.matches(message) {
+			matching = append(matching, waiting)
+			continue
+		}
+		remaining = append(remaining, waiting)
+	}
+	*list = remaining
+	return matching
+}
+
+// unsubscribe drops the message and signal subscriptions of a session. The caller must hold the parser lock.
+func (p *Parser) unsubscribe(session Session) {
+	for _, list := range []*[]subscription{&p.subscriptions, &p.signalWaits} {
+		remaining := (*list)[:0]
+		for _, waiting := range *list {
+			if waiting.session != session {
+				remaining = append(remaining, waiting)
+			}
+		}
+		*list = remaining
+	}
+}
@@ -0,0 +1,141 @@
+package parser
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func paymentActions(startMessage string) Actions {
+	return Actions{
+		StartNode: {ActionType: StartNode, Args: Args{startMessageKey: startMessage}, OnSuccess: "payment"},
+		"payment": {
+			ActionType: ReceiveMessageAction,
+			Args: Args{
+				"name":             "payment_received",
+				"correlation_keys": map[string]interface{}{"order_id": "{{input_data.order_id}}"},
+				result:             "payment",
+			},
+			OnSuccess: "check",
+			OnFailure: "end",
+		},
+		"check": {
+			ActionType: IsGreater,
+			Args:       Args{comparingKey: "{{values.payment.amount}}", compareToKey: "10", result: "paid"},
+			OnSuccess:  "end",
+			OnFailure:  "end",
+		},
+	}
+}
+
+func TestParser_RunMessageResumesCorrelatedSession(t *testing.T) {
+	parser := NewParser()
+	parser.SetActions(paymentActions(""))
+	first := parser.Run(context.Background(), map[string]interface{}{"order_id": "1"}, nil)
+	second := parser.Run(context.Background(), map[string]interface{}{"order_id": "2"}, nil)
+	if first.Status() != StatusWaiting || second.Status() != StatusWaiting {
+		t.Fatalf("expected waiting sessions, got %s and %s", first.Status(), second.Status())
+	}
+
+	correlation, err := parser.RunMessage(context.Background(), Message{
+		Name:            "payment_received",
+		CorrelationKeys: map[string]string{"order_id": "2", "currency": "eur"},
+		Payload:         map[string]interface{}{"amount": 20},
+	}, nil)
+	if err != nil || len(correlation.Resumed) != 1 || correlation.Resumed[0] != second {
+		t.Fatalf("expected the second session resumed, got %v %v", correlation, err)
+	}
+	if second.Status() != StatusCompleted || second.ValueOf("paid") != true {
+		t.Errorf("expected paid and completed session, got %s %v", second.Status(), second.ValueOf("paid"))
+	}
+	if first.Status() != StatusWaiting {
+		t.Errorf("expected first session to keep waiting, got %s", first.Status())
+	}
+
+	_, err = parser.RunMessage(context.Background(), Message{
+		Name:            "payment_received",
+		CorrelationKeys: map[string]string{"order_id": "2"},
+	}, nil)
+	if err != ErrMessageNotCorrelated {
+		t.Errorf("expected a message to resume a session only once, got %v", err)
+	}
+}
+
+func TestParser_RunMessageStartsSession(t *testing.T) {
+	parser := NewParser()
+	parser.SetActions(paymentActions("order_placed"))
+	correlation, err := parser.RunMessage(context.Background(), Message{
+		Name:    "order_placed",
+		Payload: map[string]interface{}{"order_id": "7"},
+	}, nil)
+	if err != nil || correlation.Started == nil {
+		t.Fatalf("expected a started session, got %v", err)
+	}
+	if correlation.Started.Status() != StatusWaiting || correlation.Started.InputData()["order_id"] != "7" {
+		t.Errorf("expected session waiting for payment of order 7, got %s", correlation.Started.Status())
+	}
+	if _, err = parser.RunMessage(context.Background(), Message{Name: "order_cancelled"}, nil); err != ErrMessageNotCorrelated {
+		t.Errorf("expected unknown message to be rejected, got %v", err)
+	}
+}
+
+func TestParserHttpHandler_CorrelateMessage(t *testing.T) {
+	parser := NewParser()
+	parser.SetActions(paymentActions(""))
+	session := parser.Run(context.Background(), map[string]interface{}{"order_id": "1"}, nil)
+	router := newTestRouter(parser)
+
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/api/messages", strings.NewReader(
+		`{"name":"payment_received","correlation_keys":{"order_id":"1"},"payload":{"amount":5}}`,
+	)))
+	var correlation MessageCorrelationDto
+	if err := json.Unmarshal(recorder.Body.Bytes(), &correlation); err != nil || recorder.Code != http.StatusAccepted {
+		t.Fatalf("expected accepted message, got %d %s", recorder.Code, recorder.Body.String())
+	}
+	if len(correlation.Resumed) != 1 || correlation.Resumed[0] != session.Uuid() {
+		t.Errorf("expected session %s resumed, got %v", session.Uuid(), correlation.Resumed)
+	}
+	deadline := time.Now().Add(time.Second)
+	for session.Status() != StatusCompleted && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if session.Status() != StatusCompleted {
+		t.Errorf("expected resumed session to complete, got %s", session.Status())
+	}
+
+	recorder = httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/api/messages", strings.NewReader(`{"name":"payment_received"}`)))
+	if recorder.Code != http.StatusNotFound {
+		t.Errorf("expected message without waiting session to be rejected, got %d", recorder.Code)
+	}
+}
+
+func TestParserHttpHandler_CorrelateMessageQueueFull(t *testing.T) {
+	gate, started := make(chan struct{}), make(chan string, 4)
+	defer close(gate)
+	parser := gatedParser("orders", gate, started)
+	parser.Actions()[StartNode].Args = Args{startMessageKey: "order_placed"}
+	parser.SetWorkerPool(NewWorkerPool(WorkerPoolOptions{Workers: 1, QueueSize: 1}))
+	router := newTestRouter(parser)
+
+	codes := make([]int, 0, 3)
+	for i := 0; i < 3; i++ {
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/api/messages", strings.NewReader(`{"name":"order_placed"}`)))
+		codes = append(codes, recorder.Code)
+		if i == 0 {
+			waitStarted(t, started)
+		}
+	}
+	if codes[0] != http.StatusAccepted || codes[1] != http.StatusAccepted || codes[2] != http.StatusTooManyRequests {
+		t.Errorf("expected the started sessions queued and then rejected, got %v", codes)
+	}
+	if stats := parser.WorkerPool().Stats(); stats.Queued != 1 || stats.Running != 1 {
+		t.Errorf("expected the message sessions on the pool, got %+v", stats)
+	}
+}
@@ -0,0 +1,236 @@
+package parser
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const metricsNamespace = "process_manager"
+
+const (
+	WebhookResultSkipped = "skipped"
+	WebhookResultError   = "error"
+	WebhookResultSuccess = "success"
+	WebhookResultFailure = "failure"
+)
+
+// Metrics holds the prometheus collectors of a parser. A nil *Metrics is valid and records nothing.
+type Metrics struct {
+	registry *prometheus.Registry
+
+	sessionsStarted   *prometheus.CounterVec
+	sessionsCompleted *prometheus.CounterVec
+	sessionsFailed    *prometheus.CounterVec
+	sessionsRejected  *prometheus.CounterVec
+	actionsExecuted   *prometheus.CounterVec
+	actionDuration    *prometheus.HistogramVec
+	handlerErrors     *prometheus.CounterVec
+	webhookDeliveries *prometheus.CounterVec
+	httpRequests      *prometheus.CounterVec
+	httpDuration      *prometheus.HistogramVec
+}
+
+func NewMetrics(registry *prometheus.Registry) *Metrics {
+	m := &Metrics{
+		registry: registry,
+		sessionsStarted: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "sessions_started_total",
+			Help:      "Number of sessions started.",
+		}, []string{"process"}),
+		sessionsCompleted: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "sessions_completed_total",
+			Help:      "Number of sessions that finished successfully.",
+		}, []string{"process"}),
+		sessionsFailed: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "sessions_failed_total",
+			Help:      "Number of sessions that finished with a failure.",
+		}, []string{"process"}),
+		sessionsRejected: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "sessions_rejected_total",
+			Help:      "Number of sessions rejected because the worker pool queue was full.",
+		}, []string{"process"}),
+		actionsExecuted: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "actions_executed_total",
+			Help:      "Number of executed actions by action type.",
+		}, []string{"process", "type"}),
+		actionDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: metricsNamespace,
+			Name:      "action_duration_seconds",
+			Help:      "Action handler execution latency by action type.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"process", "type"}),
+		handlerErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "handler_errors_total",
+			Help:      "Number of actions that failed or had no registered handler.",
+		}, []string{"process", "type"}),
+		webhookDeliveries: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "webhook_deliveries_total",
+			Help:      "Number of on finish webhook deliveries by result.",
+		}, []string{"result"}),
+		httpRequests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "http_requests_total",
+			Help:      "Number of api requests by route and status code.",
+		}, []string{"method", "route", "status"}),
+		httpDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: metricsNamespace,
+			Name:      "http_request_duration_seconds",
+			Help:      "Api request latency by route.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"method", "route"}),
+	}
+	registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		m.sessionsStarted,
+		m.sessionsCompleted,
+		m.sessionsFailed,
+		m.sessionsRejected,
+		m.actionsExecuted,
+		m.actionDuration,
+		m.handlerErrors,
+		m.webhookDeliveries,
+		m.httpRequests,
+		m.httpDuration,
+	)
+	return m
+}
+
+func (m *Metrics) Registry() *prometheus.Registry {
+	if m == nil {
+		return nil
+	}
+	return m.registry
+}
+
+// Handler serves the registry in the prometheus exposition format.
+func (m *Metrics) Handler() http.Handler {
+	if m == nil {
+		return promhttp.Handler()
+	}
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+}
+
+func (m *Metrics) SessionStarted(process string) {
+	if m == nil {
+		return
+	}
+	m.sessionsStarted.WithLabelValues(process).Inc()
+}
+
+func (m *Metrics) SessionRejected(process string) {
+	if m == nil {
+		return
+	}
+	m.sessionsRejected.WithLabelValues(process).Inc()
+}
+
+func (m *Metrics) SessionFinished(process, status string) {
+	if m == nil {
+		return
+	}
+	if status == StatusFailed {
+		m.sessionsFailed.WithLabelValues(process).Inc()
+		return
+	}
+	m.sessionsCompleted.WithLabelValues(process).Inc()
+}
+
+func (m *Metrics) ActionExecuted(process, actionType string, duration time.Duration) {
+	if m == nil {
+		return
+	}
+	m.actionsExecuted.WithLabelValues(process, actionType).Inc()
+	m.actionDuration.WithLabelValues(process, actionType).Observe(duration.Seconds())
+}
+
+func (m *Metrics) HandlerError(process, actionType string) {
+	if m == nil {
+		return
+	}
+	m.handlerErrors.WithLabelValues(process, actionType).Inc()
+}
+
+func (m *Metrics) WebhookDelivered(result string) {
+	if m == nil {
+		return
+	}
+	m.webhookDeliveries.WithLabelValues(result).Inc()
+}
+
+// GinMiddleware records request count and latency labeled by the matched route template.
+func (m *Metrics) GinMiddleware() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		if m == nil {
+			ctx.Next()
+			return
+		}
+		start := time.Now()
+		ctx.Next()
+		route := ctx.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		method := ctx.Request.Method
+		m.httpRequests.WithLabelValues(method, route, strconv.Itoa(ctx.Writer.Status())).Inc()
+		m.httpDuration.WithLabelValues(method, route).Observe(time.Since(start).Seconds())
+	}
+}
+
+var (
+	activeSessionsDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(metricsNamespace, "", "sessions_active"),
+		"Number of sessions currently running or waiting for a task.",
+		[]string{"process"}, nil,
+	)
+	openTasksDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(metricsNamespace, "", "tasks_open"),
+		"Number of generated tasks that are not completed yet.",
+		[]string{"process"}, nil,
+	)
+)
+
+// sessionsCollector derives session and task gauges from the parser state on every scrape.
+type sessionsCollector struct {
+	parser *Parser
+}
+
+func (c sessionsCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- activeSessionsDesc
+	ch <- openTasksDesc
+}
+
+func (c sessionsCollector) Collect(ch chan<- prometheus.Metric) {
+	active := map[string]int{}
+	openTasks := map[string]int{}
+	for _, activeSession := range c.parser.Sessions() {
+		key := activeSession.ProcessKey()
+		if status := activeSession.Status(); status == StatusRunning || status == StatusWaiting {
+			active[key]++
+		}
+		for _, activeTask := range activeSession.Tasks() {
+			if TaskPending(activeTask) {
+				openTasks[key]++
+			}
+		}
+	}
+	for key, count := range active {
+		ch <- prometheus.MustNewConstMetric(activeSessionsDesc, prometheus.GaugeValue, float64(count), key)
+	}
+	for key, count := range openTasks {
+		ch <- prometheus.MustNewConstMetric(openTasksDesc, prometheus.GaugeValue, float64(count), key)
+	}
+}
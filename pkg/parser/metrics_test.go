@@ -0,0 +1,86 @@
+package parser
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestParser_MetricsRecordsSessionAndActions(t *testing.T) {
+	parser := NewParser()
+	parser.SetKey("metrics_test")
+	parser.SetActions(map[string]*Action{
+		StartNode: {
+			ActionType: StartNode,
+			OnSuccess:  "test_id_1",
+		},
+		"test_id_1": {
+			ActionType: IsGreater,
+			Args: map[string]interface{}{
+				comparingKey: 10,
+				compareToKey: 11,
+			},
+			OnSuccess: "test_id_2",
+			OnFailure: "test_id_2",
+		},
+		"test_id_2": {
+			ActionType: "unknown",
+			OnSuccess:  "test_id_3",
+			OnFailure:  "test_id_3",
+		},
+	})
+	session := NewSession(map[string]interface{}{}, nil)
+	session.SetProcessKey(parser.Key())
+	parser.metrics.SessionStarted(session.ProcessKey())
+	parser.runActionById(context.Background(), "test_id_1", session)
+
+	if session.Status() != StatusFailed {
+		t.Errorf("expected session status %s, got %s", StatusFailed, session.Status())
+	}
+	if v := testutil.ToFloat64(parser.metrics.sessionsStarted.WithLabelValues("metrics_test")); v != 1 {
+		t.Errorf("expected 1 started session, got %v", v)
+	}
+	if v := testutil.ToFloat64(parser.metrics.sessionsFailed.WithLabelValues("metrics_test")); v != 1 {
+		t.Errorf("expected 1 failed session, got %v", v)
+	}
+	if v := testutil.ToFloat64(parser.metrics.actionsExecuted.WithLabelValues("metrics_test", IsGreater)); v != 1 {
+		t.Errorf("expected 1 executed %s action, got %v", IsGreater, v)
+	}
+	if v := testutil.ToFloat64(parser.metrics.handlerErrors.WithLabelValues("metrics_test", "unknown")); v != 1 {
+		t.Errorf("expected 1 handler error for unknown action, got %v", v)
+	}
+	if v := testutil.ToFloat64(parser.metrics.webhookDeliveries.WithLabelValues(WebhookResultSkipped)); v != 1 {
+		t.Errorf("expected 1 skipped webhook, got %v", v)
+	}
+}
+
+func TestMetrics_NilIsNoop(t *testing.T) {
+	var metrics *Metrics
+	metrics.SessionStarted("test")
+	metrics.SessionFinished("test", StatusCompleted)
+	metrics.HandlerError("test", IsGreater)
+	metrics.WebhookDelivered(WebhookResultSkipped)
+}
+
+func TestBuildHttp_ServesMetrics(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	BuildHttp(router, "test.json")
+
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/api/sessions", nil))
+	recorder = httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", recorder.Code)
+	}
+	body := recorder.Body.String()
+	if !strings.Contains(body, `process_manager_http_requests_total{method="GET",route="/api/sessions",status="200"} 1`) {
+		t.Errorf("http request metric missing from\n%s", body)
+	}
+}
@@ -1,13 +1,14 @@
 package parser
 
 import (
+	"context"
 	"encoding/json"
 	"github.com/AkronimBlack/process-manager/shared"
 	"github.com/google/uuid"
 	"github.com/tidwall/gjson"
-	"log"
 	"strconv"
 	"sync"
+	"time"
 )
 
 func (a Args) GetString(key string, defaultValue ...string) string {
@@ -61,15 +62,54 @@ func (a Args) GetMap(key string, defaultValue ...map[string]interface{}) map[str
 }
 
 type Action struct {
+	// ID is the key of the action in the process definition, set when actions are loaded.
+	ID         string `json:"-"`
 	ActionType string `json:"type"`
 	Args       Args   `json:"args"`
 	OnSuccess  string `json:"on_success"`
 	OnFailure  string `json:"on_failure"`
+	// OnSignal maps signals to the action a session waiting at this action continues at. On the start_node it
+	// applies wherever the session waits.
+	OnSignal map[string]string `json:"on_signal,omitempty"`
+	// CompensateWith is the action undoing this action once it completed, see CompensateHandler.
+	CompensateWith string `json:"compensate_with,omitempty"`
+	// OnError is the action a session continues at when a handler panics or continues at an id the definition
+	// does not know. Only read from the start_node.
+	OnError string `json:"on_error,omitempty"`
+}
+
+// transitions are the action ids the handler of the action may continue at, defined or not.
+func (a *Action) transitions() []string {
+	return append([]string{a.OnSuccess, a.OnFailure, a.Args.GetString(edgeNext), a.Args.GetString(edgeOnTimeout)}, a.branches()...)
 }
 
 type executedAction struct {
 	Action
 	Params map[string]interface{}
+	failed bool
+}
+
+// failable is implemented by executed actions that record a failed execution.
+type failable interface {
+	markFailed()
+}
+
+func (e *executedAction) markFailed() {
+	e.failed = true
+}
+
+// Failed reports if the execution took on_failure.
+func (e executedAction) Failed() bool {
+	return e.failed
+}
+
+// NewExecutedAction records the execution of an action with the parameters it was resolved with.
+func NewExecutedAction(action Action, params map[string]interface{}) ExecutedAction {
+	return &executedAction{Action: action, Params: params}
+}
+
+func (e executedAction) ID() string {
+	return e.Action.ID
 }
 
 func (e executedAction) Type() string {
@@ -104,14 +144,27 @@ func (w webHook) Url() string {
 	return w.url
 }
 
+// hasWebhook reports if the webhook is set and has a url, start requests without a webhook carry an empty one.
+func hasWebhook(webhook Webhook) bool {
+	return webhook != nil && webhook.Url() != ""
+}
+
 type session struct {
 	uuid                    string
+	processKey              string
+	status                  string
 	values                  map[string]interface{}
 	executedActions         []ExecutedAction
 	inputData               map[string]interface{}
 	tasks                   []Task
 	onFinishWebhook         Webhook
 	onFinishWebhookResponse map[string]interface{}
+	errors                  []ActionError
+	started                 time.Time
+	limits                  Limits
+	steps                   int
+	currentAction           string
+	finished                time.Time
 
 	lock sync.Mutex
 }
@@ -136,6 +189,26 @@ func (s *session) Uuid() string {
 	return s.uuid
 }
 
+func (s *session) ProcessKey() string {
+	return s.processKey
+}
+
+func (s *session) SetProcessKey(processKey string) {
+	s.processKey = processKey
+}
+
+func (s *session) Status() string {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.status
+}
+
+func (s *session) SetStatus(status string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.status = status
+}
+
 func (s *session) Values() map[string]interface{} {
 	return s.values
 }
@@ -156,27 +229,102 @@ func (s *session) OnFinishWebhookResponse() map[string]interface{} {
 	return s.onFinishWebhookResponse
 }
 
+// UpdateData merges parameters into the input data of the session.
 func (s *session) UpdateData(parameters map[string]interface{}) {
-	if s.InputData() == nil {
-		s.SetInputData(parameters)
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.inputData == nil {
+		s.inputData = parameters
 		return
 	}
-	for k, v := range s.InputData() {
-		s.Set(k, v)
+	for k, v := range parameters {
+		s.inputData[k] = v
 	}
 }
 
 func NewSession(data map[string]interface{}, webhook Webhook) Session {
 	return &session{
 		uuid:            uuid.NewString(),
+		status:          StatusRunning,
 		values:          make(map[string]interface{}),
 		executedActions: make([]ExecutedAction, 0),
 		tasks:           make([]Task, 0),
 		onFinishWebhook: webhook,
 		inputData:       data,
+		started:         time.Now(),
 	}
 }
 
+// CurrentAction is the action the session executes or waits at, or executed last once it finished.
+func (s *session) CurrentAction() string {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.currentAction
+}
+
+func (s *session) SetCurrentAction(actionId string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.currentAction = actionId
+}
+
+// Finished is when the session completed or failed, zero while it did not finish.
+func (s *session) Finished() time.Time {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.finished
+}
+
+func (s *session) SetFinished(finished time.Time) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.finished = finished
+}
+
+func (s *session) Started() time.Time {
+	return s.started
+}
+
+func (s *session) Limits() Limits {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.limits
+}
+
+func (s *session) SetLimits(limits Limits) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.limits = limits
+}
+
+// Steps counts the actions the session executed, including actions that raised an error.
+func (s *session) Steps() int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.steps
+}
+
+// AddStep counts an action and returns the new number of steps.
+func (s *session) AddStep() int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.steps++
+	return s.steps
+}
+
+// Errors are the errors handlers reported, raised or panicked with, oldest first.
+func (s *session) Errors() []ActionError {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return append([]ActionError{}, s.errors...)
+}
+
+func (s *session) AddError(actionError ActionError) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.errors = append(s.errors, actionError)
+}
+
 func (s *session) AddTask(task Task) {
 	s.lock.Lock()
 	defer s.lock.Unlock()
@@ -206,7 +354,6 @@ func (s *session) StringValueOf(key string, defaultValue string) string {
 }
 
 func (s *session) IntValueOf(key string, defaultValue int64) int64 {
-	log.Println(shared.ToJsonPrettyString(NewSessionDto(s)))
 	value := gjson.Get(shared.ToJsonString(NewSessionDto(s)), key)
 	if value.Exists() {
 		return value.Int()
@@ -221,10 +368,22 @@ func (s *session) PlaceholderOrStringValue(value string) string {
 	return value
 }
 
-func (s *session) Task(id string) Task {
-	for _, activeTasks := range s.Tasks() {
-		if activeTasks.ID() == id {
-			return activeTasks
+// Task looks up a task by its id, or else the latest task with the business key or definition key.
+func (s *session) Task(idOrKey string) Task {
+	tasks := s.Tasks()
+	for _, activeTask := range tasks {
+		if activeTask.ID() == idOrKey {
+			return activeTask
+		}
+	}
+	for i := len(tasks) - 1; i >= 0; i-- {
+		if tasks[i].BusinessKey() == idOrKey {
+			return tasks[i]
+		}
+	}
+	for i := len(tasks) - 1; i >= 0; i-- {
+		if tasks[i].DefinitionKey() == idOrKey {
+			return tasks[i]
 		}
 	}
 	return nil
@@ -250,38 +409,398 @@ func (s *session) Set(key string, value interface{}) {
 	s.values[key] = value
 }
 
+const (
+	TaskStatusOpen      = "open"
+	TaskStatusClaimed   = "claimed"
+	TaskStatusCompleted = "completed"
+	TaskStatusCancelled = "cancelled"
+)
+
+// TaskAssignment declares who may work on a task. A task without assignee and candidates is open to anyone.
+type TaskAssignment struct {
+	Assignee        string   `json:"assignee"`
+	CandidateUsers  []string `json:"candidate_users"`
+	CandidateGroups []string `json:"candidate_groups"`
+}
+
+// TaskUser is the user working on a task, an empty ID is an anonymous user.
+type TaskUser struct {
+	ID     string
+	Groups []string
+}
+
+type taskUserKey struct{}
+
+// ContextWithTaskUser stores the user completing a task.
+func ContextWithTaskUser(ctx context.Context, user TaskUser) context.Context {
+	return context.WithValue(ctx, taskUserKey{}, user)
+}
+
+// TaskUserFromContext returns the stored user or an anonymous one.
+func TaskUserFromContext(ctx context.Context) TaskUser {
+	user, _ := ctx.Value(taskUserKey{}).(TaskUser)
+	return user
+}
+
+// FormError is returned when a task payload does not match the form of the task.
+type FormError struct {
+	Errors ValidationErrors
+}
+
+func (e *FormError) Error() string {
+	return "payload does not match the task form"
+}
+
 type task struct {
-	id         string
-	name       string
-	next       string
-	parameters map[string]interface{}
-	session    Session
+	id            string
+	definitionKey string
+	actionId      string
+	businessKey   string
+	name          string
+	next          string
+	parameters    map[string]interface{}
+	session       Session
+	status        string
+	assignment    TaskAssignment
+	form          JsonSchema
+	created       time.Time
+	deadline      TaskDeadline
+
+	lock sync.Mutex
+}
+
+// TaskDeadline escalates a task that is not completed by its due time.
+type TaskDeadline struct {
+	Due time.Time
+	// Reminders are sent while the task is pending, to ReminderWebhook or the webhook of the session when it has no
+	// url. Sessions without a webhook skip them.
+	Reminders       []time.Time
+	ReminderWebhook Webhook
+	// OnTimeout is the action the session continues at once the task expired and was cancelled.
+	OnTimeout string
+	// EscalateTo reassigns the expired task instead of cancelling it, the session keeps waiting for it.
+	EscalateTo *TaskAssignment
+	// Result is the session value the expiry is recorded under.
+	Result string
+}
+
+// TaskOptions configure who may work on a task and what it expects.
+type TaskOptions struct {
+	// DefinitionKey is the id of the task in the process definition, the task id by default.
+	DefinitionKey string
+	// ActionId is the action that created the task, completing the task only continues a session waiting there.
+	ActionId string
+	// BusinessKey identifies the task for clients, e.g. the id of the approved document.
+	BusinessKey string
+	Assignment  TaskAssignment
+	// Form is a json schema the completion payload must match.
+	Form JsonSchema
+	// Created is the creation time, now when zero.
+	Created time.Time
+	// Deadline applies when its due time is set.
+	Deadline TaskDeadline
 }
 
 func NewTask(id, name, next string, parameters map[string]interface{}, session Session) Task {
-	return &task{id: id, name: name, next: next, parameters: parameters, session: session}
+	return NewTaskWithOptions(id, name, next, parameters, TaskOptions{}, session)
+}
+
+// NewTaskWithOptions creates a task restricted to the assignment of the options. A task with an assignee starts
+// claimed by it. Completing the task continues the session waiting for it at next, a task with an empty next only
+// merges its payload into the input data.
+func NewTaskWithOptions(id, name, next string, parameters map[string]interface{}, options TaskOptions, session Session) Task {
+	status := TaskStatusOpen
+	if options.Assignment.Assignee != "" {
+		status = TaskStatusClaimed
+	}
+	if options.Created.IsZero() {
+		options.Created = time.Now()
+	}
+	if options.DefinitionKey == "" {
+		options.DefinitionKey = id
+	}
+	return &task{
+		id:            id,
+		definitionKey: options.DefinitionKey,
+		actionId:      options.ActionId,
+		businessKey:   options.BusinessKey,
+		name:          name,
+		next:          next,
+		parameters:    parameters,
+		session:       session,
+		status:        status,
+		assignment:    options.Assignment,
+		form:          options.Form,
+		created:       options.Created,
+		deadline:      options.Deadline,
+	}
 }
 
-func (t task) ID() string {
+func (t *task) ID() string {
 	return t.id
 }
 
-func (t task) Name() string {
+func (t *task) DefinitionKey() string {
+	return t.definitionKey
+}
+
+func (t *task) BusinessKey() string {
+	return t.businessKey
+}
+
+func (t *task) Name() string {
 	return t.name
 }
 
-func (t task) Next() string {
+func (t *task) Next() string {
 	return t.next
 }
 
-func (t task) Parameters() map[string]interface{} {
+func (t *task) Parameters() map[string]interface{} {
 	return t.parameters
 }
 
-func (t task) Execute(parameters map[string]interface{}) {
+func (t *task) Created() time.Time {
+	return t.created
+}
+
+func (t *task) Form() JsonSchema {
+	return t.form
+}
+
+func (t *task) ActionId() string {
+	return t.actionId
+}
+
+func (t *task) Deadline() TaskDeadline {
+	return t.deadline
+}
+
+func (t *task) Status() string {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	return t.status
+}
+
+func (t *task) Assignment() TaskAssignment {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	return t.assignment
+}
+
+// Execute completes the task without any checks.
+func (t *task) Execute(parameters map[string]interface{}) {
+	t.Session().UpdateData(parameters)
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.status = TaskStatusCompleted
+}
+
+// Complete completes the task for user once the payload matches the form. A claimed task can only be completed
+// by its assignee, an open one by its candidates.
+func (t *task) Complete(user TaskUser, parameters map[string]interface{}) error {
+	t.lock.Lock()
+	err := t.active()
+	if err == nil && t.status == TaskStatusClaimed && t.assignment.Assignee != user.ID {
+		err = ErrNotAssignee
+	}
+	if err == nil && t.status == TaskStatusOpen && !t.isCandidate(user) {
+		err = ErrNotCandidate
+	}
+	if err == nil {
+		if formErrors := ValidateForm(t.form, parameters); !formErrors.IsValid() {
+			err = &FormError{Errors: formErrors}
+		}
+	}
+	if err != nil {
+		t.lock.Unlock()
+		return err
+	}
+	t.status = TaskStatusCompleted
+	t.lock.Unlock()
 	t.Session().UpdateData(parameters)
+	return nil
 }
 
-func (t task) Session() Session {
+func (t *task) Claim(user TaskUser) error {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if err := t.active(); err != nil {
+		return err
+	}
+	if t.status == TaskStatusClaimed {
+		if t.assignment.Assignee == user.ID {
+			return nil
+		}
+		return ErrTaskClaimed
+	}
+	if user.ID == "" || !t.isCandidate(user) {
+		return ErrNotCandidate
+	}
+	t.status = TaskStatusClaimed
+	t.assignment.Assignee = user.ID
+	return nil
+}
+
+func (t *task) Unclaim(user TaskUser) error {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if err := t.active(); err != nil {
+		return err
+	}
+	if t.status != TaskStatusClaimed {
+		return ErrTaskNotClaimed
+	}
+	if t.assignment.Assignee != user.ID {
+		return ErrNotAssignee
+	}
+	t.status = TaskStatusOpen
+	t.assignment.Assignee = ""
+	return nil
+}
+
+// Delegate hands a claimed task over to assignee, only its current assignee may delegate it. Open tasks are
+// claimed first, candidates can not hand them to users outside the assignment.
+func (t *task) Delegate(user TaskUser, assignee string) error {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if err := t.active(); err != nil {
+		return err
+	}
+	if t.status != TaskStatusClaimed {
+		return ErrTaskNotClaimed
+	}
+	if user.ID == "" || t.assignment.Assignee != user.ID {
+		return ErrNotAssignee
+	}
+	t.status = TaskStatusClaimed
+	t.assignment.Assignee = assignee
+	return nil
+}
+
+// Reassign replaces the assignment of a pending task, it is claimed when the assignment has an assignee.
+func (t *task) Reassign(assignment TaskAssignment) error {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if err := t.active(); err != nil {
+		return err
+	}
+	t.status = TaskStatusOpen
+	if assignment.Assignee != "" {
+		t.status = TaskStatusClaimed
+	}
+	t.assignment = assignment
+	return nil
+}
+
+// Cancel cancels the task unless it is already completed.
+func (t *task) Cancel() {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if t.active() == nil {
+		t.status = TaskStatusCancelled
+	}
+}
+
+func (t *task) Completed() bool {
+	return t.Status() == TaskStatusCompleted
+}
+
+// active returns an error when the task is completed or cancelled. The caller must hold the task lock.
+func (t *task) active() error {
+	switch t.status {
+	case TaskStatusCompleted:
+		return ErrTaskCompleted
+	case TaskStatusCancelled:
+		return ErrTaskCancelled
+	}
+	return nil
+}
+
+// isCandidate reports if user may work on the task. The caller must hold the task lock.
+func (t *task) isCandidate(user TaskUser) bool {
+	assignment := t.assignment
+	if assignment.Assignee == "" && len(assignment.CandidateUsers) == 0 && len(assignment.CandidateGroups) == 0 {
+		return true
+	}
+	if user.ID == "" {
+		return false
+	}
+	if user.ID == assignment.Assignee {
+		return true
+	}
+	for _, candidate := range assignment.CandidateUsers {
+		if candidate == user.ID {
+			return true
+		}
+	}
+	for _, group := range user.Groups {
+		for _, candidate := range assignment.CandidateGroups {
+			if candidate == group {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// TaskOwner returns a user allowed to complete the task, for running definitions without real users.
+func TaskOwner(task Task) TaskUser {
+	assignment := task.Assignment()
+	switch {
+	case assignment.Assignee != "":
+		return TaskUser{ID: assignment.Assignee}
+	case len(assignment.CandidateUsers) != 0:
+		return TaskUser{ID: assignment.CandidateUsers[0]}
+	case len(assignment.CandidateGroups) != 0:
+		return TaskUser{ID: "owner", Groups: assignment.CandidateGroups}
+	}
+	return TaskUser{}
+}
+
+// TaskPending reports if a task is still open or claimed.
+func TaskPending(task Task) bool {
+	status := task.Status()
+	return status == TaskStatusOpen || status == TaskStatusClaimed
+}
+
+func (t *task) Session() Session {
 	return t.session
 }
+
+// TaskCompletions holds task payloads keyed by task id, business key, definition key or task name.
+type TaskCompletions map[string]map[string]interface{}
+
+// For returns the payload for a task, looked up by id, business key, definition key and name in that order.
+func (c TaskCompletions) For(task Task) (map[string]interface{}, bool) {
+	for _, key := range []string{task.ID(), task.BusinessKey(), task.DefinitionKey(), task.Name()} {
+		if payload, ok := c[key]; ok && key != "" {
+			return payload, true
+		}
+	}
+	return nil, false
+}
+
+// TaskMatches reports if key is the id, business key, definition key or name of the task.
+func TaskMatches(task Task, key string) bool {
+	return key != "" && (task.ID() == key || task.BusinessKey() == key || task.DefinitionKey() == key || task.Name() == key)
+}
+
+// FirstOpenTask returns the first pending task the session waits for, tasks without a wait are skipped.
+func FirstOpenTask(session Session) Task {
+	for _, activeTask := range session.Tasks() {
+		if TaskPending(activeTask) && activeTask.Next() != "" {
+			return activeTask
+		}
+	}
+	return nil
+}
+
+// VisitedActions returns the ids of the executed actions in execution order.
+func VisitedActions(session Session) []string {
+	visited := make([]string, 0, len(session.ExecutedActions()))
+	for _, action := range session.ExecutedActions() {
+		visited = append(visited, action.ID())
+	}
+	return visited
+}
@@ -1,6 +1,8 @@
 package parser
 
 import (
+	"encoding/json"
+	"errors"
 	"github.com/AkronimBlack/process-manager/shared"
 	"reflect"
 	"testing"
@@ -77,3 +79,86 @@ func TestArgs_Bind(t *testing.T) {
 	}
 	t.Log(shared.ToJsonPrettyString(v))
 }
+
+func TestTask_Lifecycle(t *testing.T) {
+	alice := TaskUser{ID: "alice"}
+	bob := TaskUser{ID: "bob", Groups: []string{"managers"}}
+	mallory := TaskUser{ID: "mallory"}
+	task := NewTaskWithOptions("approve", "approve", "end", nil, TaskOptions{Assignment: TaskAssignment{
+		CandidateUsers:  []string{"alice"},
+		CandidateGroups: []string{"managers"},
+	}}, NewSession(nil, nil))
+
+	if err := task.Claim(mallory); err != ErrNotCandidate {
+		t.Errorf("expected %v claiming as non candidate, got %v", ErrNotCandidate, err)
+	}
+	if err := task.Complete(TaskUser{}, nil); err != ErrNotCandidate {
+		t.Errorf("expected %v completing anonymously, got %v", ErrNotCandidate, err)
+	}
+	if err := task.Delegate(alice, "mallory"); err != ErrTaskNotClaimed || task.Assignment().Assignee != "" {
+		t.Errorf("expected %v delegating an open task, got %s %v", ErrTaskNotClaimed, task.Assignment().Assignee, err)
+	}
+	if err := task.Claim(alice); err != nil || task.Status() != TaskStatusClaimed || task.Assignment().Assignee != "alice" {
+		t.Fatalf("expected task claimed by alice, got %s %s %v", task.Status(), task.Assignment().Assignee, err)
+	}
+	if err := task.Claim(bob); err != ErrTaskClaimed {
+		t.Errorf("expected %v claiming a claimed task, got %v", ErrTaskClaimed, err)
+	}
+	if err := task.Unclaim(bob); err != ErrNotAssignee {
+		t.Errorf("expected %v unclaiming as other user, got %v", ErrNotAssignee, err)
+	}
+	if err := task.Delegate(bob, "mallory"); err != ErrNotAssignee {
+		t.Errorf("expected %v delegating as candidate, got %v", ErrNotAssignee, err)
+	}
+	if err := task.Delegate(alice, "bob"); err != nil || task.Assignment().Assignee != "bob" {
+		t.Fatalf("expected task delegated to bob, got %s %v", task.Assignment().Assignee, err)
+	}
+	if err := task.Complete(alice, nil); err != ErrNotAssignee {
+		t.Errorf("expected %v completing a delegated task, got %v", ErrNotAssignee, err)
+	}
+	if err := task.Complete(bob, map[string]interface{}{"approved": true}); err != nil || task.Status() != TaskStatusCompleted {
+		t.Fatalf("expected task completed by bob, got %s %v", task.Status(), err)
+	}
+	if err := task.Complete(bob, nil); err != ErrTaskCompleted {
+		t.Errorf("expected %v completing twice, got %v", ErrTaskCompleted, err)
+	}
+	task.Cancel()
+	if task.Status() != TaskStatusCompleted {
+		t.Errorf("expected completed task to stay completed, got %s", task.Status())
+	}
+}
+
+func TestTask_CompleteValidatesForm(t *testing.T) {
+	var form JsonSchema
+	err := json.Unmarshal([]byte(`{
+		"required": ["approved", "amount"],
+		"properties": {
+			"approved": {"type": "boolean"},
+			"amount": {"type": "integer", "minimum": 1},
+			"reason": {"type": "string", "enum": ["risk", "budget"]}
+		},
+		"additionalProperties": false
+	}`), &form)
+	if err != nil {
+		t.Fatal(err)
+	}
+	task := NewTaskWithOptions("approve", "approve", "end", nil, TaskOptions{Form: form}, NewSession(nil, nil))
+
+	err = task.Complete(TaskUser{}, map[string]interface{}{"approved": "yes", "amount": 0.5, "reason": "mood", "note": "-"})
+	var formError *FormError
+	if !errors.As(err, &formError) {
+		t.Fatalf("expected form error, got %v", err)
+	}
+	for _, field := range []string{"approved", "amount", "reason", "note"} {
+		if _, ok := formError.Errors[field]; !ok {
+			t.Errorf("expected error for %s, got %v", field, formError.Errors)
+		}
+	}
+	if task.Status() != TaskStatusOpen {
+		t.Errorf("expected task to stay open, got %s", task.Status())
+	}
+	err = task.Complete(TaskUser{}, map[string]interface{}{"approved": true, "amount": 5, "reason": "risk"})
+	if err != nil {
+		t.Errorf("expected valid payload to complete the task, got %v", err)
+	}
+}
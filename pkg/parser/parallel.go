@@ -0,0 +1,100 @@
+package parser
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+const (
+	// ParallelAction forks the session into branches that meet at the join action in on_success.
+	ParallelAction = "parallel"
+	// JoinAction continues once every branch of the fork reached it.
+	JoinAction = "join"
+
+	// pendingBranchesValue holds the branches a fork has not started yet, keyed by the id of its join.
+	pendingBranchesValue = "parallel.pending"
+	branchesKey          = "branches"
+	edgeBranch           = "branch"
+)
+
+var ErrBranchesRequired = errors.New("branches are required")
+
+type ParallelArgs struct {
+	ResultArgs
+	Branches []string `json:"branches"`
+}
+
+// branches are the actions a parallel action forks into, empty for other actions.
+func (a *Action) branches() []string {
+	if a.ActionType != ParallelAction {
+		return nil
+	}
+	parallelArgs := ParallelArgs{}
+	_ = a.Args.Bind(&parallelArgs)
+	return parallelArgs.Branches
+}
+
+// ParallelHandler starts the first branch, the join in on_success starts the next one whenever a branch reaches
+// it and continues at its own on_success after the last. Branches run one after another on the session, a branch
+// that waits holds back the ones after it.
+func (p *Parser) ParallelHandler(ctx context.Context, action *Action, session Session) string {
+	parallelArgs := ParallelArgs{}
+	err := action.Args.Bind(&parallelArgs)
+	if err == nil && len(parallelArgs.Branches) == 0 {
+		err = ErrBranchesRequired
+	}
+	if err != nil {
+		AddActionError(session, parallelArgs.ResultVariableAsError(action.ActionType), err)
+		session.AddExecutedAction(NewExecutedAction(*action, map[string]interface{}{branchesKey: parallelArgs.Branches}))
+		return action.OnFailure
+	}
+	setPendingBranches(session, action.OnSuccess, parallelArgs.Branches[1:])
+	session.AddExecutedAction(NewExecutedAction(*action, map[string]interface{}{branchesKey: parallelArgs.Branches}))
+	return parallelArgs.Branches[0]
+}
+
+// JoinHandler starts the next pending branch of the fork, once none is left it continues at on_success.
+func (p *Parser) JoinHandler(ctx context.Context, action *Action, session Session) string {
+	pending := pendingBranches(session)[action.ID]
+	next := action.OnSuccess
+	if len(pending) != 0 {
+		next = pending[0]
+		setPendingBranches(session, action.ID, pending[1:])
+	} else {
+		setPendingBranches(session, action.ID, nil)
+	}
+	session.AddExecutedAction(NewExecutedAction(*action, map[string]interface{}{"next": next}))
+	return next
+}
+
+// pendingBranches reads the pending branches of every open fork, values restored from json hold []interface{}.
+func pendingBranches(session Session) map[string][]string {
+	pending := map[string][]string{}
+	stored, _ := session.Values()[pendingBranchesValue].(map[string]interface{})
+	for join, branches := range stored {
+		switch branches := branches.(type) {
+		case []string:
+			pending[join] = branches
+		case []interface{}:
+			for _, branch := range branches {
+				pending[join] = append(pending[join], fmt.Sprint(branch))
+			}
+		}
+	}
+	return pending
+}
+
+// setPendingBranches replaces the pending branches of the fork joining at join, nil closes the fork.
+func setPendingBranches(session Session, join string, branches []string) {
+	stored := map[string]interface{}{}
+	for id, pending := range pendingBranches(session) {
+		stored[id] = pending
+	}
+	if branches == nil {
+		delete(stored, join)
+	} else {
+		stored[join] = branches
+	}
+	session.Set(pendingBranchesValue, stored)
+}
@@ -0,0 +1,61 @@
+package parser
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func fulfillmentParser() *Parser {
+	parser := NewParser()
+	parser.AddHandler("reserve_stock", func(ctx context.Context, action *Action, session Session) string {
+		session.Set("reserved", true)
+		return action.OnSuccess
+	})
+	parser.SetActions(Actions{
+		StartNode: {ActionType: StartNode, OnSuccess: "fork"},
+		"fork":    {ActionType: ParallelAction, Args: Args{branchesKey: []string{"approve", "reserve"}}, OnSuccess: "join", OnFailure: "end"},
+		"approve": {ActionType: TaskAction, Args: Args{"id": "approve", "name": "approve", "wait": true}, OnSuccess: "join", OnFailure: "end"},
+		"reserve": {ActionType: "reserve_stock", OnSuccess: "join", OnFailure: "end"},
+		"join":    {ActionType: JoinAction, OnSuccess: "ship", OnFailure: "end"},
+		"ship":    {ActionType: "reserve_stock", OnSuccess: "end", OnFailure: "end"},
+	})
+	return parser
+}
+
+func TestParser_ParallelBranchesJoin(t *testing.T) {
+	parser := fulfillmentParser()
+	session := parser.Run(context.Background(), map[string]interface{}{}, nil)
+	if session.Status() != StatusWaiting || session.Values()["reserved"] != nil {
+		t.Fatalf("expected the first branch waiting for its task, got %s %v", session.Status(), session.Values())
+	}
+	if err := parser.RunTask(context.Background(), session.Task("approve"), map[string]interface{}{}); err != nil {
+		t.Fatal(err)
+	}
+	if session.Status() != StatusCompleted || session.Values()["reserved"] != true {
+		t.Fatalf("expected the session completed after both branches, got %s %v", session.Status(), session.Values())
+	}
+	executed := make([]string, 0)
+	for _, action := range session.ExecutedActions() {
+		executed = append(executed, action.ID())
+	}
+	expected := []string{"fork", "approve", "join", "join"}
+	if !reflect.DeepEqual(expected, executed) {
+		t.Errorf("expected %v executed, got %v", expected, executed)
+	}
+	if pending := pendingBranches(session); len(pending) != 0 {
+		t.Errorf("expected the fork closed, got %v", pending)
+	}
+}
+
+func TestParser_ValidateParallel(t *testing.T) {
+	parser := NewParser()
+	errors := parser.validate(Actions{
+		StartNode: {ActionType: StartNode, OnSuccess: "fork"},
+		"fork":    {ActionType: ParallelAction, Args: Args{branchesKey: []string{"missing"}}, OnSuccess: "ship", OnFailure: "end"},
+		"ship":    {ActionType: HttpAction, OnSuccess: "end", OnFailure: "end"},
+	})
+	if len(errors["fork"][branchesKey]) != 1 || len(errors["fork"]["on_success"]) != 1 {
+		t.Errorf("expected the undefined branch and the missing join reported, got %v", errors)
+	}
+}
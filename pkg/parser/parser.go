@@ -3,87 +3,222 @@ package parser
 import (
 	"bytes"
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/AkronimBlack/process-manager/shared"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
+	"go.opentelemetry.io/otel/trace"
 	"io"
+	"log/slog"
 	"net/http"
 	"os"
 	"path"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
 const (
-	StartNode = "start_node"
+	StartNode         = "start_node"
+	DefaultProcessKey = "default"
+
+	StatusRunning   = "running"
+	StatusWaiting   = "waiting"
+	StatusCompleted = "completed"
+	StatusFailed    = "failed"
+	// StatusQueued sessions wait for a worker of the pool, see SetWorkerPool.
+	StatusQueued = "queued"
+	// StatusDeleted sessions were removed from the parser while they waited, see DeleteSession.
+	StatusDeleted = "deleted"
+)
+
+var (
+	ErrTaskCompleted  = errors.New("task is already completed")
+	ErrTaskCancelled  = errors.New("task is cancelled")
+	ErrTaskClaimed    = errors.New("task is claimed by another user")
+	ErrTaskNotClaimed = errors.New("task is not claimed")
+	ErrNotCandidate   = errors.New("user is not a candidate of the task")
+	ErrNotAssignee    = errors.New("user is not the assignee of the task")
+	ErrSessionRunning = errors.New("session is not waiting for a task")
+	ErrUnknownAction  = errors.New("handler continued at an unknown action")
+	ErrNoHandler      = errors.New("no handler registered for action type")
 )
 
+// errorValue is the session value a raised error is stored under.
+const errorValue = "error"
+
 type Actions map[string]*Action
 
+// setIds copies the definition keys onto the actions.
+func (a Actions) setIds() {
+	for id, action := range a {
+		if action != nil {
+			action.ID = id
+		}
+	}
+}
+
 type Parser struct {
-	handlers map[string]Handler
-	actions  Actions
-	sessions []Session
+	key         string
+	handlers    map[string]Handler
+	argsSchemas map[string]JsonSchema
+	actions     Actions
+	sessions    []Session
+	// sessionIndex holds the sessions by uuid, sessionPosition is the position of the last registered one.
+	sessionIndex    map[string]indexedSession
+	sessionPosition uint64
+	tasks           *TaskIndex
+	metrics         *Metrics
+	tracer          trace.Tracer
+	logger          *slog.Logger
+	clock           Clock
+	limits          Limits
+	pool            *WorkerPool
+	// rateLimiters are replaced on every change so actions can read them without the lock.
+	rateLimiters map[string]*RateLimiter
+	store        SessionStore
+	archive      SessionArchive
+	// retention holds the retention policies by process key.
+	retention map[string]RetentionPolicy
+	// stopping is set by Shutdown, running counts the sessions executing actions.
+	stopping atomic.Bool
+	running  atomic.Int64
+	// stopped is closed by Shutdown, ExecuteSync stops waiting for sessions then.
+	stopped chan struct{}
+	// failedWebhooks are the finished sessions whose webhook was not delivered.
+	failedWebhooks []Session
+	// suspended holds the waiting sessions by uuid so the trace continues once they resume.
+	suspended map[string]suspension
+	// pendingWakes holds wake ups that arrived before the waiting session was suspended.
+	pendingWakes map[string]pendingWake
+	// interruptions are the signals interrupting running sessions by uuid.
+	interruptions map[string]pendingSignal
+	// subscriptions are the sessions waiting for a message, signalWaits those waiting for a signal.
+	subscriptions []subscription
+	signalWaits   []subscription
+	// calledProcesses are the parsers call_activity actions start sessions on, keyed by process key.
+	calledProcesses map[string]*Parser
+	// holdDeadlines leaves expired tasks to the caller instead of scheduling their deadlines.
+	holdDeadlines bool
 
 	lock sync.Mutex
 }
 
 func NewParser() *Parser {
-	return &Parser{
-		handlers: map[string]Handler{
-			IsGreater:  IsGreaterHandler,
-			IsLower:    IsLowerHandler,
-			IsEqual:    IsEqualHandler,
-			HttpAction: HttpHandler,
-			TaskAction: TaskHandler,
-		},
+	p := &Parser{
 		sessions: make([]Session, 0),
+		tasks:    NewTaskIndex(),
+		metrics:  NewMetrics(prometheus.NewRegistry()),
 	}
+	p.handlers = map[string]Handler{
+		IsGreater:            IsGreaterHandler,
+		IsLower:              IsLowerHandler,
+		IsEqual:              IsEqualHandler,
+		HttpAction:           HttpHandler,
+		TaskAction:           TaskHandler,
+		TimerAction:          p.TimerHandler,
+		ReceiveMessageAction: p.ReceiveMessageHandler,
+		WaitSignalAction:     p.WaitSignalHandler,
+		CompensateAction:     p.CompensateHandler,
+		ParallelAction:       p.ParallelHandler,
+		JoinAction:           p.JoinHandler,
+		CallActivityAction:   p.CallActivityHandler,
+	}
+	p.metrics.Registry().MustRegister(sessionsCollector{parser: p})
+	return p
 }
 
-func (p *Parser) runWebhook(session Session) {
-	if session.OnFinishWebhook() == nil {
-		session.OnFinishWebhookResponse()
+func (p *Parser) runWebhook(ctx context.Context, session Session) {
+	if !hasWebhook(session.OnFinishWebhook()) {
+		p.metrics.WebhookDelivered(WebhookResultSkipped)
 		return
 	}
-	req, err := http.NewRequest(http.MethodPost, session.OnFinishWebhook().Url(), bytes.NewBuffer(shared.ToJsonByte(session)))
+	response, deliveryResult := p.postWebhook(ctx, session, session.OnFinishWebhook().Url(), NewSessionDto(session))
+	session.SetOnFinishWebhookResponse(response)
+	p.metrics.WebhookDelivered(deliveryResult)
+	if deliveryResult != WebhookResultSuccess {
+		p.failWebhook(session)
+	}
+}
+
+// postWebhook posts the json payload to url and returns a summary of the response and the delivery result.
+func (p *Parser) postWebhook(ctx context.Context, session Session, url string, payload interface{}) (map[string]interface{}, string) {
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewBuffer(shared.ToJsonByte(payload)))
 	if err != nil {
-		session.SetOnFinishWebhookResponse(map[string]interface{}{
+		return map[string]interface{}{
 			"error": err.Error(),
-		})
-		return
+		}, WebhookResultError
 	}
+	req.Header.Set("Content-Type", "application/json")
 	client := &http.Client{}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	ctx, span := p.Tracer().Start(ctx, "webhook", trace.WithSpanKind(trace.SpanKindClient))
+	defer span.End()
+	ctx, cancel := context.WithTimeout(ctx, 500*time.Millisecond)
 	defer cancel()
+	Propagator.Inject(ctx, propagation.HeaderCarrier(req.Header))
 	resp, err := client.Do(req.WithContext(ctx))
 	if err != nil {
-		session.SetOnFinishWebhookResponse(map[string]interface{}{
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		p.sessionLogger(session).Warn("webhook delivery failed", slog.String("error", err.Error()))
+		return map[string]interface{}{
 			"error": err.Error(),
-		})
-		return
+		}, WebhookResultError
 	}
+	span.SetAttributes(semconv.HTTPStatusCode(resp.StatusCode))
 
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		session.SetOnFinishWebhookResponse(map[string]interface{}{
+		return map[string]interface{}{
 			"status":      resp.Status,
 			"status_code": resp.StatusCode,
 			"error":       err.Error(),
-		})
-		return
+		}, WebhookResultError
 	}
-	session.SetOnFinishWebhookResponse(map[string]interface{}{
+	response := map[string]interface{}{
 		"status":      resp.Status,
 		"status_code": resp.StatusCode,
 		"response":    string(body),
-	})
+	}
+	if resp.StatusCode >= http.StatusBadRequest {
+		p.sessionLogger(session).Warn("webhook rejected", slog.Int("status_code", resp.StatusCode))
+		return response, WebhookResultFailure
+	}
+	return response, WebhookResultSuccess
+}
+
+// Key identifies the loaded process definition. Defaults to the name of the loaded file.
+func (p *Parser) Key() string {
+	if p.key == "" {
+		return DefaultProcessKey
+	}
+	return p.key
+}
+
+func (p *Parser) SetKey(key string) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.key = key
+}
+
+// TaskIndex indexes the tasks of all sessions, nil for parsers not created by NewParser.
+func (p *Parser) TaskIndex() *TaskIndex {
+	return p.tasks
+}
+
+func (p *Parser) Metrics() *Metrics {
+	return p.metrics
 }
 
 func (p *Parser) SetActions(actions Actions) {
 	p.lock.Lock()
 	defer p.lock.Unlock()
+	actions.setIds()
 	p.actions = actions
 }
 
@@ -108,36 +243,39 @@ func (p *Parser) ActionHandler(action string) Handler {
 	return v
 }
 
+// LoadFile loads a json or yaml definition, see ParseDefinition.
 func (p *Parser) LoadFile(location string) error {
-	if path.Ext(location) != ".json" {
-		return fmt.Errorf("%s is not a json file", location)
+	format, err := DefinitionFormat(location)
+	if err != nil {
+		return err
 	}
 	file, err := os.ReadFile(location)
 	if err != nil {
 		return err
 	}
-	var actions Actions
-	err = json.Unmarshal(file, &actions)
+	actions, err := ParseDefinition(file, format)
 	if err != nil {
 		return err
 	}
 	p.lock.Lock()
 	defer p.lock.Unlock()
 	p.actions = actions
+	if p.key == "" {
+		p.key = strings.TrimSuffix(path.Base(location), path.Ext(location))
+	}
 	return nil
 }
 
 func (p *Parser) Sessions() []Session {
+	p.lock.Lock()
+	defer p.lock.Unlock()
 	return p.sessions
 }
 
 func (p *Parser) Session(id string) Session {
-	for _, activeSession := range p.Sessions() {
-		if activeSession.Uuid() == id {
-			return activeSession
-		}
-	}
-	return nil
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	return p.sessionIndex[id].session
 }
 
 type ValidateErrors map[string]ValidationErrors
@@ -157,10 +295,30 @@ func (p *Parser) validate(actions Actions) ValidateErrors {
 	errors := make(ValidateErrors)
 	var hasStartNode bool
 	for id, action := range actions {
+		if action == nil {
+			errors[id] = ValidationErrors{"type": []string{"action is empty"}}
+			continue
+		}
 		if action.ActionType == StartNode {
 			hasStartNode = true
 		}
 		actionErrors := p.ValidateAction(action)
+		for field, reference := range map[string]string{"compensate_with": action.CompensateWith, "on_error": action.OnError} {
+			if _, ok := actions[reference]; reference != "" && !ok {
+				actionErrors.Add(field, []string{fmt.Sprintf("%s %s is not a defined action", field, reference)})
+			}
+		}
+		if compensation := actions[action.CompensateWith]; compensation != nil && compensation.waits() {
+			actionErrors.Add("compensate_with", []string{fmt.Sprintf("compensate_with %s waits, compensating actions must not wait", action.CompensateWith)})
+		}
+		for _, branch := range action.branches() {
+			if _, ok := actions[branch]; !ok {
+				actionErrors.Add(branchesKey, []string{fmt.Sprintf("branch %s is not a defined action", branch)})
+			}
+		}
+		if join := actions[action.OnSuccess]; action.ActionType == ParallelAction && (join == nil || join.ActionType != JoinAction) {
+			actionErrors.Add("on_success", []string{fmt.Sprintf("on_success %s is not a join action", action.OnSuccess)})
+		}
 		if !actionErrors.IsValid() {
 			errors[id] = actionErrors
 		}
@@ -201,6 +359,11 @@ func (e ValidationErrors) IsValid() bool {
 
 func (p *Parser) ValidateAction(action *Action) ValidationErrors {
 	errors := make(ValidationErrors, 0)
+	for signal, next := range action.OnSignal {
+		if next == "" {
+			errors.Add("on_signal", []string{fmt.Sprintf("on_signal %s needs an action id", signal)})
+		}
+	}
 	if action.ActionType == StartNode {
 		if action.OnSuccess == "" {
 			errors.Add("on_success", []string{"on_success is a required field"})
@@ -220,34 +383,363 @@ func (p *Parser) ValidateAction(action *Action) ValidationErrors {
 	return errors
 }
 
+// Execute starts a session in the background like Enqueue, it returns an empty uuid when it was rejected.
 func (p *Parser) Execute(ctx context.Context, data map[string]interface{}, webhook Webhook) string {
-	newSession := NewSession(data, webhook)
-	p.sessions = append(p.Sessions(), newSession)
-	startAction := p.actions[StartNode]
-	firstAction := p.actions[startAction.OnSuccess]
-	go p.runAction(ctx, firstAction, newSession)
+	newSession, err := p.Enqueue(ctx, data, webhook)
+	if err != nil {
+		return ""
+	}
 	return newSession.Uuid()
 }
 
-func (p *Parser) runAction(ctx context.Context, action *Action, session Session) {
+// ExecuteSync starts a session and waits up to timeout for it to finish or reach its first wait state.
+// The returned bool is false when the timeout elapsed first, the session then keeps running in the background.
+// Sessions queued by the worker pool count towards the timeout, ErrQueueFull is returned when the queue is full.
+// Waiting ends like a timeout once Shutdown was called.
+func (p *Parser) ExecuteSync(ctx context.Context, data map[string]interface{}, webhook Webhook, timeout time.Duration) (Session, bool, error) {
+	newSession, done, err := p.enqueue(ctx, data, webhook)
+	if err != nil {
+		return nil, false, err
+	}
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case <-done:
+		return newSession, true, nil
+	case <-timer.C:
+		return newSession, false, nil
+	case <-p.stoppedChannel():
+		return newSession, false, nil
+	case <-ctx.Done():
+		return newSession, false, nil
+	}
+}
+
+// Run executes the process on the calling goroutine. It returns once the session finished or waits for a task.
+func (p *Parser) Run(ctx context.Context, data map[string]interface{}, webhook Webhook) Session {
+	ctx, newSession := p.startSession(ctx, data, webhook)
+	startAction := p.actions[StartNode]
+	p.runActionById(ctx, startAction.OnSuccess, newSession)
+	return newSession
+}
+
+// CompleteTask completes the task with the given payload and continues the process in the background, on the
+// worker pool when the parser has one.
+// The task is completed for the user stored with ContextWithTaskUser, see Task.Complete.
+func (p *Parser) CompleteTask(ctx context.Context, task Task, payload map[string]interface{}) error {
+	if err := p.completeTask(ctx, task, payload); err != nil {
+		return err
+	}
+	if task.Next() != "" {
+		p.wakeQueued(task.Session(), task.ActionId(), task.Next(), runInBackground)
+	}
+	return nil
+}
+
+// RunTask completes the task with the given payload and continues the process on the calling goroutine
+// until the session finished or waits for another task.
+func (p *Parser) RunTask(ctx context.Context, task Task, payload map[string]interface{}) error {
+	if err := p.completeTask(ctx, task, payload); err != nil {
+		return err
+	}
+	if task.Next() != "" {
+		p.wake(task.Session(), task.ActionId(), task.Next())
+	}
+	return nil
+}
+
+// completeTask completes the task, the caller wakes the session. A task completed before its session is suspended
+// wakes it once it is, like a timer that fires early.
+func (p *Parser) completeTask(ctx context.Context, task Task, payload map[string]interface{}) error {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	session := task.Session()
+	if task.Next() != "" && session.Status() != StatusWaiting && TaskPending(task) {
+		return ErrSessionRunning
+	}
+	err := task.Complete(TaskUserFromContext(ctx), payload)
+	if err != nil {
+		return err
+	}
+	p.sessionLogger(session).Info("task completed, resuming session", slog.String("task_id", task.ID()))
+	return nil
+}
+
+// suspension is a waiting session and the action it waits at.
+type suspension struct {
+	ctx      context.Context
+	session  Session
+	actionId string
+}
+
+type pendingWake struct {
+	from string
+	next string
+}
+
+// resume marks a waiting session as running and returns the context it was suspended with.
+// The caller must hold the parser lock.
+func (p *Parser) resume(ctx context.Context, session Session) context.Context {
+	session.SetStatus(StatusRunning)
+	if suspended, ok := p.suspended[session.Uuid()]; ok {
+		delete(p.suspended, session.Uuid())
+		return suspended.ctx
+	}
+	return ctx
+}
+
+// wake continues a session waiting at the action from at actionId on the calling goroutine, an empty from wakes
+// the session wherever it waits. A wake up arriving before the session is suspended is deferred until it is.
+func (p *Parser) wake(session Session, from, actionId string) {
+	if ctx, ok := p.takeWake(session, from, actionId); ok {
+		p.runActionById(ctx, actionId, session)
+	}
+}
+
+// wakeQueued wakes the session like wake and continues it on the worker pool, see resumeQueued.
+func (p *Parser) wakeQueued(session Session, from, actionId string, run func(func())) {
+	if ctx, ok := p.takeWake(session, from, actionId); ok {
+		p.resumeQueued(ctx, session, actionId, run)
+	}
+}
+
+// takeWake resumes the session suspended at from and returns the context it continues with, false when it does
+// not wait there or the wake up was deferred.
+func (p *Parser) takeWake(session Session, from, actionId string) (context.Context, bool) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if session.Status() != StatusWaiting {
+		return nil, false
+	}
+	suspended, ok := p.suspended[session.Uuid()]
+	if !ok {
+		if p.pendingWakes == nil {
+			p.pendingWakes = make(map[string]pendingWake)
+		}
+		p.pendingWakes[session.Uuid()] = pendingWake{from: from, next: actionId}
+		return nil, false
+	}
+	if from != "" && suspended.actionId != from {
+		return nil, false
+	}
+	return p.resume(context.Background(), session), true
+}
+
+// suspend parks the waiting session at the action. A wake up that arrived before is returned as the action the
+// session continues at instead.
+func (p *Parser) suspend(ctx context.Context, session Session, actionId string) (string, bool) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if next, ok := p.interruption(session); ok {
+		delete(p.pendingWakes, session.Uuid())
+		session.SetStatus(StatusRunning)
+		return next, true
+	}
+	if wake, ok := p.pendingWakes[session.Uuid()]; ok {
+		delete(p.pendingWakes, session.Uuid())
+		if wake.from == "" || wake.from == actionId {
+			session.SetStatus(StatusRunning)
+			return wake.next, true
+		}
+	}
+	if p.suspended == nil {
+		p.suspended = make(map[string]suspension)
+	}
+	p.suspended[session.Uuid()] = suspension{ctx: ctx, session: session, actionId: actionId}
+	session.SetCurrentAction(actionId)
+	return "", false
+}
+
+// startSession registers a new session and returns a context carrying its trace span.
+// The span is ended when the session finishes.
+func (p *Parser) startSession(ctx context.Context, data map[string]interface{}, webhook Webhook) (context.Context, Session) {
+	newSession := NewSession(data, webhook)
+	p.registerSession(ctx, newSession)
+	return p.startSessionSpan(ctx, newSession), newSession
+}
+
+// registerSession adds a new session with the limits of the context or else the parser.
+func (p *Parser) registerSession(ctx context.Context, newSession Session) {
+	newSession.SetProcessKey(p.Key())
+	limits, ok := LimitsFromContext(ctx)
+	if !ok {
+		limits = p.Limits()
+	}
+	newSession.SetLimits(limits)
+	p.indexSession(newSession)
+	p.metrics.SessionStarted(newSession.ProcessKey())
+	p.sessionLogger(newSession).Info("session started", slog.Any("input_data", newSession.InputData()), slog.String("status", newSession.Status()))
+}
+
+// indexSession adds the session to the sessions of the parser.
+func (p *Parser) indexSession(newSession Session) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.sessions = append(p.sessions, newSession)
+	if p.sessionIndex == nil {
+		p.sessionIndex = map[string]indexedSession{}
+	}
+	p.sessionPosition++
+	p.sessionIndex[newSession.Uuid()] = indexedSession{session: newSession, position: p.sessionPosition}
+}
+
+// runAction executes the action and returns the action the session continues at, false once it finished or waits.
+func (p *Parser) runAction(ctx context.Context, actionId string, action *Action, session Session) (string, bool) {
+	logger := p.sessionLogger(session).With(
+		slog.String("action_id", actionId),
+		slog.String("action_type", action.ActionType),
+	)
 	handler := p.ActionHandler(action.ActionType)
 	if handler == nil {
-		p.runWebhook(session)
-		return
+		logger.Error("no handler registered for action type")
+		p.metrics.HandlerError(session.ProcessKey(), action.ActionType)
+		trace.SpanFromContext(ctx).SetStatus(codes.Error, fmt.Sprintf("no handler for action type %s", action.ActionType))
+		err := Fatal(fmt.Errorf("%w %s", ErrNoHandler, action.ActionType))
+		p.addError(session, actionId, action.ActionType, err)
+		return p.raiseError(ctx, session, actionId, err)
+	}
+	actionCtx, span := p.startActionSpan(ctx, actionId, action, session)
+	actionCtx = ContextWithClock(ContextWithLogger(actionCtx, logger), p.Clock())
+	actionCtx = ContextWithRateLimiters(actionCtx, p.RateLimiters())
+	logger.Debug("executing action", slog.Any("args", map[string]interface{}(action.Args)))
+	created, executed := len(session.Tasks()), len(session.ExecutedActions())
+	start := time.Now()
+	next, err := callHandler(actionCtx, handler, action, session)
+	duration := time.Since(start)
+	p.tasks.sync(session)
+	for _, newTask := range session.Tasks()[created:] {
+		p.scheduleDeadline(newTask)
+	}
+	p.metrics.ActionExecuted(session.ProcessKey(), action.ActionType, duration)
+	if !IsFatal(err) && next != "" && p.actions[next] == nil && !p.isTerminal(next) {
+		err = Fatal(fmt.Errorf("%w %s", ErrUnknownAction, next))
+	}
+	if IsFatal(err) {
+		logger.Error("action raised an error", slog.String("error", err.Error()))
+		p.metrics.HandlerError(session.ProcessKey(), action.ActionType)
+		p.addError(session, actionId, action.ActionType, err)
+		span.SetStatus(codes.Error, err.Error())
+		span.End()
+		markFailed(session.ExecutedActions()[executed:])
+		return p.raiseError(ctx, session, actionId, err)
+	}
+	if err != nil {
+		logger.Warn("action reported an error", slog.String("error", err.Error()), slog.String("next", next), slog.Duration("duration", duration))
+		p.metrics.HandlerError(session.ProcessKey(), action.ActionType)
+		p.addError(session, actionId, action.ActionType, err)
+		span.SetStatus(codes.Error, err.Error())
+		markFailed(session.ExecutedActions()[executed:])
+	} else if next == action.OnFailure && next != action.OnSuccess {
+		logger.Warn("action failed", slog.String("next", next), slog.Duration("duration", duration))
+		p.metrics.HandlerError(session.ProcessKey(), action.ActionType)
+		span.SetStatus(codes.Error, "action took on_failure")
+		markFailed(session.ExecutedActions()[executed:])
+	} else {
+		logger.Debug("action executed", slog.String("next", next), slog.Duration("duration", duration))
+	}
+	span.End()
+	if session.Status() == StatusWaiting {
+		logger.Info("session waiting")
+		return p.suspend(ctx, session, actionId)
 	}
-	next := handler(ctx, action, session)
 	if next == "" {
-		p.runWebhook(session)
-		return
+		p.finish(ctx, session, StatusCompleted)
+		return "", false
+	}
+	return next, true
+}
+
+// raiseError continues the session at the on_error action of the start_node, or fails it when the definition has
+// none or the on_error action raised the error itself.
+func (p *Parser) raiseError(ctx context.Context, session Session, actionId string, err error) (string, bool) {
+	session.Set(errorValue, map[string]interface{}{"action_id": actionId, "error": err.Error()})
+	onError := ""
+	if startAction := p.actions[StartNode]; startAction != nil {
+		onError = startAction.OnError
+	}
+	if onError == "" || onError == actionId {
+		p.finish(ctx, session, StatusFailed)
+		return "", false
+	}
+	p.sessionLogger(session).Warn("continuing at on_error", slog.String("action_id", actionId), slog.String("on_error", onError))
+	return onError, true
+}
+
+func markFailed(executedActions []ExecutedAction) {
+	for _, executed := range executedActions {
+		if failedAction, ok := executed.(failable); ok {
+			failedAction.markFailed()
+		}
 	}
-	p.runActionById(ctx, next, session)
 }
 
+// isTerminal reports if an action of the definition transitions to the undefined id, reaching it ends the session.
+func (p *Parser) isTerminal(id string) bool {
+	for _, action := range p.actions {
+		if action == nil {
+			continue
+		}
+		for _, transition := range action.transitions() {
+			if transition == id {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// runActionById runs the session from the action on the calling goroutine until it finishes or waits. Every
+// executed action counts as a step of the session, see Limits.
 func (p *Parser) runActionById(ctx context.Context, actionId string, session Session) {
-	action := p.actions[actionId]
-	if action == nil {
-		p.runWebhook(session)
-		return
+	p.running.Add(1)
+	defer p.running.Add(-1)
+	for {
+		if next, ok := p.takeInterruption(session); ok {
+			actionId = next
+		}
+		action := p.actions[actionId]
+		if action == nil {
+			p.sessionLogger(session).Debug("action not found, finishing session", slog.String("action_id", actionId))
+			p.finish(ctx, session, StatusCompleted)
+			return
+		}
+		session.SetCurrentAction(actionId)
+		if p.ShuttingDown() {
+			p.sessionLogger(session).Info("session stopped for shutdown", slog.String("action_id", actionId))
+			return
+		}
+		if err := session.Limits().check(session.AddStep(), session.Started()); err != nil {
+			p.exceedLimit(ctx, session, actionId, action.ActionType, err)
+			return
+		}
+		next, proceed := p.runAction(ctx, actionId, action, session)
+		if !proceed {
+			return
+		}
+		actionId = next
 	}
-	p.runAction(ctx, action, session)
+}
+
+// cancelWaitingTasks cancels the tasks the session waits for, tasks without a wait stay open.
+func cancelWaitingTasks(session Session) {
+	for _, pendingTask := range session.Tasks() {
+		if pendingTask.Next() != "" {
+			pendingTask.Cancel()
+		}
+	}
+}
+
+func (p *Parser) finish(ctx context.Context, session Session, status string) {
+	cancelWaitingTasks(session)
+	p.lock.Lock()
+	p.unsubscribe(session)
+	delete(p.interruptions, session.Uuid())
+	p.lock.Unlock()
+	session.SetStatus(status)
+	session.SetFinished(p.Clock().Now())
+	p.sessionLogger(session).Info("session finished", slog.String("status", status))
+	p.metrics.SessionFinished(session.ProcessKey(), status)
+	p.runWebhook(ctx, session)
+	trace.SpanFromContext(ctx).End()
+	returnToCaller(ctx, session)
 }
@@ -3,6 +3,8 @@ package parser
 import (
 	"context"
 	"github.com/AkronimBlack/process-manager/shared"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"sync/atomic"
 	"testing"
 )
 
@@ -237,3 +239,129 @@ func TestParser_Execute(t *testing.T) {
 		return
 	}
 }
+
+func TestParser_RunWaitsForTaskAndResumes(t *testing.T) {
+	parser := NewParser()
+	parser.SetActions(map[string]*Action{
+		StartNode: {
+			ActionType: StartNode,
+			OnSuccess:  "test_id_1",
+		},
+		"test_id_1": {
+			ActionType: TaskAction,
+			Args: map[string]interface{}{
+				"id":   "task_1",
+				"name": "approve",
+				"wait": true,
+			},
+			OnSuccess: "test_id_2",
+			OnFailure: "test_id_2",
+		},
+		"test_id_2": {
+			ActionType: IsGreater,
+			Args: map[string]interface{}{
+				comparingKey: "{{input_data.amount}}",
+				compareToKey: "10",
+				result:       "test_result",
+			},
+			OnSuccess: "end",
+			OnFailure: "end",
+		},
+	})
+	session := parser.Run(context.Background(), map[string]interface{}{}, nil)
+	if session.Status() != StatusWaiting {
+		t.Fatalf("expected session to wait for task, got status %s", session.Status())
+	}
+	task := session.Task("task_1")
+	if task == nil {
+		t.Fatal("task not generated")
+	}
+	err := parser.RunTask(context.Background(), task, map[string]interface{}{"amount": 20})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if session.Status() != StatusCompleted {
+		t.Errorf("expected completed session, got %s", session.Status())
+	}
+	if session.ValueOf("test_result") != true {
+		t.Errorf("task payload not available to following actions, values %s", shared.ToJsonString(session.Values()))
+	}
+	if err = parser.RunTask(context.Background(), task, nil); err != ErrTaskCompleted {
+		t.Errorf("expected %v completing a task twice, got %v", ErrTaskCompleted, err)
+	}
+}
+
+func TestParser_TaskWithoutWaitContinues(t *testing.T) {
+	parser := NewParser()
+	parser.SetActions(Actions{
+		StartNode: {ActionType: StartNode, OnSuccess: "approve"},
+		"approve": {
+			ActionType: TaskAction,
+			Args:       Args{"id": "approve", "name": "approve", "due_in": "1h"},
+			OnSuccess:  "check",
+			OnFailure:  "end",
+		},
+		"check": {
+			ActionType: IsGreater,
+			Args:       Args{comparingKey: "{{input_data.amount}}", compareToKey: "10", result: "big"},
+			OnSuccess:  "end",
+			OnFailure:  "end",
+		},
+	})
+	session := parser.Run(context.Background(), map[string]interface{}{"amount": 5, "currency": "eur"}, nil)
+	if session.Status() != StatusCompleted || session.ValueOf("big") != false {
+		t.Fatalf("expected the session to continue past the task, got %s %v", session.Status(), session.Values())
+	}
+	task := session.Task("approve")
+	if task == nil || !TaskPending(task) {
+		t.Fatal("expected the task to stay open once the session finished")
+	}
+	parser.expireTask(task)
+	if task.Status() != TaskStatusCancelled || session.Status() != StatusCompleted {
+		t.Errorf("expected the expired task cancelled without resuming the session, got %s %s", task.Status(), session.Status())
+	}
+
+	session = parser.Run(context.Background(), map[string]interface{}{"amount": 5, "currency": "eur"}, nil)
+	task = session.Task("approve")
+	if err := parser.RunTask(context.Background(), task, map[string]interface{}{"amount": 20}); err != nil {
+		t.Fatal(err)
+	}
+	if executed := len(session.ExecutedActions()); executed != 2 {
+		t.Errorf("expected completing the task not to resume the session, got %d executed actions", executed)
+	}
+	// the payload is merged into the input data, existing keys are overwritten
+	if input := session.InputData(); input["amount"] != 20 || input["currency"] != "eur" {
+		t.Errorf("expected the payload merged into the input data, got %v", input)
+	}
+}
+
+func TestParser_TaskCompletedBeforeSuspendResumesOnce(t *testing.T) {
+	parser := NewParser()
+	parser.SetKey("early")
+	var afterRuns int32
+	// the task is completed by its own handler, before the session is suspended
+	parser.AddHandler("early_task", func(ctx context.Context, action *Action, session Session) string {
+		next := TaskHandler(ctx, action, session)
+		if err := parser.RunTask(ctx, session.Task("approve"), nil); err != nil {
+			t.Error(err)
+		}
+		return next
+	})
+	parser.AddHandler("after", func(ctx context.Context, action *Action, session Session) string {
+		atomic.AddInt32(&afterRuns, 1)
+		return action.OnSuccess
+	})
+	parser.SetActions(Actions{
+		StartNode: {ActionType: StartNode, OnSuccess: "approve"},
+		"approve": {ActionType: "early_task", Args: Args{"id": "approve", "name": "approve", "wait": true}, OnSuccess: "after", OnFailure: "end"},
+		"after":   {ActionType: "after", OnSuccess: "end", OnFailure: "end"},
+	})
+
+	session := parser.Run(context.Background(), map[string]interface{}{}, nil)
+	if session.Status() != StatusCompleted || afterRuns != 1 {
+		t.Errorf("expected the session completed after running after once, got %s and %d runs", session.Status(), afterRuns)
+	}
+	if finished := testutil.ToFloat64(parser.metrics.sessionsCompleted.WithLabelValues("early")); finished != 1 {
+		t.Errorf("expected the session finished once, got %v", finished)
+	}
+}
@@ -0,0 +1,96 @@
+package parsertest
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/AkronimBlack/process-manager/pkg/parser"
+)
+
+// FakeClock is a parser.Clock that only moves when advanced. Due timers fire on the goroutine calling Advance.
+type FakeClock struct {
+	now    time.Time
+	timers []*fakeTimer
+
+	lock sync.Mutex
+}
+
+func NewFakeClock(now time.Time) *FakeClock {
+	return &FakeClock{now: now}
+}
+
+func (c *FakeClock) Now() time.Time {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.now
+}
+
+func (c *FakeClock) AfterFunc(d time.Duration, f func()) parser.Timer {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	timer := &fakeTimer{clock: c, at: c.now.Add(d), f: f}
+	c.timers = append(c.timers, timer)
+	return timer
+}
+
+// Advance moves the clock forward and fires every timer that became due, earliest first.
+func (c *FakeClock) Advance(d time.Duration) {
+	c.lock.Lock()
+	target := c.now.Add(d)
+	c.lock.Unlock()
+	for {
+		timer := c.nextDue(target)
+		if timer == nil {
+			break
+		}
+		timer.f()
+	}
+	c.lock.Lock()
+	c.now = target
+	c.lock.Unlock()
+}
+
+// Pending returns the number of timers that did not fire yet.
+func (c *FakeClock) Pending() int {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return len(c.timers)
+}
+
+func (c *FakeClock) nextDue(target time.Time) *fakeTimer {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	sort.SliceStable(c.timers, func(i, j int) bool {
+		return c.timers[i].at.Before(c.timers[j].at)
+	})
+	if len(c.timers) == 0 || c.timers[0].at.After(target) {
+		return nil
+	}
+	timer := c.timers[0]
+	c.timers = c.timers[1:]
+	c.now = timer.at
+	return timer
+}
+
+func (c *FakeClock) stop(timer *fakeTimer) bool {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	for i, t := range c.timers {
+		if t == timer {
+			c.timers = append(c.timers[:i], c.timers[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+type fakeTimer struct {
+	clock *FakeClock
+	at    time.Time
+	f     func()
+}
+
+func (t *fakeTimer) Stop() bool {
+	return t.clock.stop(t)
+}
@@ -0,0 +1,64 @@
+package parsertest
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+
+	"github.com/AkronimBlack/process-manager/shared"
+)
+
+// Diff compares two values by their json representation and returns a line diff, empty when they are equal.
+func Diff(expected, actual interface{}) string {
+	expected = normalize(expected)
+	actual = normalize(actual)
+	if reflect.DeepEqual(expected, actual) {
+		return ""
+	}
+	return lineDiff(
+		strings.Split(shared.ToJsonPrettyString(expected), "\n"),
+		strings.Split(shared.ToJsonPrettyString(actual), "\n"),
+	)
+}
+
+func normalize(value interface{}) interface{} {
+	var normalized interface{}
+	_ = json.Unmarshal(shared.ToJsonByte(value), &normalized)
+	return normalized
+}
+
+// lineDiff renders the longest common subsequence of both sides, prefixing removed lines with - and added with +.
+func lineDiff(a, b []string) string {
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+	var out strings.Builder
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			out.WriteString("  " + a[i] + "\n")
+			i++
+			j++
+		case j < len(b) && (i == len(a) || lcs[i][j+1] >= lcs[i+1][j]):
+			out.WriteString("+ " + b[j] + "\n")
+			j++
+		default:
+			out.WriteString("- " + a[i] + "\n")
+			i++
+		}
+	}
+	return out.String()
+}
@@ -0,0 +1,232 @@
+// Package parsertest runs process definitions synchronously in go tests.
+//
+//	h := parsertest.Load(t, "approval.json").
+//		Stub(parser.HttpAction, parsertest.Succeed(map[string]interface{}{"score": 80}))
+//	h.Start(map[string]interface{}{"amount": 50}).
+//		CompleteTask("approve", map[string]interface{}{"approved": true}).
+//		Advance(24 * time.Hour).
+//		AssertStatus(parser.StatusCompleted).
+//		AssertVisited("fetch_score", "approve", "wait", "notify").
+//		AssertWebhookValue("values.score", 80)
+package parsertest
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/AkronimBlack/process-manager/pkg/parser"
+	"github.com/AkronimBlack/process-manager/shared"
+	"github.com/tidwall/gjson"
+)
+
+// Epoch is the time the fake clock of a harness starts at.
+var Epoch = time.Date(2023, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+// Harness wraps a parser with a fake clock, a test logger and a webhook recorder.
+type Harness struct {
+	t       testing.TB
+	Parser  *parser.Parser
+	Clock   *FakeClock
+	webhook *webhookRecorder
+}
+
+// New builds a harness for the given actions.
+func New(t testing.TB, actions parser.Actions) *Harness {
+	t.Helper()
+	p := parser.NewParser()
+	p.SetActions(actions)
+	return newHarness(t, p)
+}
+
+// Load builds a harness for a process definition file.
+func Load(t testing.TB, location string) *Harness {
+	t.Helper()
+	p := parser.NewParser()
+	err := p.LoadFile(location)
+	if err != nil {
+		t.Fatalf("loading %s: %s", location, err)
+	}
+	return newHarness(t, p)
+}
+
+func newHarness(t testing.TB, p *parser.Parser) *Harness {
+	clock := NewFakeClock(Epoch)
+	p.SetClock(clock)
+	p.SetLogger(slog.New(slog.NewTextHandler(testWriter{t: t}, &slog.HandlerOptions{Level: slog.LevelDebug})))
+	recorder := newWebhookRecorder()
+	t.Cleanup(recorder.server.Close)
+	return &Harness{t: t, Parser: p, Clock: clock, webhook: recorder}
+}
+
+// Stub replaces the handler of an action type.
+func (h *Harness) Stub(actionType string, handler parser.Handler) *Harness {
+	h.Parser.AddHandler(actionType, handler)
+	return h
+}
+
+// AssertValid fails the test when the definition does not pass validation.
+func (h *Harness) AssertValid() *Harness {
+	h.t.Helper()
+	validationErrors := h.Parser.Validate()
+	if !validationErrors.IsValid() {
+		h.t.Errorf("invalid definition\n%s", shared.ToJsonPrettyString(validationErrors))
+	}
+	return h
+}
+
+// Start runs a new session until it finishes or waits for a task or timer.
+func (h *Harness) Start(data map[string]interface{}) *Run {
+	h.t.Helper()
+	if data == nil {
+		data = map[string]interface{}{}
+	}
+	session := h.Parser.Run(context.Background(), data, parser.NewWebHook(h.webhook.server.URL))
+	return &Run{t: h.t, h: h, Session: session}
+}
+
+// Webhooks returns the payloads of all finish webhooks sent so far.
+func (h *Harness) Webhooks() []map[string]interface{} {
+	return h.webhook.payloads()
+}
+
+// Run is a session started by the harness.
+type Run struct {
+	t       testing.TB
+	h       *Harness
+	Session parser.Session
+}
+
+// CompleteTask completes the open task with the given id, business key, definition key or name as its assignee or
+// a candidate and runs the session until it stops again.
+func (r *Run) CompleteTask(idOrName string, payload map[string]interface{}) *Run {
+	r.t.Helper()
+	var task parser.Task
+	open := make([]string, 0)
+	for _, candidate := range r.Session.Tasks() {
+		if !parser.TaskPending(candidate) {
+			continue
+		}
+		open = append(open, candidate.DefinitionKey()+" ("+candidate.Name()+")")
+		if task == nil && parser.TaskMatches(candidate, idOrName) {
+			task = candidate
+		}
+	}
+	if task == nil {
+		r.t.Fatalf("no open task %s, open tasks: [%s]", idOrName, strings.Join(open, ", "))
+	}
+	if payload == nil {
+		payload = map[string]interface{}{}
+	}
+	ctx := parser.ContextWithTaskUser(context.Background(), parser.TaskOwner(task))
+	err := r.h.Parser.RunTask(ctx, task, payload)
+	if err != nil {
+		r.t.Fatalf("completing task %s: %s", idOrName, err)
+	}
+	return r
+}
+
+// Advance moves the fake clock forward, sessions waiting on due timers continue before it returns.
+func (r *Run) Advance(d time.Duration) *Run {
+	r.h.Clock.Advance(d)
+	return r
+}
+
+func (r *Run) AssertStatus(status string) *Run {
+	r.t.Helper()
+	if r.Session.Status() != status {
+		r.t.Errorf("expected session status %s, got %s\nexecuted path: %s",
+			status, r.Session.Status(), strings.Join(parser.VisitedActions(r.Session), " -> "))
+	}
+	return r
+}
+
+// AssertVisited checks the exact sequence of executed action ids.
+func (r *Run) AssertVisited(ids ...string) *Run {
+	r.t.Helper()
+	visited := parser.VisitedActions(r.Session)
+	if diff := Diff(ids, visited); diff != "" {
+		r.t.Errorf("visited actions differ (-expected +actual)\n%s", diff)
+	}
+	return r
+}
+
+// AssertValue checks a session value, key is a gjson path into the session values.
+func (r *Run) AssertValue(key string, expected interface{}) *Run {
+	r.t.Helper()
+	if diff := Diff(expected, r.Session.ValueOf(key)); diff != "" {
+		r.t.Errorf("value %s differs (-expected +actual)\n%s", key, diff)
+	}
+	return r
+}
+
+// AssertValues checks every given session value.
+func (r *Run) AssertValues(expected map[string]interface{}) *Run {
+	r.t.Helper()
+	for key, value := range expected {
+		r.AssertValue(key, value)
+	}
+	return r
+}
+
+// AssertWebhookValue checks a value of the last finish webhook payload, path is a gjson path into the payload.
+func (r *Run) AssertWebhookValue(path string, expected interface{}) *Run {
+	r.t.Helper()
+	payloads := r.h.Webhooks()
+	if len(payloads) == 0 {
+		r.t.Errorf("no webhook sent, session status %s", r.Session.Status())
+		return r
+	}
+	actual := gjson.Get(shared.ToJsonString(payloads[len(payloads)-1]), path)
+	if !actual.Exists() {
+		r.t.Errorf("webhook payload has no %s\n%s", path, shared.ToJsonPrettyString(payloads[len(payloads)-1]))
+		return r
+	}
+	if diff := Diff(expected, actual.Value()); diff != "" {
+		r.t.Errorf("webhook value %s differs (-expected +actual)\n%s", path, diff)
+	}
+	return r
+}
+
+type webhookRecorder struct {
+	server   *httptest.Server
+	received []map[string]interface{}
+
+	lock sync.Mutex
+}
+
+func newWebhookRecorder() *webhookRecorder {
+	recorder := &webhookRecorder{}
+	recorder.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		payload := map[string]interface{}{}
+		_ = json.Unmarshal(body, &payload)
+		recorder.lock.Lock()
+		recorder.received = append(recorder.received, payload)
+		recorder.lock.Unlock()
+	}))
+	return recorder
+}
+
+func (w *webhookRecorder) payloads() []map[string]interface{} {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	return append([]map[string]interface{}{}, w.received...)
+}
+
+type testWriter struct {
+	t testing.TB
+}
+
+func (w testWriter) Write(p []byte) (int, error) {
+	w.t.Helper()
+	w.t.Log(strings.TrimRight(string(p), "\n"))
+	return len(p), nil
+}
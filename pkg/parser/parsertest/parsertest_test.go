@@ -0,0 +1,187 @@
+package parsertest
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/AkronimBlack/process-manager/pkg/parser"
+)
+
+func approvalActions() parser.Actions {
+	return parser.Actions{
+		parser.StartNode: {
+			ActionType: parser.StartNode,
+			OnSuccess:  "fetch_score",
+		},
+		"fetch_score": {
+			ActionType: parser.HttpAction,
+			Args:       map[string]interface{}{"url": "http://partner.invalid/score", "method": "get"},
+			OnSuccess:  "approve",
+			OnFailure:  "rejected",
+		},
+		"approve": {
+			ActionType: parser.TaskAction,
+			Args:       map[string]interface{}{"id": "approve_task", "name": "approve", "wait": true},
+			OnSuccess:  "cool_down",
+			OnFailure:  "rejected",
+		},
+		"cool_down": {
+			ActionType: parser.TimerAction,
+			Args:       map[string]interface{}{"duration": "{{input_data.cool_down}}"},
+			OnSuccess:  "check",
+			OnFailure:  "rejected",
+		},
+		"check": {
+			ActionType: parser.IsGreater,
+			Args: map[string]interface{}{
+				"comparing":  "{{input_data.amount}}",
+				"compare_to": "10",
+				"result":     "big",
+			},
+			OnSuccess: "end",
+			OnFailure: "end",
+		},
+		"rejected": {
+			ActionType: parser.IsEqual,
+			Args:       map[string]interface{}{"comparing": "1", "compare_to": "1"},
+			OnSuccess:  "end",
+			OnFailure:  "end",
+		},
+	}
+}
+
+func TestHarness_RunsSessionThroughTasksAndTimers(t *testing.T) {
+	h := New(t, approvalActions()).
+		AssertValid().
+		Stub(parser.HttpAction, Succeed(map[string]interface{}{"score": 80}))
+
+	run := h.Start(map[string]interface{}{"cool_down": "1h"}).
+		AssertStatus(parser.StatusWaiting).
+		CompleteTask("approve", map[string]interface{}{"amount": 50}).
+		AssertStatus(parser.StatusWaiting).
+		Advance(30 * time.Minute).
+		AssertStatus(parser.StatusWaiting).
+		Advance(30 * time.Minute)
+
+	run.AssertStatus(parser.StatusCompleted).
+		AssertVisited("fetch_score", "approve", "cool_down", "check").
+		AssertValues(map[string]interface{}{"big": true, "score": 80}).
+		AssertWebhookValue("status", parser.StatusCompleted).
+		AssertWebhookValue("values.score", 80)
+	if h.Clock.Pending() != 0 {
+		t.Errorf("expected no pending timers, got %d", h.Clock.Pending())
+	}
+}
+
+func TestHarness_StubFailureTakesOnFailure(t *testing.T) {
+	h := New(t, approvalActions()).Stub(parser.HttpAction, Fail(nil))
+	h.Start(nil).
+		AssertStatus(parser.StatusCompleted).
+		AssertVisited("fetch_score", "rejected")
+	if len(h.Webhooks()) != 1 {
+		t.Errorf("expected 1 webhook, got %d", len(h.Webhooks()))
+	}
+}
+
+func TestDiff(t *testing.T) {
+	if diff := Diff([]string{"a", "b"}, []interface{}{"a", "b"}); diff != "" {
+		t.Errorf("expected no diff between equal values, got\n%s", diff)
+	}
+	if diff := Diff(map[string]interface{}{"count": 1}, map[string]interface{}{"count": float64(1)}); diff != "" {
+		t.Errorf("expected numbers to compare by json value, got\n%s", diff)
+	}
+	diff := Diff([]string{"a", "b", "c"}, []string{"a", "c", "d"})
+	if !strings.Contains(diff, `-     "b",`) || !strings.Contains(diff, `+     "d"`) {
+		t.Errorf("unexpected diff\n%s", diff)
+	}
+}
+
+func deadlineActions(args map[string]interface{}) parser.Actions {
+	args["id"], args["name"], args["wait"] = "approve_task", "approve", true
+	return parser.Actions{
+		parser.StartNode: {ActionType: parser.StartNode, OnSuccess: "approve"},
+		"approve": {
+			ActionType: parser.TaskAction,
+			Args:       args,
+			OnSuccess:  "end",
+			OnFailure:  "end",
+		},
+		"escalated": {
+			ActionType: parser.IsEqual,
+			Args:       map[string]interface{}{"comparing": "1", "compare_to": "1"},
+			OnSuccess:  "end",
+			OnFailure:  "end",
+		},
+	}
+}
+
+func TestHarness_TaskDeadlineRemindsAndTimesOut(t *testing.T) {
+	h := New(t, deadlineActions(map[string]interface{}{
+		"due_in":        "{{input_data.sla}}",
+		"remind_before": []interface{}{"24h", "1h"},
+		"on_timeout":    "escalated",
+	})).AssertValid()
+
+	run := h.Start(map[string]interface{}{"sla": "48h"}).
+		Advance(47 * time.Hour).
+		AssertStatus(parser.StatusWaiting)
+	reminders := h.Webhooks()
+	if len(reminders) != 2 || reminders[0]["event"] != parser.TaskReminderEvent {
+		t.Fatalf("expected 2 reminders, got %v", reminders)
+	}
+
+	run.Advance(time.Hour).
+		AssertStatus(parser.StatusCompleted).
+		AssertVisited("approve", "escalated").
+		AssertValue("task\\.result", "task_timed_out")
+	if status := run.Session.Task("approve_task").Status(); status != parser.TaskStatusCancelled {
+		t.Errorf("expected cancelled task, got %s", status)
+	}
+}
+
+func TestHarness_TaskDeadlineEscalates(t *testing.T) {
+	h := New(t, deadlineActions(map[string]interface{}{
+		"candidate_groups": []interface{}{"clerks"},
+		"due":              Epoch.Add(time.Hour).Format(time.RFC3339),
+		"escalate_to":      map[string]interface{}{"assignee": "{{input_data.manager}}"},
+	}))
+
+	run := h.Start(map[string]interface{}{"manager": "bob"}).
+		Advance(time.Hour).
+		AssertStatus(parser.StatusWaiting)
+	task := run.Session.Task("approve_task")
+	if task.Status() != parser.TaskStatusClaimed || task.Assignment().Assignee != "bob" {
+		t.Fatalf("expected task escalated to bob, got %s %+v", task.Status(), task.Assignment())
+	}
+	run.CompleteTask("approve", nil).
+		AssertStatus(parser.StatusCompleted).
+		AssertVisited("approve")
+}
+
+func TestHarness_InterruptedTimerDoesNotResume(t *testing.T) {
+	h := New(t, parser.Actions{
+		parser.StartNode: {ActionType: parser.StartNode, OnSuccess: "cool_down"},
+		"cool_down": {
+			ActionType: parser.TimerAction,
+			Args:       map[string]interface{}{"duration": "1h"},
+			OnSuccess:  "end",
+			OnFailure:  "end",
+			OnSignal:   map[string]string{"pause": "paused"},
+		},
+		"paused": {
+			ActionType: parser.WaitSignalAction,
+			Args:       map[string]interface{}{"name": "resume"},
+			OnSuccess:  "end",
+			OnFailure:  "end",
+		},
+	}).AssertValid()
+
+	run := h.Start(nil)
+	h.Parser.RunSignal("pause", nil)
+	run.Advance(time.Hour).
+		AssertStatus(parser.StatusWaiting).
+		AssertVisited("cool_down", "paused")
+	h.Parser.RunSignal("resume", nil)
+	run.AssertStatus(parser.StatusCompleted)
+}
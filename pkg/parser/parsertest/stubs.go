@@ -0,0 +1,38 @@
+package parsertest
+
+import (
+	"context"
+
+	"github.com/AkronimBlack/process-manager/pkg/parser"
+)
+
+// Succeed stubs a handler that sets the given values and takes on_success.
+func Succeed(values map[string]interface{}) parser.Handler {
+	return stub(values, func(action *parser.Action) string {
+		return action.OnSuccess
+	})
+}
+
+// Fail stubs a handler that sets the given values and takes on_failure.
+func Fail(values map[string]interface{}) parser.Handler {
+	return stub(values, func(action *parser.Action) string {
+		return action.OnFailure
+	})
+}
+
+// GoTo stubs a handler that sets the given values and continues at actionId.
+func GoTo(actionId string, values map[string]interface{}) parser.Handler {
+	return stub(values, func(action *parser.Action) string {
+		return actionId
+	})
+}
+
+func stub(values map[string]interface{}, next func(action *parser.Action) string) parser.Handler {
+	return func(ctx context.Context, action *parser.Action, session parser.Session) string {
+		for key, value := range values {
+			session.Set(key, value)
+		}
+		session.AddExecutedAction(parser.NewExecutedAction(*action, map[string]interface{}{"stubbed": true}))
+		return next(action)
+	}
+}
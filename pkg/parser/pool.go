@@ -0,0 +1,317 @@
+package parser
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+)
+
+type Priority int
+
+const (
+	PriorityLow Priority = iota
+	PriorityNormal
+	PriorityHigh
+)
+
+var priorityNames = map[Priority]string{
+	PriorityLow:    "low",
+	PriorityNormal: "normal",
+	PriorityHigh:   "high",
+}
+
+var (
+	ErrQueueFull   = errors.New("session queue is full")
+	ErrNoStartNode = errors.New("definition has no start_node")
+)
+
+func (p Priority) String() string {
+	return priorityNames[p]
+}
+
+// ParsePriority parses low, normal or high, an empty priority is normal.
+func ParsePriority(value string) (Priority, error) {
+	if value == "" {
+		return PriorityNormal, nil
+	}
+	for priority, name := range priorityNames {
+		if name == value {
+			return priority, nil
+		}
+	}
+	return PriorityNormal, fmt.Errorf("invalid priority %s", value)
+}
+
+type priorityKey struct{}
+
+// ContextWithPriority sets the priority a session started with the context is queued with.
+func ContextWithPriority(ctx context.Context, priority Priority) context.Context {
+	return context.WithValue(ctx, priorityKey{}, priority)
+}
+
+// PriorityFromContext returns the stored priority, normal by default.
+func PriorityFromContext(ctx context.Context) Priority {
+	priority, ok := ctx.Value(priorityKey{}).(Priority)
+	if !ok {
+		return PriorityNormal
+	}
+	return priority
+}
+
+type WorkerPoolOptions struct {
+	// Workers run sessions concurrently, 1 when not positive.
+	Workers int
+	// QueueSize is the number of sessions waiting for a worker before new ones are rejected, 0 does not limit.
+	QueueSize int
+	// DefinitionLimits cap the sessions of a process key that run at the same time.
+	DefinitionLimits map[string]int
+}
+
+// WorkerPoolStats is a snapshot of the pool.
+type WorkerPoolStats struct {
+	Workers          int
+	QueueSize        int
+	Queued           int
+	Running          int
+	QueuedByPriority map[Priority]int
+	RunningByProcess map[string]int
+	DefinitionLimits map[string]int
+	Rejected         int
+}
+
+type poolJob struct {
+	processKey string
+	priority   Priority
+	// resumed jobs continue sessions the pool admitted before, a full queue does not reject them.
+	resumed bool
+	run     func()
+}
+
+// WorkerPool runs the sessions of one or more parsers with a bounded number of workers. Queued sessions start by
+// priority and then in order of submission, sessions of a process key at its limit wait without blocking others.
+type WorkerPool struct {
+	options  WorkerPoolOptions
+	queue    []poolJob
+	running  map[string]int
+	rejected int
+	closed   bool
+	ready    *sync.Cond
+
+	lock sync.Mutex
+}
+
+func NewWorkerPool(options WorkerPoolOptions) *WorkerPool {
+	if options.Workers < 1 {
+		options.Workers = 1
+	}
+	limits := make(map[string]int, len(options.DefinitionLimits))
+	for key, limit := range options.DefinitionLimits {
+		limits[key] = limit
+	}
+	options.DefinitionLimits = limits
+	pool := &WorkerPool{
+		options: options,
+		queue:   make([]poolJob, 0),
+		running: map[string]int{},
+	}
+	pool.ready = sync.NewCond(&pool.lock)
+	for i := 0; i < options.Workers; i++ {
+		go pool.work()
+	}
+	return pool
+}
+
+// submit queues the job, ErrQueueFull is returned when the queue is at its size and the job is not resumed.
+func (w *WorkerPool) submit(job poolJob) error {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	if w.closed {
+		return ErrShuttingDown
+	}
+	if !job.resumed && w.options.QueueSize > 0 && len(w.queue) >= w.options.QueueSize {
+		w.rejected++
+		return ErrQueueFull
+	}
+	position := len(w.queue)
+	for position > 0 && w.queue[position-1].priority < job.priority {
+		position--
+	}
+	w.queue = append(w.queue, poolJob{})
+	copy(w.queue[position+1:], w.queue[position:])
+	w.queue[position] = job
+	w.ready.Broadcast()
+	return nil
+}
+
+func (w *WorkerPool) work() {
+	for {
+		job, ok := w.next()
+		if !ok {
+			return
+		}
+		job.run()
+		w.lock.Lock()
+		w.running[job.processKey]--
+		if w.running[job.processKey] == 0 {
+			delete(w.running, job.processKey)
+		}
+		w.ready.Broadcast()
+		w.lock.Unlock()
+	}
+}
+
+// next takes the first queued job whose process key is below its limit, waiting until there is one. It returns
+// false once the pool is closed.
+func (w *WorkerPool) next() (poolJob, bool) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	for {
+		if w.closed {
+			return poolJob{}, false
+		}
+		for i, job := range w.queue {
+			if limit, ok := w.options.DefinitionLimits[job.processKey]; ok && w.running[job.processKey] >= limit {
+				continue
+			}
+			w.queue = append(w.queue[:i], w.queue[i+1:]...)
+			w.running[job.processKey]++
+			return job, true
+		}
+		w.ready.Wait()
+	}
+}
+
+// Close rejects new sessions and drops the queued ones, their sessions keep the status queued. Running sessions
+// are not interrupted.
+func (w *WorkerPool) Close() {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	w.closed = true
+	w.queue = w.queue[:0]
+	w.ready.Broadcast()
+}
+
+func (w *WorkerPool) Stats() WorkerPoolStats {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	stats := WorkerPoolStats{
+		Workers:          w.options.Workers,
+		QueueSize:        w.options.QueueSize,
+		Queued:           len(w.queue),
+		QueuedByPriority: map[Priority]int{},
+		RunningByProcess: map[string]int{},
+		DefinitionLimits: map[string]int{},
+		Rejected:         w.rejected,
+	}
+	for _, job := range w.queue {
+		stats.QueuedByPriority[job.priority]++
+	}
+	for key, running := range w.running {
+		stats.Running += running
+		stats.RunningByProcess[key] = running
+	}
+	for key, limit := range w.options.DefinitionLimits {
+		stats.DefinitionLimits[key] = limit
+	}
+	return stats
+}
+
+// SetWorkerPool runs new sessions on the pool instead of a goroutine each.
+func (p *Parser) SetWorkerPool(pool *WorkerPool) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.pool = pool
+}
+
+func (p *Parser) WorkerPool() *WorkerPool {
+	return p.pool
+}
+
+// Enqueue starts a session in the background. With a worker pool the session is queued with the priority stored
+// by ContextWithPriority until a worker is free, ErrQueueFull is returned when the queue is full.
+func (p *Parser) Enqueue(ctx context.Context, data map[string]interface{}, webhook Webhook) (Session, error) {
+	newSession, _, err := p.enqueue(ctx, data, webhook)
+	return newSession, err
+}
+
+// enqueue starts a session in the background, the returned channel is closed once it finished or waits.
+// ErrNoStartNode is returned when no definition with a start_node is loaded.
+func (p *Parser) enqueue(ctx context.Context, data map[string]interface{}, webhook Webhook) (Session, <-chan struct{}, error) {
+	if p.ShuttingDown() {
+		return nil, nil, ErrShuttingDown
+	}
+	startAction := p.Actions()[StartNode]
+	if startAction == nil {
+		return nil, nil, ErrNoStartNode
+	}
+	done := make(chan struct{})
+	pool := p.WorkerPool()
+	if pool == nil {
+		runCtx, newSession := p.startSession(ctx, data, webhook)
+		go func() {
+			p.runActionById(runCtx, startAction.OnSuccess, newSession)
+			close(done)
+		}()
+		return newSession, done, nil
+	}
+	newSession := NewSession(data, webhook)
+	newSession.SetProcessKey(p.Key())
+	newSession.SetStatus(StatusQueued)
+	registered := make(chan struct{})
+	err := pool.submit(poolJob{
+		processKey: p.Key(),
+		priority:   PriorityFromContext(ctx),
+		run: func() {
+			defer close(done)
+			<-registered
+			newSession.SetStatus(StatusRunning)
+			p.runActionById(p.startSessionSpan(ctx, newSession), startAction.OnSuccess, newSession)
+		},
+	})
+	if err != nil {
+		p.metrics.SessionRejected(p.Key())
+		p.sessionLogger(newSession).Warn("session rejected", slog.String("error", err.Error()))
+		return nil, nil, err
+	}
+	p.registerSession(ctx, newSession)
+	close(registered)
+	return newSession, done, nil
+}
+
+// resumeQueued continues a resumed session at the action on the worker pool, with the priority of the context and
+// within the limit of its process key. Without a pool the session is continued with run. A session the closed pool
+// rejects keeps the status queued at the action, so Shutdown checkpoints it there.
+func (p *Parser) resumeQueued(ctx context.Context, session Session, actionId string, run func(func())) {
+	pool := p.WorkerPool()
+	if pool == nil {
+		run(func() {
+			p.runActionById(ctx, actionId, session)
+		})
+		return
+	}
+	session.SetCurrentAction(actionId)
+	session.SetStatus(StatusQueued)
+	err := pool.submit(poolJob{
+		processKey: p.Key(),
+		priority:   PriorityFromContext(ctx),
+		resumed:    true,
+		run: func() {
+			session.SetStatus(StatusRunning)
+			p.runActionById(ctx, actionId, session)
+		},
+	})
+	if err != nil {
+		p.sessionLogger(session).Warn("resumed session not queued", slog.String("action_id", actionId), slog.String("error", err.Error()))
+	}
+}
+
+// runInBackground and runInline continue resumed sessions when the parser has no worker pool.
+func runInBackground(run func()) {
+	go run()
+}
+
+func runInline(run func()) {
+	run()
+}
@@ -0,0 +1,191 @@
+package parser
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// gatedParser runs sessions that record their name and block until the gate is opened.
+func gatedParser(key string, gate <-chan struct{}, started chan<- string) *Parser {
+	parser := NewParser()
+	parser.SetKey(key)
+	parser.AddHandler("gate", func(ctx context.Context, action *Action, session Session) string {
+		started <- session.StringValueOf("input_data.name", "")
+		<-gate
+		return action.OnSuccess
+	})
+	parser.SetActions(Actions{
+		StartNode: {ActionType: StartNode, OnSuccess: "gate"},
+		"gate":    {ActionType: "gate", OnSuccess: "end", OnFailure: "end"},
+	})
+	return parser
+}
+
+func waitStarted(t *testing.T, started <-chan string) string {
+	t.Helper()
+	select {
+	case name := <-started:
+		return name
+	case <-time.After(time.Second):
+		t.Fatal("expected a session to start")
+	}
+	return ""
+}
+
+func TestWorkerPool_StartsByPriority(t *testing.T) {
+	gate, started := make(chan struct{}), make(chan string, 4)
+	parser := gatedParser("orders", gate, started)
+	parser.SetWorkerPool(NewWorkerPool(WorkerPoolOptions{Workers: 1}))
+
+	first, err := parser.Enqueue(context.Background(), map[string]interface{}{"name": "first"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitStarted(t, started)
+	for name, priority := range map[string]Priority{"normal": PriorityNormal, "high": PriorityHigh, "low": PriorityLow} {
+		queued, err := parser.Enqueue(ContextWithPriority(context.Background(), priority), map[string]interface{}{"name": name}, nil)
+		if err != nil || queued.Status() != StatusQueued {
+			t.Fatalf("expected %s queued, got %v", name, err)
+		}
+	}
+	if stats := parser.WorkerPool().Stats(); stats.Queued != 3 || stats.Running != 1 || stats.QueuedByPriority[PriorityHigh] != 1 {
+		t.Errorf("expected 3 queued and 1 running session, got %+v", stats)
+	}
+
+	close(gate)
+	for _, expected := range []string{"high", "normal", "low"} {
+		if name := waitStarted(t, started); name != expected {
+			t.Errorf("expected %s to start next, got %s", expected, name)
+		}
+	}
+	if first.Status() != StatusCompleted && first.Status() != StatusRunning {
+		t.Errorf("expected the first session to run, got %s", first.Status())
+	}
+}
+
+func TestWorkerPool_DefinitionLimits(t *testing.T) {
+	gate, started := make(chan struct{}), make(chan string, 4)
+	defer close(gate)
+	pool := NewWorkerPool(WorkerPoolOptions{Workers: 2, DefinitionLimits: map[string]int{"orders": 1}})
+	orders, invoices := gatedParser("orders", gate, started), gatedParser("invoices", gate, started)
+	orders.SetWorkerPool(pool)
+	invoices.SetWorkerPool(pool)
+
+	for _, name := range []string{"order 1", "order 2"} {
+		if _, err := orders.Enqueue(context.Background(), map[string]interface{}{"name": name}, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	waitStarted(t, started)
+	if _, err := invoices.Enqueue(context.Background(), map[string]interface{}{"name": "invoice"}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if name := waitStarted(t, started); name != "invoice" {
+		t.Errorf("expected the invoice to start while the order waits for the limit, got %s", name)
+	}
+	if stats := pool.Stats(); stats.Queued != 1 || stats.RunningByProcess["orders"] != 1 || stats.RunningByProcess["invoices"] != 1 {
+		t.Errorf("expected one order queued, got %+v", stats)
+	}
+}
+
+func TestParserHttpHandler_StartSessionQueueFull(t *testing.T) {
+	gate, started := make(chan struct{}), make(chan string, 4)
+	defer close(gate)
+	parser := gatedParser("orders", gate, started)
+	parser.SetWorkerPool(NewWorkerPool(WorkerPoolOptions{Workers: 1, QueueSize: 1}))
+	router := newTestRouter(parser)
+
+	codes := make([]int, 0, 3)
+	for _, body := range []string{`{"data": {"name": "running"}}`, `{"data": {"name": "queued"}, "priority": "high"}`, `{"data": {}}`} {
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/api/sessions", strings.NewReader(body)))
+		codes = append(codes, recorder.Code)
+		if len(codes) == 1 {
+			waitStarted(t, started)
+		}
+	}
+	// the first session may still be queued when the response is written
+	if codes[0] == http.StatusTooManyRequests || codes[1] != http.StatusAccepted || codes[2] != http.StatusTooManyRequests {
+		t.Errorf("expected the session queued and then rejected, got %v", codes)
+	}
+
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/api/pool", nil))
+	var pool WorkerPoolDto
+	if err := json.Unmarshal(recorder.Body.Bytes(), &pool); err != nil {
+		t.Fatal(err)
+	}
+	if pool.Queued != 1 || pool.QueuedByPriority["high"] != 1 || pool.Running != 1 || pool.Rejected != 1 {
+		t.Errorf("expected the pool stats, got %+v", pool)
+	}
+
+	recorder = httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/api/sessions", strings.NewReader(`{"priority": "urgent"}`)))
+	if recorder.Code != http.StatusUnprocessableEntity {
+		t.Errorf("expected an unknown priority rejected, got %d", recorder.Code)
+	}
+}
+
+func TestParserHttpHandler_StartSessionWithoutDefinition(t *testing.T) {
+	for name, pool := range map[string]*WorkerPool{"goroutine": nil, "pool": NewWorkerPool(WorkerPoolOptions{Workers: 1})} {
+		parser := NewParser()
+		if pool != nil {
+			parser.SetWorkerPool(pool)
+		}
+		router := newTestRouter(parser)
+		for _, target := range []string{"/api/sessions", "/api/sessions?wait=true"} {
+			recorder := httptest.NewRecorder()
+			router.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, target, strings.NewReader(`{"data": {}}`)))
+			if recorder.Code != http.StatusInternalServerError {
+				t.Errorf("%s %s: expected 500 without a definition, got %d", name, target, recorder.Code)
+			}
+		}
+		if len(parser.Sessions()) != 0 {
+			t.Errorf("%s: expected no session, got %d", name, len(parser.Sessions()))
+		}
+	}
+}
+
+func TestParser_ResumedSessionsQueueOnThePool(t *testing.T) {
+	gate, started := make(chan struct{}), make(chan string, 4)
+	parser := gatedParser("orders", gate, started)
+	actions := parser.Actions()
+	actions[StartNode].OnSuccess = "approve"
+	actions["approve"] = &Action{ActionType: TaskAction, Args: Args{"id": "approve", "name": "approve", "wait": true}, OnSuccess: "gate", OnFailure: "end"}
+	parser.SetActions(actions)
+	parser.SetWorkerPool(NewWorkerPool(WorkerPoolOptions{Workers: 2, QueueSize: 1, DefinitionLimits: map[string]int{"orders": 1}}))
+
+	sessions := make([]Session, 2)
+	for i, name := range []string{"first", "second"} {
+		session, err := parser.Enqueue(context.Background(), map[string]interface{}{"name": name}, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		waitStatus(t, session, StatusWaiting)
+		sessions[i] = session
+	}
+	if err := parser.CompleteTask(context.Background(), sessions[0].Task("approve"), nil); err != nil {
+		t.Fatal(err)
+	}
+	waitStarted(t, started)
+	// the queue is full with a resumed session, new sessions are rejected but resumed ones are not
+	if err := parser.CompleteTask(context.Background(), sessions[1].Task("approve"), nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := parser.Enqueue(context.Background(), map[string]interface{}{"name": "third"}, nil); err != ErrQueueFull {
+		t.Errorf("expected the queue full, got %v", err)
+	}
+	if stats := parser.WorkerPool().Stats(); sessions[1].Status() != StatusQueued || stats.Queued != 1 || stats.RunningByProcess["orders"] != 1 {
+		t.Errorf("expected the resumed session queued behind the definition limit, got %s %+v", sessions[1].Status(), stats)
+	}
+
+	close(gate)
+	for _, session := range sessions {
+		waitStatus(t, session, StatusCompleted)
+	}
+}
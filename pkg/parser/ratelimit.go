@@ -0,0 +1,179 @@
+package parser
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var ErrUnknownRateLimit = errors.New("unknown rate limit")
+
+// RateLimit configures a RateLimiter.
+type RateLimit struct {
+	// Rate is the number of requests per second, 0 does not limit the rate.
+	Rate float64
+	// Burst is the number of requests that may be sent at once, 1 when not positive.
+	Burst int
+	// MaxConcurrent caps the requests in flight, 0 does not limit.
+	MaxConcurrent int
+}
+
+// RateLimiter is a token bucket with a cap on concurrent requests, shared by every session referencing it.
+type RateLimiter struct {
+	limit  RateLimit
+	tokens float64
+	last   time.Time
+	slots  chan struct{}
+
+	lock sync.Mutex
+}
+
+func NewRateLimiter(limit RateLimit) *RateLimiter {
+	if limit.Burst < 1 {
+		limit.Burst = 1
+	}
+	limiter := &RateLimiter{limit: limit, tokens: float64(limit.Burst), last: time.Now()}
+	if limit.MaxConcurrent > 0 {
+		limiter.slots = make(chan struct{}, limit.MaxConcurrent)
+	}
+	return limiter
+}
+
+func (l *RateLimiter) Limit() RateLimit {
+	return l.limit
+}
+
+// Acquire waits for a free slot and a token. The returned release frees the slot once the request is done. The
+// context error is returned when it is cancelled first.
+func (l *RateLimiter) Acquire(ctx context.Context) (func(), error) {
+	if l.slots != nil {
+		select {
+		case l.slots <- struct{}{}:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	release := func() {
+		if l.slots != nil {
+			<-l.slots
+		}
+	}
+	wait := l.reserve()
+	if wait <= 0 {
+		return release, nil
+	}
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return release, nil
+	case <-ctx.Done():
+		l.cancel()
+		release()
+		return nil, ctx.Err()
+	}
+}
+
+// reserve takes a token and returns how long to wait until it is available.
+func (l *RateLimiter) reserve() time.Duration {
+	if l.limit.Rate <= 0 {
+		return 0
+	}
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	now := time.Now()
+	l.tokens += now.Sub(l.last).Seconds() * l.limit.Rate
+	if l.tokens > float64(l.limit.Burst) {
+		l.tokens = float64(l.limit.Burst)
+	}
+	l.last = now
+	l.tokens--
+	if l.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-l.tokens / l.limit.Rate * float64(time.Second))
+}
+
+// cancel returns a reserved token that was not used.
+func (l *RateLimiter) cancel() {
+	if l.limit.Rate <= 0 {
+		return
+	}
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	l.tokens++
+}
+
+// ParseRateLimit parses name=rate[,burst=n][,concurrency=n], the rate is a number per s, m or h, e.g.
+// partner=10/s,burst=5,concurrency=2.
+func ParseRateLimit(value string) (string, RateLimit, error) {
+	limit := RateLimit{}
+	name, spec, ok := strings.Cut(value, "=")
+	if !ok || name == "" || spec == "" {
+		return "", limit, fmt.Errorf("invalid rate limit %s, expected name=rate", value)
+	}
+	parts := strings.Split(spec, ",")
+	count, unit, ok := strings.Cut(parts[0], "/")
+	per := map[string]time.Duration{"s": time.Second, "m": time.Minute, "h": time.Hour}[unit]
+	rate, err := strconv.ParseFloat(count, 64)
+	if !ok || per == 0 || err != nil || rate < 0 {
+		return "", limit, fmt.Errorf("invalid rate %s of rate limit %s, expected e.g. 10/s", parts[0], name)
+	}
+	limit.Rate = rate / per.Seconds()
+	for _, option := range parts[1:] {
+		key, number, _ := strings.Cut(option, "=")
+		parsed, err := strconv.Atoi(number)
+		if err != nil || parsed < 0 {
+			return "", limit, fmt.Errorf("invalid %s of rate limit %s", option, name)
+		}
+		switch key {
+		case "burst":
+			limit.Burst = parsed
+		case "concurrency":
+			limit.MaxConcurrent = parsed
+		default:
+			return "", limit, fmt.Errorf("unknown option %s of rate limit %s", key, name)
+		}
+	}
+	return name, limit, nil
+}
+
+type rateLimitersKey struct{}
+
+// ContextWithRateLimiters stores the rate limiters of the parser so http actions can reference them.
+func ContextWithRateLimiters(ctx context.Context, limiters map[string]*RateLimiter) context.Context {
+	return context.WithValue(ctx, rateLimitersKey{}, limiters)
+}
+
+// RateLimiterFromContext returns the stored rate limiter with the name.
+func RateLimiterFromContext(ctx context.Context, name string) (*RateLimiter, error) {
+	limiters, _ := ctx.Value(rateLimitersKey{}).(map[string]*RateLimiter)
+	limiter, ok := limiters[name]
+	if !ok {
+		return nil, fmt.Errorf("%w %s", ErrUnknownRateLimit, name)
+	}
+	return limiter, nil
+}
+
+// AddRateLimiter registers a rate limiter http actions reference by name. The same limiter may be added to
+// several parsers to share it.
+func (p *Parser) AddRateLimiter(name string, limiter *RateLimiter) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	limiters := make(map[string]*RateLimiter, len(p.rateLimiters)+1)
+	for existing, existingLimiter := range p.rateLimiters {
+		limiters[existing] = existingLimiter
+	}
+	limiters[name] = limiter
+	p.rateLimiters = limiters
+}
+
+func (p *Parser) RateLimiters() map[string]*RateLimiter {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	return p.rateLimiters
+}
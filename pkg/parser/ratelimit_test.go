@@ -0,0 +1,113 @@
+package parser
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestParseRateLimit(t *testing.T) {
+	name, limit, err := ParseRateLimit("partner=600/m,burst=5,concurrency=2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if name != "partner" || limit.Rate != 10 || limit.Burst != 5 || limit.MaxConcurrent != 2 {
+		t.Errorf("expected partner at 10/s, got %s %+v", name, limit)
+	}
+	for _, invalid := range []string{"partner", "partner=10", "partner=10/d", "partner=x/s", "partner=10/s,burst=-1", "partner=10/s,size=2"} {
+		if _, _, err := ParseRateLimit(invalid); err == nil {
+			t.Errorf("expected %s rejected", invalid)
+		}
+	}
+}
+
+func TestRateLimiter_WaitsForTokens(t *testing.T) {
+	limiter := NewRateLimiter(RateLimit{Rate: 20, Burst: 1})
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		release, err := limiter.Acquire(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		release()
+	}
+	if elapsed := time.Since(start); elapsed < 90*time.Millisecond {
+		t.Errorf("expected 3 requests at 20/s to take 100ms, took %s", elapsed)
+	}
+}
+
+func TestRateLimiter_CapsConcurrencyAndRespectsCancellation(t *testing.T) {
+	limiter := NewRateLimiter(RateLimit{MaxConcurrent: 1})
+	release, err := limiter.Acquire(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err = limiter.Acquire(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected the wait cancelled, got %v", err)
+	}
+	release()
+	if release, err = limiter.Acquire(context.Background()); err != nil {
+		t.Fatalf("expected the released slot acquired, got %v", err)
+	}
+	release()
+}
+
+func TestHttpHandler_SharesRateLimit(t *testing.T) {
+	var inFlight, maxInFlight int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		current := atomic.AddInt32(&inFlight, 1)
+		defer atomic.AddInt32(&inFlight, -1)
+		for {
+			seen := atomic.LoadInt32(&maxInFlight)
+			if current <= seen || atomic.CompareAndSwapInt32(&maxInFlight, seen, current) {
+				break
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+	}))
+	defer server.Close()
+
+	parser := NewParser()
+	parser.AddRateLimiter("partner", NewRateLimiter(RateLimit{MaxConcurrent: 2}))
+	parser.SetActions(Actions{
+		StartNode: {ActionType: StartNode, OnSuccess: "call"},
+		"call": {
+			ActionType: HttpAction,
+			Args:       Args{"url": server.URL, "method": "get", "timeout": 1000, "rate_limit": "partner"},
+			OnSuccess:  "end",
+			OnFailure:  "failed",
+		},
+	})
+
+	var wait sync.WaitGroup
+	sessions := make([]Session, 6)
+	for i := range sessions {
+		wait.Add(1)
+		go func(i int) {
+			defer wait.Done()
+			sessions[i] = parser.Run(context.Background(), map[string]interface{}{}, nil)
+		}(i)
+	}
+	wait.Wait()
+	for _, session := range sessions {
+		if session.Values()["http.result"] == nil {
+			t.Errorf("expected every request sent, got %v", session.Values())
+		}
+	}
+	if maxInFlight > 2 {
+		t.Errorf("expected at most 2 requests in flight, got %d", maxInFlight)
+	}
+
+	parser.actions["call"].Args["rate_limit"] = "unknown"
+	session := parser.Run(context.Background(), map[string]interface{}{}, nil)
+	if session.Values()["http.result_error"] != "unknown rate limit unknown" {
+		t.Errorf("expected an unknown rate limit reported, got %v", session.Values())
+	}
+}
@@ -0,0 +1,209 @@
+package parser
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+var (
+	ErrSessionNotFound = errors.New("session not found")
+	ErrSessionActive   = errors.New("session is queued or running")
+)
+
+// RetentionPolicy is how long finished sessions are kept after they finished, 0 keeps them forever.
+type RetentionPolicy struct {
+	Completed time.Duration
+	Failed    time.Duration
+}
+
+// expired reports if the finished session outlived the policy at now.
+func (r RetentionPolicy) expired(session Session, now time.Time) bool {
+	keep := r.Completed
+	switch session.Status() {
+	case StatusCompleted:
+	case StatusFailed:
+		keep = r.Failed
+	default:
+		return false
+	}
+	finished := session.Finished()
+	return keep > 0 && !finished.IsZero() && !now.Before(finished.Add(keep))
+}
+
+// SetRetentionPolicies sets the retention policies by process key, sessions of other definitions are kept.
+func (p *Parser) SetRetentionPolicies(policies map[string]RetentionPolicy) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.retention = policies
+}
+
+func (p *Parser) RetentionPolicies() map[string]RetentionPolicy {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	return p.retention
+}
+
+// SessionArchive receives expired sessions before they are deleted.
+type SessionArchive interface {
+	Archive(sessions []SessionDto) error
+}
+
+// FileSessionArchive appends sessions as gzip compressed json lines to a file per day, e.g.
+// sessions-2024-01-31.jsonl.gz. Every call adds a gzip member, the files read as a single stream.
+type FileSessionArchive struct {
+	dir string
+}
+
+// NewFileSessionArchive creates the directory if it does not exist.
+func NewFileSessionArchive(dir string) (*FileSessionArchive, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &FileSessionArchive{dir: dir}, nil
+}
+
+func (a *FileSessionArchive) Archive(sessions []SessionDto) error {
+	if len(sessions) == 0 {
+		return nil
+	}
+	name := filepath.Join(a.dir, "sessions-"+time.Now().UTC().Format(time.DateOnly)+".jsonl.gz")
+	file, err := os.OpenFile(name, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	compressed := gzip.NewWriter(file)
+	encoder := json.NewEncoder(compressed)
+	for _, session := range sessions {
+		if err = encoder.Encode(session); err != nil {
+			file.Close()
+			return err
+		}
+	}
+	if err = compressed.Close(); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// SetSessionArchive sets the archive expired sessions are exported to, without one they are only deleted.
+func (p *Parser) SetSessionArchive(archive SessionArchive) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.archive = archive
+}
+
+func (p *Parser) SessionArchive() SessionArchive {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	return p.archive
+}
+
+// ExpireSessions archives and deletes the finished sessions that outlived the retention policy of their
+// definition and returns how many were deleted. Nothing is deleted when archiving fails.
+func (p *Parser) ExpireSessions() (int, error) {
+	now := p.Clock().Now()
+	policies := p.RetentionPolicies()
+	expired := make([]Session, 0)
+	for _, activeSession := range p.Sessions() {
+		if policy, ok := policies[activeSession.ProcessKey()]; ok && policy.expired(activeSession, now) {
+			expired = append(expired, activeSession)
+		}
+	}
+	if len(expired) == 0 {
+		return 0, nil
+	}
+	if archive := p.SessionArchive(); archive != nil {
+		dtos := make([]SessionDto, len(expired))
+		for i, expiredSession := range expired {
+			dtos[i] = NewSessionDto(expiredSession)
+		}
+		if err := archive.Archive(dtos); err != nil {
+			return 0, err
+		}
+	}
+	p.removeSessions(expired)
+	p.Logger().Info("expired sessions deleted", slog.Int("deleted", len(expired)))
+	return len(expired), nil
+}
+
+// RunJanitor expires sessions every interval until the context is done.
+func (p *Parser) RunJanitor(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if _, err := p.ExpireSessions(); err != nil {
+				p.Logger().Error("archiving expired sessions failed", slog.String("error", err.Error()))
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// DeleteSession removes a finished or waiting session, waiting sessions are marked StatusDeleted and their tasks
+// cancelled. Queued and running sessions can not be deleted.
+func (p *Parser) DeleteSession(uuid string) error {
+	p.lock.Lock()
+	activeSession := p.sessionIndex[uuid].session
+	if activeSession == nil {
+		p.lock.Unlock()
+		return ErrSessionNotFound
+	}
+	switch activeSession.Status() {
+	case StatusQueued, StatusRunning:
+		p.lock.Unlock()
+		return ErrSessionActive
+	case StatusWaiting:
+		for _, pendingTask := range activeSession.Tasks() {
+			pendingTask.Cancel()
+		}
+		activeSession.SetStatus(StatusDeleted)
+	}
+	p.dropSessions([]Session{activeSession})
+	p.lock.Unlock()
+	p.sessionLogger(activeSession).Info("session deleted")
+	return nil
+}
+
+func (p *Parser) removeSessions(sessions []Session) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.dropSessions(sessions)
+}
+
+// dropSessions removes the sessions and everything referencing them from the parser. The caller must hold the
+// parser lock.
+func (p *Parser) dropSessions(sessions []Session) {
+	removed := make(map[string]bool, len(sessions))
+	for _, session := range sessions {
+		removed[session.Uuid()] = true
+		delete(p.sessionIndex, session.Uuid())
+		delete(p.suspended, session.Uuid())
+		delete(p.pendingWakes, session.Uuid())
+		delete(p.interruptions, session.Uuid())
+		p.unsubscribe(session)
+	}
+	// the slices are replaced, Sessions may have handed out the previous ones
+	p.sessions = sessionsWithout(p.sessions, removed)
+	p.failedWebhooks = sessionsWithout(p.failedWebhooks, removed)
+	p.tasks.remove(removed)
+}
+
+func sessionsWithout(sessions []Session, removed map[string]bool) []Session {
+	remaining := make([]Session, 0, len(sessions))
+	for _, candidate := range sessions {
+		if !removed[candidate.Uuid()] {
+			remaining = append(remaining, candidate)
+		}
+	}
+	return remaining
+}
@@ -0,0 +1,163 @@
+package parser
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// shiftedClock runs ahead of the real clock.
+type shiftedClock struct {
+	realClock
+	shift time.Duration
+}
+
+func (c shiftedClock) Now() time.Time {
+	return time.Now().Add(c.shift)
+}
+
+type failingArchive struct{}
+
+func (failingArchive) Archive([]SessionDto) error {
+	return errors.New("disk full")
+}
+
+func readArchive(t *testing.T, dir string) []SessionDto {
+	t.Helper()
+	files, err := filepath.Glob(filepath.Join(dir, "sessions-*.jsonl.gz"))
+	if err != nil || len(files) != 1 {
+		t.Fatalf("expected one archive file, got %v %v", files, err)
+	}
+	file, err := os.Open(files[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	reader, err := gzip.NewReader(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	archived := make([]SessionDto, 0)
+	lines := bufio.NewScanner(reader)
+	for lines.Scan() {
+		session := SessionDto{}
+		if err = json.Unmarshal(lines.Bytes(), &session); err != nil {
+			t.Fatal(err)
+		}
+		archived = append(archived, session)
+	}
+	return archived
+}
+
+func TestParser_ExpireSessionsArchivesBeforeDeleting(t *testing.T) {
+	dir := t.TempDir()
+	archive, err := NewFileSessionArchive(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	parser := orderParser()
+	parser.SetSessionArchive(archive)
+	parser.SetRetentionPolicies(map[string]RetentionPolicy{
+		"orders":   {Completed: 24 * time.Hour, Failed: 72 * time.Hour},
+		"invoices": {Completed: time.Hour, Failed: time.Hour},
+	})
+	sessions := runOrders(parser, 50, 150)
+	failed := parser.Run(ContextWithLimits(context.Background(), Limits{MaxSteps: 1}), map[string]interface{}{"amount": 20}, nil)
+	if sessions[1].Status() != StatusCompleted || failed.Status() != StatusFailed || failed.Finished().IsZero() {
+		t.Fatalf("expected a completed and a failed session, got %s and %s", sessions[1].Status(), failed.Status())
+	}
+
+	parser.SetClock(shiftedClock{shift: 48 * time.Hour})
+	if deleted, err := parser.ExpireSessions(); err != nil || deleted != 1 {
+		t.Fatalf("expected the completed session deleted, got %d %v", deleted, err)
+	}
+	if parser.Session(sessions[1].Uuid()) != nil || parser.Session(failed.Uuid()) == nil || parser.Session(sessions[0].Uuid()) == nil {
+		t.Error("expected only the completed session deleted")
+	}
+
+	parser.SetClock(shiftedClock{shift: 96 * time.Hour})
+	if deleted, err := parser.ExpireSessions(); err != nil || deleted != 1 {
+		t.Fatalf("expected the failed session deleted, got %d %v", deleted, err)
+	}
+	archived := readArchive(t, dir)
+	if len(archived) != 2 || archived[0].Uuid != sessions[1].Uuid() || archived[1].Uuid != failed.Uuid() || archived[1].FinishedAt == nil {
+		t.Errorf("expected both sessions archived, got %+v", archived)
+	}
+	if page, _ := parser.QuerySessions(SessionQuery{}); page.Total != 1 || page.Sessions[0] != sessions[0] {
+		t.Errorf("expected the waiting session kept, got %d sessions", page.Total)
+	}
+}
+
+func TestParser_ExpireSessionsKeepsSessionsWhenArchivingFails(t *testing.T) {
+	parser := orderParser()
+	parser.SetSessionArchive(failingArchive{})
+	parser.SetRetentionPolicies(map[string]RetentionPolicy{"orders": {Completed: time.Hour}})
+	completed := runOrders(parser, 150)[0]
+	parser.SetClock(shiftedClock{shift: 2 * time.Hour})
+	if deleted, err := parser.ExpireSessions(); err == nil || deleted != 0 {
+		t.Errorf("expected the archive error, got %d %v", deleted, err)
+	}
+	if parser.Session(completed.Uuid()) == nil {
+		t.Error("expected the session kept")
+	}
+}
+
+func TestParser_DeleteSession(t *testing.T) {
+	parser := orderParser()
+	waiting := runOrders(parser, 50)[0]
+	approval := waiting.Task("approve")
+	if err := parser.DeleteSession(waiting.Uuid()); err != nil {
+		t.Fatal(err)
+	}
+	if waiting.Status() != StatusDeleted || approval.Status() != TaskStatusCancelled {
+		t.Errorf("expected the session deleted and its task cancelled, got %s %s", waiting.Status(), approval.Status())
+	}
+	if parser.Session(waiting.Uuid()) != nil || len(parser.TaskIndex().Find("order-0")) != 0 {
+		t.Error("expected the session and its task removed")
+	}
+	if err := parser.DeleteSession(waiting.Uuid()); !errors.Is(err, ErrSessionNotFound) {
+		t.Errorf("expected a deleted session not found, got %v", err)
+	}
+
+	payments := NewParser()
+	payments.SetActions(paymentActions(""))
+	subscribed := payments.Run(context.Background(), map[string]interface{}{"order_id": "1"}, nil)
+	if err := payments.DeleteSession(subscribed.Uuid()); err != nil {
+		t.Fatal(err)
+	}
+	_, err := payments.RunMessage(context.Background(), Message{Name: "payment_received", CorrelationKeys: map[string]string{"order_id": "1"}}, nil)
+	if !errors.Is(err, ErrMessageNotCorrelated) {
+		t.Errorf("expected the subscription removed, got %v", err)
+	}
+
+	gate, started := make(chan struct{}), make(chan string, 1)
+	defer close(gate)
+	gated := gatedParser("orders", gate, started)
+	go gated.Run(context.Background(), map[string]interface{}{"name": "running"}, nil)
+	waitStarted(t, started)
+	if err := gated.DeleteSession(gated.Sessions()[0].Uuid()); !errors.Is(err, ErrSessionActive) {
+		t.Errorf("expected a running session kept, got %v", err)
+	}
+}
+
+func TestParserHttpHandler_DeleteSession(t *testing.T) {
+	parser := orderParser()
+	completed := runOrders(parser, 150)[0]
+	router := newTestRouter(parser)
+
+	for _, expected := range []int{http.StatusNoContent, http.StatusNotFound} {
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, httptest.NewRequest(http.MethodDelete, "/api/sessions/"+completed.Uuid(), nil))
+		if recorder.Code != expected {
+			t.Errorf("expected status %d, got %d %s", expected, recorder.Code, recorder.Body.String())
+		}
+	}
+}
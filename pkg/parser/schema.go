@@ -0,0 +1,292 @@
+package parser
+
+import (
+	"sort"
+)
+
+const (
+	JsonSchemaDraft = "http://json-schema.org/draft-07/schema#"
+	// DefinitionSchemaId identifies the generated schema of process definitions.
+	DefinitionSchemaId = "https://github.com/AkronimBlack/process-manager/schema/definition.json"
+)
+
+// JsonSchema is a json schema document or a part of one.
+type JsonSchema map[string]interface{}
+
+var resultArgSchema = JsonSchema{
+	"type":        "string",
+	"description": "session value the result is stored under, <type>.result by default, errors go to <result>_error",
+}
+
+func operatorArgsSchema(description string) JsonSchema {
+	return JsonSchema{
+		"type":        "object",
+		"description": description,
+		"required":    []string{comparingKey, compareToKey},
+		"properties": map[string]interface{}{
+			result:       resultArgSchema,
+			comparingKey: JsonSchema{"type": "string", "description": "integer or placeholder, e.g. {{input_data.amount}}"},
+			compareToKey: JsonSchema{"type": "string", "description": "integer or placeholder, e.g. 10"},
+		},
+		"additionalProperties": false,
+	}
+}
+
+// builtinArgsSchemas describe the args of the handlers registered by NewParser.
+var builtinArgsSchemas = map[string]JsonSchema{
+	IsGreater: operatorArgsSchema("stores comparing > compare_to, always continues at on_success"),
+	IsLower:   operatorArgsSchema("stores comparing < compare_to, always continues at on_success"),
+	IsEqual:   operatorArgsSchema("stores comparing == compare_to, always continues at on_success"),
+	HttpAction: {
+		"type":        "object",
+		"description": "sends a request and stores status, status_code and response, continues at on_failure when the request fails",
+		"required":    []string{"url"},
+		"properties": map[string]interface{}{
+			result:    resultArgSchema,
+			"url":     JsonSchema{"type": "string", "format": "uri"},
+			"method":  JsonSchema{"type": "string", "examples": []string{"get", "post", "put", "patch", "delete"}},
+			"timeout": JsonSchema{"type": "integer", "minimum": 0, "description": "request timeout in milliseconds"},
+			"rate_limit": JsonSchema{
+				"type": "string", "description": "rate limiter of the server the request waits for, e.g. partner",
+			},
+		},
+		"additionalProperties": false,
+	},
+	TaskAction: {
+		"type":        "object",
+		"description": "creates a task, with wait the session waits until it is completed, otherwise it continues at on_success",
+		"required":    []string{"name"},
+		"properties": map[string]interface{}{
+			result: resultArgSchema,
+			"id":   JsonSchema{"type": "string", "description": "definition key of the task, task ids are generated"},
+			"name": JsonSchema{"type": "string"},
+			"business_key": JsonSchema{
+				"type": "string", "description": "key clients look the task up by, e.g. loan-{{input_data.loan_id}}",
+			},
+			"parameters": JsonSchema{"type": "object", "description": "handed to whoever completes the task"},
+			"wait":       JsonSchema{"type": "boolean", "description": "park the session until the task is completed"},
+			"next":       JsonSchema{"type": "string", "description": "action a waiting session continues at once completed, on_success by default"},
+			"assignee":   JsonSchema{"type": "string", "description": "user the task starts claimed by"},
+			"candidate_users": JsonSchema{
+				"type": "array", "items": JsonSchema{"type": "string"}, "description": "users that may claim and complete the task",
+			},
+			"candidate_groups": JsonSchema{
+				"type": "array", "items": JsonSchema{"type": "string"}, "description": "groups whose users may claim and complete the task",
+			},
+			"form": JsonSchema{"type": "object", "description": "json schema the completion payload is validated against"},
+			"due":  JsonSchema{"type": "string", "description": "RFC3339 deadline or placeholder"},
+			"due_in": JsonSchema{
+				"type": "string", "description": "go duration from the creation of the task or placeholder, e.g. 48h",
+			},
+			"remind_before": JsonSchema{
+				"type": "array", "items": JsonSchema{"type": "string"}, "description": "go durations before the deadline a reminder is sent at",
+			},
+			"reminder_webhook": JsonSchema{
+				"type": "string", "format": "uri", "description": "receives the reminders, the webhook of the session by default",
+			},
+			"on_timeout": JsonSchema{"type": "string", "description": "action a waiting session continues at once the task expired, on_failure by default"},
+			"escalate_to": JsonSchema{
+				"type":        "object",
+				"description": "reassigns the expired task instead of cancelling it",
+				"properties": map[string]interface{}{
+					"assignee":         JsonSchema{"type": "string"},
+					"candidate_users":  JsonSchema{"type": "array", "items": JsonSchema{"type": "string"}},
+					"candidate_groups": JsonSchema{"type": "array", "items": JsonSchema{"type": "string"}},
+				},
+				"additionalProperties": false,
+			},
+		},
+		"not":                  JsonSchema{"required": []string{"due", "due_in"}},
+		"additionalProperties": false,
+	},
+	ReceiveMessageAction: {
+		"type":        "object",
+		"description": "waits for a message and stores its payload, continues at on_success once it arrived",
+		"required":    []string{"name"},
+		"properties": map[string]interface{}{
+			result: resultArgSchema,
+			"name": JsonSchema{"type": "string", "minLength": 1},
+			"correlation_keys": JsonSchema{
+				"type":                 "object",
+				"additionalProperties": JsonSchema{"type": "string"},
+				"description":          "keys the message has to carry, values are templates, e.g. {{input_data.order_id}}",
+			},
+		},
+		"additionalProperties": false,
+	},
+	WaitSignalAction: {
+		"type":        "object",
+		"description": "waits for a broadcast signal and stores its payload, continues at on_success once it arrived",
+		"required":    []string{"name"},
+		"properties": map[string]interface{}{
+			result: resultArgSchema,
+			"name": JsonSchema{"type": "string", "minLength": 1},
+		},
+		"additionalProperties": false,
+	},
+	CompensateAction: {
+		"type":        "object",
+		"description": "runs compensate_with of the actions executed since the last compensation, newest first, continues at on_failure when one failed",
+		"properties": map[string]interface{}{
+			result: resultArgSchema,
+		},
+		"additionalProperties": false,
+	},
+	ParallelAction: {
+		"type":        "object",
+		"description": "runs the branches one after another, each ends at the join action in on_success",
+		"required":    []string{branchesKey},
+		"properties": map[string]interface{}{
+			result:      resultArgSchema,
+			branchesKey: JsonSchema{"type": "array", "minItems": 1, "items": JsonSchema{"type": "string", "minLength": 1}},
+		},
+		"additionalProperties": false,
+	},
+	JoinAction: {
+		"type":                 "object",
+		"description":          "starts the next branch of its fork, continues at on_success once every branch reached it",
+		"additionalProperties": false,
+	},
+	CallActivityAction: {
+		"type":        "object",
+		"description": "starts a session of a called process, continues at on_success once it completed and at on_failure once it failed",
+		"required":    []string{"process"},
+		"properties": map[string]interface{}{
+			result:    resultArgSchema,
+			"process": JsonSchema{"type": "string", "minLength": 1, "description": "key of the called process"},
+			"input": JsonSchema{
+				"type":        "object",
+				"description": "input data of the called session, string values are templates, e.g. {{input_data.order_id}}",
+			},
+		},
+		"additionalProperties": false,
+	},
+	TimerAction: {
+		"type":        "object",
+		"description": "waits for a duration or until a point in time",
+		"anyOf":       []JsonSchema{{"required": []string{"duration"}}, {"required": []string{"until"}}},
+		"properties": map[string]interface{}{
+			result:     resultArgSchema,
+			"duration": JsonSchema{"type": "string", "description": "go duration or placeholder, e.g. 1h30m"},
+			"until":    JsonSchema{"type": "string", "description": "RFC3339 timestamp or placeholder"},
+		},
+		"additionalProperties": false,
+	},
+}
+
+// AddHandlerWithSchema registers a handler together with the json schema of its args, the schema is part of
+// DefinitionSchema.
+func (p *Parser) AddHandlerWithSchema(action string, handler Handler, args JsonSchema) {
+	p.AddHandler(action, handler)
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if p.argsSchemas == nil {
+		p.argsSchemas = map[string]JsonSchema{}
+	}
+	p.argsSchemas[action] = args
+}
+
+// DefinitionSchema describes the definition format, including the args of the built-in action types and of
+// handlers registered with AddHandlerWithSchema.
+func (p *Parser) DefinitionSchema() JsonSchema {
+	p.lock.Lock()
+	types := make([]string, 0, len(p.handlers))
+	for actionType := range p.handlers {
+		types = append(types, actionType)
+	}
+	argsSchemas := map[string]JsonSchema{}
+	for actionType, schema := range builtinArgsSchemas {
+		argsSchemas[actionType] = schema
+	}
+	for actionType, schema := range p.argsSchemas {
+		argsSchemas[actionType] = schema
+	}
+	p.lock.Unlock()
+	sort.Strings(types)
+
+	definitions := map[string]interface{}{
+		StartNode: JsonSchema{
+			"type":     "object",
+			"required": []string{"type", "on_success"},
+			"properties": map[string]interface{}{
+				"type": JsonSchema{"const": StartNode},
+				"args": JsonSchema{
+					"type": "object",
+					"properties": map[string]interface{}{
+						startMessageKey: JsonSchema{"type": "string", "description": "message that starts a new session"},
+					},
+				},
+				"on_success": JsonSchema{"type": "string", "minLength": 1, "description": "first action of the process"},
+				"on_failure": JsonSchema{"type": "string"},
+				"on_signal":  onSignalSchema("action a session continues at when the signal interrupts it wherever it waits"),
+				"on_error": JsonSchema{
+					"type": "string", "minLength": 1,
+					"description": "action a session continues at when a handler panics or continues at an unknown action, the session fails otherwise",
+				},
+			},
+		},
+	}
+	conditions := make([]JsonSchema, 0, len(argsSchemas))
+	for _, actionType := range sortedSchemaTypes(argsSchemas) {
+		definitions["args_"+actionType] = argsSchemas[actionType]
+		conditions = append(conditions, JsonSchema{
+			"if":   JsonSchema{"properties": JsonSchema{"type": JsonSchema{"const": actionType}}, "required": []string{"type"}},
+			"then": JsonSchema{"properties": JsonSchema{"args": JsonSchema{"$ref": "#/definitions/args_" + actionType}}},
+		})
+	}
+	definitions["action"] = JsonSchema{
+		"type":     "object",
+		"required": []string{"type", "on_success", "on_failure"},
+		"properties": map[string]interface{}{
+			"type": JsonSchema{
+				"type":        "string",
+				"minLength":   1,
+				"description": "handler that executes the action",
+				"examples":    types,
+			},
+			"args":       JsonSchema{"type": "object"},
+			"on_success": JsonSchema{"type": "string", "minLength": 1, "description": "next action, an id that is not defined ends the session"},
+			"on_failure": JsonSchema{"type": "string", "minLength": 1, "description": "next action when the handler fails"},
+			"on_signal":  onSignalSchema("action a session waiting at this action continues at when the signal interrupts it"),
+			"compensate_with": JsonSchema{
+				"type": "string", "minLength": 1, "description": "action that undoes this one, run by a compensate action",
+			},
+		},
+		"additionalProperties": false,
+		"allOf":                conditions,
+	}
+
+	return JsonSchema{
+		"$schema":     JsonSchemaDraft,
+		"$id":         DefinitionSchemaId,
+		"title":       "process definition",
+		"description": "actions keyed by their id, the process starts at start_node",
+		"type":        "object",
+		"required":    []string{StartNode},
+		"properties": map[string]interface{}{
+			StartNode: JsonSchema{"$ref": "#/definitions/" + StartNode},
+		},
+		"patternProperties": map[string]interface{}{
+			"^" + yamlExtensionPrefix: JsonSchema{"description": "shared fragments for yaml anchors, not an action"},
+		},
+		"additionalProperties": JsonSchema{"$ref": "#/definitions/action"},
+		"definitions":          definitions,
+	}
+}
+
+func onSignalSchema(description string) JsonSchema {
+	return JsonSchema{
+		"type":                 "object",
+		"description":          "signal names mapped to the " + description,
+		"additionalProperties": JsonSchema{"type": "string", "minLength": 1},
+	}
+}
+
+func sortedSchemaTypes(schemas map[string]JsonSchema) []string {
+	types := make([]string, 0, len(schemas))
+	for actionType := range schemas {
+		types = append(types, actionType)
+	}
+	sort.Strings(types)
+	return types
+}
@@ -0,0 +1,54 @@
+package parser
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/AkronimBlack/process-manager/shared"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestParser_DefinitionSchema(t *testing.T) {
+	parser := NewParser()
+	parser.AddHandlerWithSchema("notify", func(ctx context.Context, action *Action, session Session) string {
+		return action.OnSuccess
+	}, JsonSchema{"type": "object", "required": []string{"channel"}})
+
+	var schema map[string]interface{}
+	err := json.Unmarshal([]byte(shared.ToJsonString(parser.DefinitionSchema())), &schema)
+	if err != nil {
+		t.Fatal(err)
+	}
+	definitions := schema["definitions"].(map[string]interface{})
+	for _, actionType := range []string{IsGreater, IsLower, IsEqual, HttpAction, TaskAction, TimerAction, ReceiveMessageAction, WaitSignalAction, CompensateAction, ParallelAction, JoinAction, CallActivityAction, "notify"} {
+		if _, ok := definitions["args_"+actionType]; !ok {
+			t.Errorf("missing args schema of %s", actionType)
+		}
+	}
+	action := definitions["action"].(map[string]interface{})
+	types := action["properties"].(map[string]interface{})["type"].(map[string]interface{})["examples"].([]interface{})
+	if len(types) != 13 {
+		t.Errorf("expected 13 action types, got %v", types)
+	}
+	if len(action["allOf"].([]interface{})) != 13 {
+		t.Errorf("expected an args condition per action type, got %v", action["allOf"])
+	}
+}
+
+func TestParserHttpHandler_DefinitionSchema(t *testing.T) {
+	router := newTestRouter(NewParser())
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/api/schema/definition", nil))
+	if recorder.Code != http.StatusOK || recorder.Header().Get("Content-Type") != "application/schema+json" {
+		t.Fatalf("expected schema, got %d %s", recorder.Code, recorder.Header().Get("Content-Type"))
+	}
+	var schema map[string]interface{}
+	err := json.Unmarshal(recorder.Body.Bytes(), &schema)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if schema["$schema"] != JsonSchemaDraft || schema["$id"] != DefinitionSchemaId {
+		t.Errorf("unexpected schema header %v %v", schema["$schema"], schema["$id"])
+	}
+}
@@ -0,0 +1,266 @@
+package parser
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	SessionSortStarted              = "started_at"
+	SessionSortStartedDescending    = "-started_at"
+	SessionSortStatus               = "status"
+	SessionSortStatusDescending     = "-status"
+	SessionSortProcessKey           = "process_key"
+	SessionSortProcessKeyDescending = "-process_key"
+)
+
+// SessionSorts are the supported SessionQuery sort orders.
+var SessionSorts = map[string]bool{
+	SessionSortStarted:              true,
+	SessionSortStartedDescending:    true,
+	SessionSortStatus:               true,
+	SessionSortStatusDescending:     true,
+	SessionSortProcessKey:           true,
+	SessionSortProcessKeyDescending: true,
+}
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// valueOperators are tried in order, two character operators first.
+var valueOperators = []string{"!=", ">=", "<=", "=", ">", "<"}
+
+// ValuePredicate compares the session value at Key, a gjson path, with Value. Both sides are compared as numbers
+// when they are numbers, as strings otherwise. Sessions without the value never match.
+type ValuePredicate struct {
+	Key      string
+	Operator string
+	Value    string
+}
+
+// ParseValuePredicate parses <key><operator><value>, e.g. order.amount>=10, operators are =, !=, >, >=, < and <=.
+func ParseValuePredicate(predicate string) (ValuePredicate, error) {
+	for i := range predicate {
+		for _, operator := range valueOperators {
+			if strings.HasPrefix(predicate[i:], operator) {
+				if i == 0 {
+					return ValuePredicate{}, fmt.Errorf("invalid value predicate %s, expected e.g. order.amount>=10", predicate)
+				}
+				return ValuePredicate{Key: predicate[:i], Operator: operator, Value: predicate[i+len(operator):]}, nil
+			}
+		}
+	}
+	return ValuePredicate{}, fmt.Errorf("invalid value predicate %s, expected e.g. order.amount>=10", predicate)
+}
+
+func (v ValuePredicate) matches(session Session) bool {
+	value := session.ValueOf(v.Key)
+	if value == nil {
+		return false
+	}
+	actual := fmt.Sprint(value)
+	comparison := strings.Compare(actual, v.Value)
+	actualNumber, actualErr := strconv.ParseFloat(actual, 64)
+	expectedNumber, expectedErr := strconv.ParseFloat(v.Value, 64)
+	if actualErr == nil && expectedErr == nil {
+		switch {
+		case actualNumber < expectedNumber:
+			comparison = -1
+		case actualNumber > expectedNumber:
+			comparison = 1
+		default:
+			comparison = 0
+		}
+	}
+	switch v.Operator {
+	case "=":
+		return comparison == 0
+	case "!=":
+		return comparison != 0
+	case ">":
+		return comparison > 0
+	case ">=":
+		return comparison >= 0
+	case "<":
+		return comparison < 0
+	case "<=":
+		return comparison <= 0
+	}
+	return false
+}
+
+// SessionQuery filters the sessions of the parser, empty fields do not filter.
+type SessionQuery struct {
+	Status     string
+	ProcessKey string
+	// BusinessKey matches sessions with a task of the business key.
+	BusinessKey   string
+	StartedAfter  time.Time
+	StartedBefore time.Time
+	// Values have to match all.
+	Values []ValuePredicate
+	// Sort is one of SessionSorts, oldest first by default.
+	Sort string
+	// Cursor is the NextCursor of the previous page, it has to be used with the same sort.
+	Cursor string
+	// Limit of returned sessions, no limit when 0.
+	Limit int
+}
+
+// SessionPage is a page of a session query. NextCursor selects the next page, empty on the last one.
+type SessionPage struct {
+	Sessions   []Session
+	Total      int
+	NextCursor string
+}
+
+// indexedSession is a session with the position it was registered at, positions are never reused.
+type indexedSession struct {
+	session  Session
+	position uint64
+}
+
+// sessionCursor points at the last session of a page by its sort key and position.
+type sessionCursor struct {
+	Sort     string `json:"sort"`
+	Key      string `json:"key"`
+	Position uint64 `json:"position"`
+}
+
+// QuerySessions returns a page of the matching sessions and the total number of matches. Pages are selected by
+// cursor, sessions started while paging do not shift the following pages.
+func (p *Parser) QuerySessions(query SessionQuery) (SessionPage, error) {
+	page := SessionPage{Sessions: []Session{}}
+	if query.Sort == "" {
+		query.Sort = SessionSortStarted
+	}
+	if !SessionSorts[query.Sort] {
+		return page, fmt.Errorf("unknown sort %s", query.Sort)
+	}
+	var after *sessionCursor
+	if query.Cursor != "" {
+		cursor, err := decodeSessionCursor(query.Cursor)
+		if err != nil {
+			return page, err
+		}
+		if cursor.Sort != query.Sort {
+			return page, fmt.Errorf("%w, it was created for sort %s", ErrInvalidCursor, cursor.Sort)
+		}
+		after = &cursor
+	}
+
+	p.lock.Lock()
+	candidates := make([]indexedSession, 0, len(p.sessions))
+	for _, activeSession := range p.sessions {
+		candidates = append(candidates, p.sessionIndex[activeSession.Uuid()])
+	}
+	p.lock.Unlock()
+
+	matches := make([]sessionCursor, 0, len(candidates))
+	byPosition := make(map[uint64]Session, len(candidates))
+	for _, candidate := range candidates {
+		if candidate.session == nil || !query.matches(candidate.session) {
+			continue
+		}
+		matches = append(matches, sessionCursor{Sort: query.Sort, Key: sessionSortKey(candidate.session, query.Sort), Position: candidate.position})
+		byPosition[candidate.position] = candidate.session
+	}
+	descending := strings.HasPrefix(query.Sort, "-")
+	sort.Slice(matches, func(a, b int) bool {
+		return compareSessionCursors(matches[a], matches[b], descending) < 0
+	})
+
+	page.Total = len(matches)
+	if after != nil {
+		matches = matches[sort.Search(len(matches), func(i int) bool {
+			return compareSessionCursors(matches[i], *after, descending) > 0
+		}):]
+	}
+	if query.Limit > 0 && query.Limit < len(matches) {
+		matches = matches[:query.Limit]
+		page.NextCursor = encodeSessionCursor(matches[len(matches)-1])
+	}
+	for _, match := range matches {
+		page.Sessions = append(page.Sessions, byPosition[match.Position])
+	}
+	return page, nil
+}
+
+func (q SessionQuery) matches(candidate Session) bool {
+	if q.Status != "" && candidate.Status() != q.Status {
+		return false
+	}
+	if q.ProcessKey != "" && candidate.ProcessKey() != q.ProcessKey {
+		return false
+	}
+	if !q.StartedAfter.IsZero() && !candidate.Started().After(q.StartedAfter) {
+		return false
+	}
+	if !q.StartedBefore.IsZero() && !candidate.Started().Before(q.StartedBefore) {
+		return false
+	}
+	for _, predicate := range q.Values {
+		if !predicate.matches(candidate) {
+			return false
+		}
+	}
+	if q.BusinessKey != "" {
+		for _, sessionTask := range candidate.Tasks() {
+			if sessionTask.BusinessKey() == q.BusinessKey {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+// sessionSortKey is the value of the sort field as a string that sorts like the field.
+func sessionSortKey(session Session, sortOrder string) string {
+	switch strings.TrimPrefix(sortOrder, "-") {
+	case SessionSortStatus:
+		return session.Status()
+	case SessionSortProcessKey:
+		return session.ProcessKey()
+	}
+	return fmt.Sprintf("%020d", session.Started().UnixNano())
+}
+
+// compareSessionCursors orders by sort key, sessions with the same key by their position.
+func compareSessionCursors(a, b sessionCursor, descending bool) int {
+	comparison := strings.Compare(a.Key, b.Key)
+	if comparison == 0 {
+		switch {
+		case a.Position < b.Position:
+			comparison = -1
+		case a.Position > b.Position:
+			comparison = 1
+		}
+	}
+	if descending {
+		return -comparison
+	}
+	return comparison
+}
+
+func encodeSessionCursor(cursor sessionCursor) string {
+	content, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(content)
+}
+
+func decodeSessionCursor(value string) (sessionCursor, error) {
+	cursor := sessionCursor{}
+	content, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return cursor, ErrInvalidCursor
+	}
+	if err = json.Unmarshal(content, &cursor); err != nil {
+		return cursor, ErrInvalidCursor
+	}
+	return cursor, nil
+}
@@ -0,0 +1,179 @@
+package parser
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// orderParser completes orders above 100 right away, the others wait for an approval task keyed by the order id.
+func orderParser() *Parser {
+	parser := NewParser()
+	parser.SetKey("orders")
+	parser.AddHandler("record", func(ctx context.Context, action *Action, session Session) string {
+		amount := session.IntValueOf("input_data.amount", 0)
+		session.Set("order", map[string]interface{}{"amount": amount, "currency": "eur"})
+		if amount > 100 {
+			return "end"
+		}
+		return action.OnSuccess
+	})
+	parser.SetActions(Actions{
+		StartNode: {ActionType: StartNode, OnSuccess: "record"},
+		"record":  {ActionType: "record", OnSuccess: "approve", OnFailure: "end"},
+		"approve": {
+			ActionType: TaskAction,
+			Args:       Args{"id": "approve", "name": "approve", "business_key": "order-{{input_data.id}}", "wait": true},
+			OnSuccess:  "end",
+			OnFailure:  "end",
+		},
+	})
+	return parser
+}
+
+func runOrders(parser *Parser, amounts ...int) []Session {
+	sessions := make([]Session, len(amounts))
+	for i, amount := range amounts {
+		sessions[i] = parser.Run(context.Background(), map[string]interface{}{"id": i, "amount": amount}, nil)
+	}
+	return sessions
+}
+
+func TestParseValuePredicate(t *testing.T) {
+	predicate, err := ParseValuePredicate("order.amount>=10")
+	if err != nil || predicate != (ValuePredicate{Key: "order.amount", Operator: ">=", Value: "10"}) {
+		t.Errorf("expected order.amount >= 10, got %+v %v", predicate, err)
+	}
+	predicate, err = ParseValuePredicate("order.currency!=eur")
+	if err != nil || predicate.Operator != "!=" || predicate.Value != "eur" {
+		t.Errorf("expected order.currency != eur, got %+v %v", predicate, err)
+	}
+	for _, invalid := range []string{"order.amount", "=10", ""} {
+		if _, err := ParseValuePredicate(invalid); err == nil {
+			t.Errorf("expected %s rejected", invalid)
+		}
+	}
+}
+
+func TestParser_QuerySessionsFilters(t *testing.T) {
+	parser := orderParser()
+	before := time.Now()
+	sessions := runOrders(parser, 50, 150, 80)
+	if parser.Session(sessions[1].Uuid()) != sessions[1] || parser.Session("unknown") != nil {
+		t.Fatal("expected sessions looked up by uuid")
+	}
+
+	for name, test := range map[string]struct {
+		query    SessionQuery
+		expected []Session
+	}{
+		"status":         {SessionQuery{Status: StatusWaiting}, []Session{sessions[0], sessions[2]}},
+		"process key":    {SessionQuery{ProcessKey: "invoices"}, []Session{}},
+		"business key":   {SessionQuery{BusinessKey: "order-2"}, []Session{sessions[2]}},
+		"started after":  {SessionQuery{StartedAfter: before}, sessions},
+		"started before": {SessionQuery{StartedBefore: before}, []Session{}},
+		"values": {
+			SessionQuery{Values: []ValuePredicate{{Key: "order.amount", Operator: ">", Value: "60"}, {Key: "order.currency", Operator: "=", Value: "eur"}}},
+			[]Session{sessions[1], sessions[2]},
+		},
+		"missing value": {SessionQuery{Values: []ValuePredicate{{Key: "order.vat", Operator: "!=", Value: "0"}}}, []Session{}},
+		"sort":          {SessionQuery{Sort: SessionSortStartedDescending}, []Session{sessions[2], sessions[1], sessions[0]}},
+	} {
+		page, err := parser.QuerySessions(test.query)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if page.Total != len(test.expected) || len(page.Sessions) != len(test.expected) {
+			t.Errorf("%s: expected %d sessions, got %d of %d", name, len(test.expected), len(page.Sessions), page.Total)
+			continue
+		}
+		for i, expected := range test.expected {
+			if page.Sessions[i] != expected {
+				t.Errorf("%s: expected session %d to be %s, got %s", name, i, expected.Uuid(), page.Sessions[i].Uuid())
+			}
+		}
+	}
+	if _, err := parser.QuerySessions(SessionQuery{Sort: "uuid"}); err == nil {
+		t.Error("expected an unknown sort rejected")
+	}
+}
+
+func TestParser_QuerySessionsPagesByCursor(t *testing.T) {
+	parser := orderParser()
+	sessions := runOrders(parser, 1, 2, 3, 4, 5)
+
+	query := SessionQuery{Sort: SessionSortStartedDescending, Limit: 2}
+	page, err := parser.QuerySessions(query)
+	if err != nil || page.Total != 5 || len(page.Sessions) != 2 || page.Sessions[0] != sessions[4] || page.NextCursor == "" {
+		t.Fatalf("expected the 2 newest of 5 sessions, got %+v %v", page, err)
+	}
+	runOrders(parser, 6)
+	query.Cursor = page.NextCursor
+	page, err = parser.QuerySessions(query)
+	if err != nil || len(page.Sessions) != 2 || page.Sessions[0] != sessions[2] || page.Sessions[1] != sessions[1] {
+		t.Fatalf("expected the next page unaffected by the new session, got %+v %v", page, err)
+	}
+	query.Cursor = page.NextCursor
+	page, err = parser.QuerySessions(query)
+	if err != nil || len(page.Sessions) != 1 || page.Sessions[0] != sessions[0] || page.NextCursor != "" {
+		t.Fatalf("expected the oldest session on the last page, got %+v %v", page, err)
+	}
+
+	query.Sort = SessionSortStarted
+	if _, err = parser.QuerySessions(query); err == nil {
+		t.Error("expected a cursor of another sort rejected")
+	}
+	query.Cursor = "not a cursor"
+	if _, err = parser.QuerySessions(query); err == nil {
+		t.Error("expected an invalid cursor rejected")
+	}
+}
+
+func TestParserHttpHandler_GetSessions(t *testing.T) {
+	parser := orderParser()
+	sessions := runOrders(parser, 50, 150, 80)
+	router := newTestRouter(parser)
+
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/api/sessions?status=waiting&value=order.amount%3C60&limit=1", nil))
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d %s", recorder.Code, recorder.Body.String())
+	}
+	var summaries struct {
+		Items      []map[string]interface{} `json:"items"`
+		Total      int                      `json:"total"`
+		NextCursor string                   `json:"next_cursor"`
+	}
+	if err := json.Unmarshal(recorder.Body.Bytes(), &summaries); err != nil {
+		t.Fatal(err)
+	}
+	if summaries.Total != 1 || len(summaries.Items) != 1 || summaries.Items[0]["uuid"] != sessions[0].Uuid() || summaries.NextCursor != "" {
+		t.Fatalf("expected the first session, got %s", recorder.Body.String())
+	}
+	if _, ok := summaries.Items[0]["values"]; ok || summaries.Items[0]["current_action"] != "approve" {
+		t.Errorf("expected a summary, got %v", summaries.Items[0])
+	}
+
+	recorder = httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/api/sessions?fields=full&business_key=order-2", nil))
+	var full struct {
+		Items []SessionDto `json:"items"`
+	}
+	if err := json.Unmarshal(recorder.Body.Bytes(), &full); err != nil {
+		t.Fatal(err)
+	}
+	if len(full.Items) != 1 || full.Items[0].Uuid != sessions[2].Uuid() || len(full.Items[0].Tasks) != 1 {
+		t.Errorf("expected the full third session, got %s", recorder.Body.String())
+	}
+
+	for _, invalid := range []string{"fields=some", "limit=0", "sort=uuid", "value=amount", "cursor=x", "started_after=today"} {
+		recorder = httptest.NewRecorder()
+		router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/api/sessions?"+invalid, nil))
+		if recorder.Code != http.StatusUnprocessableEntity {
+			t.Errorf("expected %s rejected with 422, got %d", invalid, recorder.Code)
+		}
+	}
+}
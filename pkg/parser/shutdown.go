@@ -0,0 +1,288 @@
+package parser
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+)
+
+var ErrShuttingDown = errors.New("parser is shutting down")
+
+// drainInterval is how often Shutdown checks if the running actions finished.
+const drainInterval = 10 * time.Millisecond
+
+// SetSessionStore sets the store Shutdown checkpoints unfinished sessions to and RestoreSessions restores them from.
+func (p *Parser) SetSessionStore(store SessionStore) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.store = store
+}
+
+func (p *Parser) SessionStore() SessionStore {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	return p.store
+}
+
+// ShuttingDown reports if Shutdown was called, new sessions are rejected with ErrShuttingDown from then on.
+func (p *Parser) ShuttingDown() bool {
+	return p.stopping.Load()
+}
+
+// stoppedChannel is closed once Shutdown was called.
+func (p *Parser) stoppedChannel() chan struct{} {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if p.stopped == nil {
+		p.stopped = make(chan struct{})
+	}
+	return p.stopped
+}
+
+// Shutdown stops starting sessions and actions, ExecuteSync calls return without waiting for their session. Running
+// actions may finish until the context is done, their sessions stop at the next action. Failed webhooks are retried once, then every unfinished session is checkpointed
+// to the session store at its current action. The worker pool of the parser is closed.
+func (p *Parser) Shutdown(ctx context.Context) error {
+	if !p.stopping.Swap(true) {
+		close(p.stoppedChannel())
+	}
+	logger := p.Logger()
+	if pool := p.WorkerPool(); pool != nil {
+		pool.Close()
+	}
+	if !p.drain(ctx) {
+		logger.Warn("actions still running at the shutdown deadline", slog.Int64("running", p.running.Load()))
+	}
+	p.retryWebhooks(ctx)
+
+	store := p.SessionStore()
+	checkpointed := 0
+	var errs []error
+	for _, activeSession := range p.Sessions() {
+		switch activeSession.Status() {
+		case StatusCompleted, StatusFailed:
+			continue
+		}
+		if store == nil {
+			logger.Warn("no session store, unfinished session is lost", slog.String("session_uuid", activeSession.Uuid()))
+			continue
+		}
+		if err := store.Save(NewSessionCheckpoint(activeSession, p.Clock().Now())); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		checkpointed++
+	}
+	logger.Info("parser shut down", slog.Int("checkpointed", checkpointed))
+	return errors.Join(errs...)
+}
+
+// RestoreSessions continues the unfinished sessions checkpointed to the session store by an earlier Shutdown. A
+// session waiting for a task keeps waiting for it, the tasks of a session keep their ids and their deadlines are
+// scheduled again. A session waiting for a called process is linked to the restored called session, so the main
+// parser restores its sessions before the called processes do. Other sessions run again from their current action,
+// a session waiting for a timer, message or signal re-enters the action it waits at. Queued sessions start at the
+// first action. Checkpoints are deleted once their session is scheduled, checkpoints that could not be restored are
+// kept.
+func (p *Parser) RestoreSessions(ctx context.Context) (int, error) {
+	store := p.SessionStore()
+	if store == nil {
+		return 0, nil
+	}
+	uuids, err := store.List()
+	if err != nil {
+		return 0, err
+	}
+	restored := 0
+	var errs []error
+	for _, uuid := range uuids {
+		ok, err := p.restoreCheckpoint(ctx, store, uuid)
+		if err != nil {
+			errs = append(errs, err)
+		}
+		if ok {
+			restored++
+		}
+	}
+	return restored, errors.Join(errs...)
+}
+
+// restoreCheckpoint restores the session of a checkpoint and deletes the checkpoint, false when the session was not
+// restored or the checkpoint belongs to another process or a finished session.
+func (p *Parser) restoreCheckpoint(ctx context.Context, store SessionStore, uuid string) (bool, error) {
+	checkpoint, err := store.Load(uuid)
+	if err != nil {
+		return false, err
+	}
+	if checkpoint.ProcessKey != "" && checkpoint.ProcessKey != p.Key() {
+		return false, nil
+	}
+	switch checkpoint.Status {
+	case StatusCompleted, StatusFailed:
+		return false, nil
+	}
+	restoredSession, err := NewSessionFromCheckpoint(checkpoint)
+	if err != nil {
+		return false, err
+	}
+	if err := p.restoreSession(ctx, restoredSession); err != nil {
+		return false, fmt.Errorf("restore session %s: %w", uuid, err)
+	}
+	return true, store.Delete(uuid)
+}
+
+// restoreSession indexes the session and parks it again when it waits for a task or a called session, otherwise it
+// runs from its current action on the worker pool, if any.
+func (p *Parser) restoreSession(ctx context.Context, restoredSession Session) error {
+	if p.ShuttingDown() {
+		return ErrShuttingDown
+	}
+	actionId := restoredSession.CurrentAction()
+	if actionId == "" {
+		startAction := p.Actions()[StartNode]
+		if startAction == nil {
+			return ErrNoStartNode
+		}
+		actionId = startAction.OnSuccess
+	}
+	if p.rewait(ctx, restoredSession, actionId) {
+		return nil
+	}
+	run := func() {
+		p.runActionById(p.startSessionSpan(ctx, restoredSession), actionId, restoredSession)
+	}
+	pool := p.WorkerPool()
+	if pool == nil {
+		restoredSession.SetStatus(StatusRunning)
+		p.indexRestored(restoredSession, actionId)
+		go run()
+		return nil
+	}
+	restoredSession.SetStatus(StatusQueued)
+	registered := make(chan struct{})
+	err := pool.submit(poolJob{
+		processKey: p.Key(),
+		priority:   PriorityFromContext(ctx),
+		run: func() {
+			<-registered
+			restoredSession.SetStatus(StatusRunning)
+			run()
+		},
+	})
+	if err != nil {
+		return err
+	}
+	p.indexRestored(restoredSession, actionId)
+	close(registered)
+	return nil
+}
+
+// rewait parks a restored session waiting at the action again without running the action, when it waits for a
+// pending task created there or for a called session that was restored.
+func (p *Parser) rewait(ctx context.Context, restoredSession Session, actionId string) bool {
+	action := p.Actions()[actionId]
+	if action == nil || restoredSession.Status() != StatusWaiting {
+		return false
+	}
+	switch action.ActionType {
+	case TaskAction:
+		if !waitsForTask(restoredSession, actionId) {
+			return false
+		}
+	case CallActivityAction:
+		if !p.restoreCalledSession(ctx, action, restoredSession) {
+			return false
+		}
+	default:
+		return false
+	}
+	p.indexRestored(restoredSession, actionId)
+	sessionCtx := p.startSessionSpan(ctx, restoredSession)
+	if next, ok := p.suspend(sessionCtx, restoredSession, actionId); ok {
+		p.resumeQueued(sessionCtx, restoredSession, next, runInBackground)
+	}
+	return true
+}
+
+// waitsForTask reports if the session waits for a pending task the action created.
+func waitsForTask(session Session, actionId string) bool {
+	for _, sessionTask := range session.Tasks() {
+		if sessionTask.ActionId() == actionId && sessionTask.Next() != "" && TaskPending(sessionTask) {
+			return true
+		}
+	}
+	return false
+}
+
+// indexRestored adds the restored session and its tasks to the parser and schedules the deadlines of its pending
+// tasks, resolved from the task actions again.
+func (p *Parser) indexRestored(restoredSession Session, actionId string) {
+	p.indexSession(restoredSession)
+	for _, sessionTask := range restoredSession.Tasks() {
+		restoredTask, ok := sessionTask.(*task)
+		if !ok || !TaskPending(restoredTask) {
+			continue
+		}
+		if action := p.Actions()[restoredTask.ActionId()]; action != nil && action.ActionType == TaskAction {
+			taskArgs := TaskArgs{}
+			if action.Args.Bind(&taskArgs) == nil {
+				if deadline, err := taskArgs.deadline(action, restoredSession, restoredTask.Created()); err == nil {
+					restoredTask.deadline = deadline
+				}
+			}
+		}
+	}
+	p.tasks.sync(restoredSession)
+	for _, sessionTask := range restoredSession.Tasks() {
+		if TaskPending(sessionTask) {
+			p.scheduleDeadline(sessionTask)
+		}
+	}
+	p.sessionLogger(restoredSession).Info("session restored",
+		slog.String("action_id", actionId),
+		slog.String("status", restoredSession.Status()),
+	)
+}
+
+// drain waits until no session executes an action, false when the context was done first.
+func (p *Parser) drain(ctx context.Context) bool {
+	ticker := time.NewTicker(drainInterval)
+	defer ticker.Stop()
+	for p.running.Load() > 0 {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return false
+		}
+	}
+	return true
+}
+
+// failWebhook remembers a session whose webhook was not delivered.
+func (p *Parser) failWebhook(session Session) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.failedWebhooks = append(p.failedWebhooks, session)
+}
+
+// retryWebhooks delivers the failed webhooks again, sessions whose webhook fails again are kept.
+func (p *Parser) retryWebhooks(ctx context.Context) {
+	p.lock.Lock()
+	failed := p.failedWebhooks
+	p.failedWebhooks = nil
+	p.lock.Unlock()
+	for _, failedSession := range failed {
+		if ctx.Err() != nil {
+			p.failWebhook(failedSession)
+			continue
+		}
+		response, deliveryResult := p.postWebhook(ctx, failedSession, failedSession.OnFinishWebhook().Url(), NewSessionDto(failedSession))
+		failedSession.SetOnFinishWebhookResponse(response)
+		p.metrics.WebhookDelivered(deliveryResult)
+		if deliveryResult != WebhookResultSuccess {
+			p.failWebhook(failedSession)
+		}
+	}
+}
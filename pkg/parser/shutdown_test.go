@@ -0,0 +1,280 @@
+package parser
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestParser_ShutdownCheckpointsUnfinishedSessions(t *testing.T) {
+	store, err := NewFileSessionStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	gate, started := make(chan struct{}), make(chan string, 1)
+	parser := NewParser()
+	parser.SetSessionStore(store)
+	// only the second order is held at the gate until the shutdown started
+	parser.AddHandler("gate", func(ctx context.Context, action *Action, session Session) string {
+		if session.StringValueOf("input_data.order_id", "") == "2" {
+			started <- session.Uuid()
+			<-gate
+		}
+		return action.OnSuccess
+	})
+	actions := paymentActions("")
+	actions[StartNode].OnSuccess = "gate"
+	actions["gate"] = &Action{ActionType: "gate", OnSuccess: "payment", OnFailure: "end"}
+	parser.SetActions(actions)
+
+	waiting := parser.Run(context.Background(), map[string]interface{}{"order_id": "1"}, nil)
+	if waiting.Status() != StatusWaiting {
+		t.Fatalf("expected a waiting session, got %s", waiting.Status())
+	}
+	go parser.Run(context.Background(), map[string]interface{}{"order_id": "2"}, nil)
+	runningUuid := waitStarted(t, started)
+
+	done := make(chan error)
+	go func() { done <- parser.Shutdown(context.Background()) }()
+	for !parser.ShuttingDown() {
+		time.Sleep(time.Millisecond)
+	}
+	close(gate)
+	select {
+	case err = <-done:
+	case <-time.After(time.Second):
+		t.Fatal("expected shutdown to finish once the running action finished")
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	checkpoint, err := store.Load(waiting.Uuid())
+	if err != nil || checkpoint.Status != StatusWaiting || checkpoint.CurrentAction != "payment" {
+		t.Errorf("expected the waiting session checkpointed at payment, got %+v %v", checkpoint, err)
+	}
+	checkpoint, err = store.Load(runningUuid)
+	if err != nil || checkpoint.Status != StatusRunning || checkpoint.CurrentAction != "payment" {
+		t.Errorf("expected the running session stopped at payment, got %+v %v", checkpoint, err)
+	}
+}
+
+func TestParser_RestoreSessionsContinuesCheckpoints(t *testing.T) {
+	store, err := NewFileSessionStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	parser := NewParser()
+	parser.SetSessionStore(store)
+	parser.SetActions(paymentActions(""))
+	waiting := parser.Run(context.Background(), map[string]interface{}{"order_id": "1"}, nil)
+	if err := parser.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	restarted := NewParser()
+	restarted.SetSessionStore(store)
+	restarted.SetActions(paymentActions(""))
+	restored, err := restarted.RestoreSessions(context.Background())
+	if err != nil || restored != 1 {
+		t.Fatalf("expected one restored session, got %d %v", restored, err)
+	}
+	session := restarted.Session(waiting.Uuid())
+	if session == nil {
+		t.Fatal("expected the session restored with its uuid")
+	}
+	waitStatus(t, session, StatusWaiting)
+	if uuids, err := store.List(); err != nil || len(uuids) != 0 {
+		t.Errorf("expected the checkpoint deleted, got %v %v", uuids, err)
+	}
+
+	_, err = restarted.RunMessage(context.Background(), Message{
+		Name:            "payment_received",
+		CorrelationKeys: map[string]string{"order_id": "1"},
+		Payload:         map[string]interface{}{"amount": 20},
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if session.Status() != StatusCompleted || session.ValueOf("paid") != true {
+		t.Errorf("expected the restored session paid and completed, got %s %v", session.Status(), session.ValueOf("paid"))
+	}
+	if !session.Started().Equal(waiting.Started()) {
+		t.Errorf("expected the start of the session restored, got %s", session.Started())
+	}
+}
+
+func TestParser_ShutdownRejectsSessions(t *testing.T) {
+	parser := NewParser()
+	parser.SetActions(paymentActions("order_placed"))
+	parser.SetWorkerPool(NewWorkerPool(WorkerPoolOptions{Workers: 1}))
+	if err := parser.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := parser.Enqueue(context.Background(), map[string]interface{}{}, nil); !errors.Is(err, ErrShuttingDown) {
+		t.Errorf("expected the session rejected, got %v", err)
+	}
+	if _, err := parser.RunMessage(context.Background(), Message{Name: "order_placed"}, nil); !errors.Is(err, ErrShuttingDown) {
+		t.Errorf("expected the start message rejected, got %v", err)
+	}
+	if len(parser.Sessions()) != 0 {
+		t.Errorf("expected no sessions, got %d", len(parser.Sessions()))
+	}
+}
+
+func TestParser_ShutdownRetriesFailedWebhooks(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+
+	parser := NewParser()
+	parser.SetActions(Actions{StartNode: {ActionType: StartNode, OnSuccess: "end"}})
+	session := parser.Run(context.Background(), map[string]interface{}{}, NewWebHook(server.URL))
+	if session.OnFinishWebhookResponse()["status_code"] != http.StatusServiceUnavailable {
+		t.Fatalf("expected the webhook rejected, got %v", session.OnFinishWebhookResponse())
+	}
+	if err := parser.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if calls != 2 || session.OnFinishWebhookResponse()["status_code"] != http.StatusOK {
+		t.Errorf("expected the webhook delivered on retry, got %d calls %v", calls, session.OnFinishWebhookResponse())
+	}
+	if len(parser.failedWebhooks) != 0 {
+		t.Errorf("expected no failed webhooks left, got %d", len(parser.failedWebhooks))
+	}
+}
+
+func TestParser_RestoreSessionsKeepsTasks(t *testing.T) {
+	store, err := NewFileSessionStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	actions := Actions{
+		StartNode: {ActionType: StartNode, OnSuccess: "approve"},
+		"approve": {ActionType: TaskAction, Args: Args{"id": "approve", "name": "approve", "wait": true, "due_in": "1h"}, OnSuccess: "end", OnFailure: "end"},
+	}
+	parser := NewParser()
+	parser.SetSessionStore(store)
+	parser.SetActions(actions)
+	waiting := parser.Run(context.Background(), map[string]interface{}{}, nil)
+	taskId := waiting.Tasks()[0].ID()
+	if err := parser.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	restarted := NewParser()
+	restarted.SetSessionStore(store)
+	restarted.SetActions(actions)
+	if restored, err := restarted.RestoreSessions(context.Background()); err != nil || restored != 1 {
+		t.Fatalf("expected one restored session, got %d %v", restored, err)
+	}
+	session := restarted.Session(waiting.Uuid())
+	if session.Status() != StatusWaiting || len(session.Tasks()) != 1 {
+		t.Fatalf("expected the session waiting for its task, got %s with %d tasks", session.Status(), len(session.Tasks()))
+	}
+	tasks := restarted.TaskIndex().Find(taskId)
+	if len(tasks) != 1 {
+		t.Fatalf("expected the task restored with its id, got %d", len(tasks))
+	}
+	if deadline := tasks[0].Deadline(); !deadline.Due.Equal(waiting.Tasks()[0].Deadline().Due) || deadline.OnTimeout != "end" {
+		t.Errorf("expected the deadline restored, got %+v", deadline)
+	}
+	if err := restarted.RunTask(context.Background(), tasks[0], map[string]interface{}{"approved": true}); err != nil {
+		t.Fatal(err)
+	}
+	if session.Status() != StatusCompleted || session.InputData()["approved"] != true {
+		t.Errorf("expected the session completed with the task payload, got %s %v", session.Status(), session.InputData())
+	}
+}
+
+func TestParser_RestoreSessionsReturnsFromCalledSessions(t *testing.T) {
+	dir := t.TempDir()
+	billingActions := Actions{
+		StartNode: {ActionType: StartNode, OnSuccess: "approve"},
+		"approve": {ActionType: TaskAction, Args: Args{"id": "approve", "name": "approve", "wait": true}, OnSuccess: "end", OnFailure: "end"},
+	}
+	start := func() (*Parser, *Parser) {
+		billing := billingParser(billingActions)
+		parser := callingParser("billing", billing)
+		for _, p := range []*Parser{parser, billing} {
+			store, err := NewFileSessionStore(dir + "/" + p.Key())
+			if err != nil {
+				t.Fatal(err)
+			}
+			p.SetSessionStore(store)
+		}
+		return parser, billing
+	}
+	parser, billing := start()
+	caller := parser.Run(context.Background(), map[string]interface{}{"id": 7}, nil)
+	for deadline := time.Now().Add(time.Second); len(billing.Sessions()) == 0 && time.Now().Before(deadline); {
+		time.Sleep(time.Millisecond)
+	}
+	if len(billing.Sessions()) != 1 {
+		t.Fatalf("expected a billing session, got %d", len(billing.Sessions()))
+	}
+	called := billing.Sessions()[0]
+	waitStatus(t, called, StatusWaiting)
+	taskId := called.Tasks()[0].ID()
+	for _, p := range []*Parser{parser, billing} {
+		if err := p.Shutdown(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	parser, billing = start()
+	if restored, err := parser.RestoreSessions(context.Background()); err != nil || restored != 1 {
+		t.Fatalf("expected the caller restored, got %d %v", restored, err)
+	}
+	if restored, err := billing.RestoreSessions(context.Background()); err != nil || restored != 0 {
+		t.Fatalf("expected the called session restored with its caller, got %d %v", restored, err)
+	}
+	if len(billing.Sessions()) != 1 || billing.Sessions()[0].Uuid() != called.Uuid() {
+		t.Fatalf("expected the called session restored instead of a new one, got %d", len(billing.Sessions()))
+	}
+	tasks := billing.TaskIndex().Find(taskId)
+	if len(tasks) != 1 {
+		t.Fatalf("expected the called task restored, got %d", len(tasks))
+	}
+	if err := billing.RunTask(context.Background(), tasks[0], map[string]interface{}{}); err != nil {
+		t.Fatal(err)
+	}
+	session := parser.Session(caller.Uuid())
+	waitStatus(t, session, StatusCompleted)
+	if session.Values()["outcome"] != "billed" {
+		t.Errorf("expected the caller to continue at on_success, got %v", session.Values()["outcome"])
+	}
+}
+
+func TestParser_ShutdownEndsExecuteSync(t *testing.T) {
+	gate, started := make(chan struct{}), make(chan string, 1)
+	parser := gatedParser("orders", gate, started)
+	returned := make(chan bool)
+	go func() {
+		_, finished, _ := parser.ExecuteSync(context.Background(), map[string]interface{}{}, nil, time.Minute)
+		returned <- finished
+	}()
+	waitStarted(t, started)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := parser.Shutdown(ctx); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case finished := <-returned:
+		if finished {
+			t.Error("expected the session not finished")
+		}
+	case <-time.After(time.Second):
+		t.Error("expected ExecuteSync to return once the shutdown started")
+	}
+	close(gate)
+}
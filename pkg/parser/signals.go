@@ -0,0 +1,202 @@
+package parser
+
+import (
+	"context"
+	"log/slog"
+	"sort"
+)
+
+// signalValue is the session value an interrupting signal is stored under.
+const signalValue = "signal"
+
+// SignalBroadcast holds the sessions a signal resumed at a wait_signal action or interrupted.
+type SignalBroadcast struct {
+	Resumed     []Session
+	Interrupted []Session
+}
+
+type WaitSignalArgs struct {
+	ResultArgs
+	Name string `json:"name"`
+}
+
+// interruption is a session a signal interrupted and the action it continues at.
+type interruption struct {
+	ctx     context.Context
+	session Session
+	next    string
+}
+
+// pendingSignal interrupts a running session before it executes its next action or waits.
+type pendingSignal struct {
+	name    string
+	payload map[string]interface{}
+	next    string
+}
+
+// WaitSignalHandler parks the session until the signal is broadcast, see BroadcastSignal. The signal payload is
+// stored in the result and the process continues at on_success.
+func (p *Parser) WaitSignalHandler(ctx context.Context, action *Action, session Session) string {
+	signalArgs := WaitSignalArgs{}
+	err := action.Args.Bind(&signalArgs)
+	if err == nil && signalArgs.Name == "" {
+		err = ErrSignalNameRequired
+	}
+	if err != nil {
+		AddActionError(session, signalArgs.ResultVariableAsError(action.ActionType), err)
+		session.AddExecutedAction(waitSignalExecutedAction(*action, signalArgs.Name))
+		return action.OnFailure
+	}
+	session.AddExecutedAction(waitSignalExecutedAction(*action, signalArgs.Name))
+	session.SetStatus(StatusWaiting)
+	p.lock.Lock()
+	p.signalWaits = append(p.signalWaits, subscription{
+		name:     signalArgs.Name,
+		session:  session,
+		actionId: action.ID,
+		next:     action.OnSuccess,
+		result:   signalArgs.ResultVariable(action.ActionType),
+	})
+	p.lock.Unlock()
+	LoggerFromContext(ctx).Info("waiting for signal", slog.String("signal", signalArgs.Name))
+	return ""
+}
+
+func waitSignalExecutedAction(action Action, name string) *executedAction {
+	return &executedAction{
+		Action: action,
+		Params: map[string]interface{}{
+			"name": name,
+		},
+	}
+}
+
+// BroadcastSignal resumes every session waiting for the signal at a wait_signal action and interrupts the other
+// sessions with a boundary for it, see Action.OnSignal. Waiting sessions continue in the background, on the worker
+// pool when the parser has one, running ones are interrupted once the action they execute returned.
+func (p *Parser) BroadcastSignal(name string, payload map[string]interface{}) SignalBroadcast {
+	return p.broadcastSignal(name, payload, false)
+}
+
+// RunSignal broadcasts the signal like BroadcastSignal and continues the sessions on the calling goroutine until
+// they finish or wait again.
+func (p *Parser) RunSignal(name string, payload map[string]interface{}) SignalBroadcast {
+	return p.broadcastSignal(name, payload, true)
+}
+
+func (p *Parser) broadcastSignal(name string, payload map[string]interface{}, sync bool) SignalBroadcast {
+	if payload == nil {
+		payload = map[string]interface{}{}
+	}
+	broadcast := SignalBroadcast{Resumed: make([]Session, 0), Interrupted: make([]Session, 0)}
+	resumed := map[Session]bool{}
+	for _, waiting := range p.takeSubscriptions(&p.signalWaits, Message{Name: name}) {
+		waiting := waiting
+		waiting.session.Set(waiting.result, payload)
+		p.sessionLogger(waiting.session).Info("signal received", slog.String("signal", name))
+		resumed[waiting.session] = true
+		broadcast.Resumed = append(broadcast.Resumed, waiting.session)
+		if sync {
+			p.wake(waiting.session, waiting.actionId, waiting.next)
+		} else {
+			p.wakeQueued(waiting.session, waiting.actionId, waiting.next, runInBackground)
+		}
+	}
+	interrupted, running := p.interrupt(name, payload, resumed)
+	for _, suspended := range interrupted {
+		suspended := suspended
+		broadcast.Interrupted = append(broadcast.Interrupted, suspended.session)
+		if sync {
+			p.runActionById(suspended.ctx, suspended.next, suspended.session)
+		} else {
+			p.resumeQueued(suspended.ctx, suspended.session, suspended.next, runInBackground)
+		}
+	}
+	broadcast.Interrupted = append(broadcast.Interrupted, running...)
+	return broadcast
+}
+
+// interrupt resumes the suspended sessions with a boundary for the signal, except the skipped ones, and records the
+// signal for the running sessions with a boundary at their current action. Interrupted sessions drop their pending
+// tasks and their message and signal subscriptions.
+func (p *Parser) interrupt(name string, payload map[string]interface{}, skip map[Session]bool) ([]interruption, []Session) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	running := make([]Session, 0)
+	for _, activeSession := range p.sessions {
+		if activeSession.Status() != StatusRunning || skip[activeSession] {
+			continue
+		}
+		next, ok := p.signalBoundary(activeSession.CurrentAction(), name)
+		if !ok {
+			continue
+		}
+		if p.interruptions == nil {
+			p.interruptions = map[string]pendingSignal{}
+		}
+		p.interruptions[activeSession.Uuid()] = pendingSignal{name: name, payload: payload, next: next}
+		running = append(running, activeSession)
+	}
+	uuids := make([]string, 0, len(p.suspended))
+	for uuid := range p.suspended {
+		uuids = append(uuids, uuid)
+	}
+	sort.Strings(uuids)
+	interrupted := make([]interruption, 0)
+	for _, uuid := range uuids {
+		suspended := p.suspended[uuid]
+		if skip[suspended.session] {
+			continue
+		}
+		next, ok := p.signalBoundary(suspended.actionId, name)
+		if !ok {
+			continue
+		}
+		ctx := p.resume(context.Background(), suspended.session)
+		p.applySignal(suspended.session, pendingSignal{name: name, payload: payload, next: next})
+		interrupted = append(interrupted, interruption{ctx: ctx, session: suspended.session, next: next})
+	}
+	return interrupted, running
+}
+
+// takeInterruption returns the action a running session continues at when a signal interrupted it.
+func (p *Parser) takeInterruption(session Session) (string, bool) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	return p.interruption(session)
+}
+
+// interruption applies the signal recorded for the running session, if any. The caller must hold the parser lock.
+func (p *Parser) interruption(session Session) (string, bool) {
+	signal, ok := p.interruptions[session.Uuid()]
+	if !ok {
+		return "", false
+	}
+	delete(p.interruptions, session.Uuid())
+	p.applySignal(session, signal)
+	return signal.next, true
+}
+
+// applySignal stores the signal on the interrupted session, cancels the tasks it waits for and drops its
+// subscriptions. The
+// caller must hold the parser lock.
+func (p *Parser) applySignal(session Session, signal pendingSignal) {
+	p.unsubscribe(session)
+	cancelWaitingTasks(session)
+	session.Set(signalValue, map[string]interface{}{"name": signal.name, "payload": signal.payload})
+	p.sessionLogger(session).Info("session interrupted by signal",
+		slog.String("signal", signal.name),
+		slog.String("next", signal.next),
+	)
+}
+
+// signalBoundary returns where a session waiting at actionId continues on the signal, the boundary of the action
+// takes precedence over the one of the start_node. The caller must hold the parser lock.
+func (p *Parser) signalBoundary(actionId, name string) (string, bool) {
+	for _, id := range []string{actionId, StartNode} {
+		if action := p.actions[id]; action != nil && action.OnSignal[name] != "" {
+			return action.OnSignal[name], true
+		}
+	}
+	return "", false
+}
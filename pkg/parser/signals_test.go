@@ -0,0 +1,128 @@
+package parser
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func supplierActions() Actions {
+	return Actions{
+		StartNode: {ActionType: StartNode, OnSuccess: "route", OnSignal: map[string]string{"shutdown": "end"}},
+		"route": {
+			ActionType: IsEqual,
+			Args:       Args{comparingKey: "{{input_data.route}}", compareToKey: "1"},
+			OnSuccess:  "order",
+			OnFailure:  "end",
+		},
+		"order": {
+			ActionType: TaskAction,
+			Args:       Args{"id": "order", "name": "order from supplier", "wait": true},
+			OnSuccess:  "end",
+			OnFailure:  "end",
+			OnSignal:   map[string]string{"supplier_down": "fallback"},
+		},
+		"fallback": {
+			ActionType: WaitSignalAction,
+			Args:       Args{"name": "supplier_up", result: "recovery"},
+			OnSuccess:  "end",
+			OnFailure:  "end",
+		},
+	}
+}
+
+func TestParser_RunSignalInterruptsAndResumesSessions(t *testing.T) {
+	parser := NewParser()
+	parser.SetActions(supplierActions())
+	session := parser.Run(context.Background(), map[string]interface{}{}, nil)
+	other := parser.Run(context.Background(), map[string]interface{}{}, nil)
+
+	broadcast := parser.RunSignal("supplier_down", map[string]interface{}{"supplier": "acme"})
+	if len(broadcast.Interrupted) != 2 || len(broadcast.Resumed) != 0 {
+		t.Fatalf("expected 2 interrupted sessions, got %d interrupted and %d resumed", len(broadcast.Interrupted), len(broadcast.Resumed))
+	}
+	if session.Status() != StatusWaiting || session.Task("order").Status() != TaskStatusCancelled {
+		t.Errorf("expected session waiting at the fallback with a cancelled task, got %s", session.Status())
+	}
+	if session.StringValueOf("values.signal.payload.supplier", "") != "acme" {
+		t.Errorf("expected signal payload stored, got %v", session.ValueOf("signal"))
+	}
+	if broadcast = parser.RunSignal("supplier_down", nil); len(broadcast.Interrupted) != 0 {
+		t.Errorf("expected sessions at the fallback not to be interrupted again, got %d", len(broadcast.Interrupted))
+	}
+
+	broadcast = parser.RunSignal("supplier_up", map[string]interface{}{"delay": 2})
+	if len(broadcast.Resumed) != 2 || session.Status() != StatusCompleted || other.Status() != StatusCompleted {
+		t.Errorf("expected both sessions resumed and completed, got %d %s %s", len(broadcast.Resumed), session.Status(), other.Status())
+	}
+	if session.StringValueOf("values.recovery.delay", "") != "2" {
+		t.Errorf("expected signal payload in the result, got %v", session.ValueOf("recovery"))
+	}
+}
+
+func TestParser_RunSignalStartNodeBoundary(t *testing.T) {
+	parser := NewParser()
+	parser.SetActions(supplierActions())
+	session := parser.Run(context.Background(), map[string]interface{}{}, nil)
+	parser.RunSignal("supplier_down", nil)
+
+	broadcast := parser.RunSignal("shutdown", nil)
+	if len(broadcast.Interrupted) != 1 || session.Status() != StatusCompleted {
+		t.Fatalf("expected the start_node boundary to end the session, got %s", session.Status())
+	}
+	if broadcast = parser.RunSignal("supplier_up", nil); len(broadcast.Resumed) != 0 {
+		t.Errorf("expected the interrupted wait_signal to be dropped, got %d resumed", len(broadcast.Resumed))
+	}
+}
+
+func TestParser_BroadcastSignalInterruptsRunningSessions(t *testing.T) {
+	gate, started := make(chan struct{}), make(chan string, 1)
+	parser := gatedParser("orders", gate, started)
+	parser.AddHandler("mark", func(ctx context.Context, action *Action, session Session) string {
+		session.Set(action.ID, true)
+		return action.OnSuccess
+	})
+	parser.SetActions(Actions{
+		StartNode:   {ActionType: StartNode, OnSuccess: "gate"},
+		"gate":      {ActionType: "gate", OnSuccess: "shipped", OnFailure: "end", OnSignal: map[string]string{"cancel": "cancelled"}},
+		"shipped":   {ActionType: "mark", OnSuccess: "end", OnFailure: "end"},
+		"cancelled": {ActionType: "mark", OnSuccess: "end", OnFailure: "end"},
+	})
+	done := make(chan Session)
+	go func() {
+		done <- parser.Run(context.Background(), map[string]interface{}{}, nil)
+	}()
+	waitStarted(t, started)
+
+	broadcast := parser.BroadcastSignal("cancel", map[string]interface{}{"reason": "fraud"})
+	if len(broadcast.Interrupted) != 1 {
+		t.Fatalf("expected the running session interrupted, got %d", len(broadcast.Interrupted))
+	}
+	close(gate)
+	session := <-done
+	if session.Status() != StatusCompleted || session.Values()["cancelled"] != true || session.Values()["shipped"] != nil {
+		t.Errorf("expected the session to continue at the boundary, got %s %v", session.Status(), session.Values())
+	}
+	if session.StringValueOf("values.signal.payload.reason", "") != "fraud" {
+		t.Errorf("expected signal payload stored, got %v", session.ValueOf("signal"))
+	}
+}
+
+func TestParserHttpHandler_BroadcastSignal(t *testing.T) {
+	parser := NewParser()
+	parser.SetActions(supplierActions())
+	session := parser.Run(context.Background(), map[string]interface{}{}, nil)
+	router := newTestRouter(parser)
+
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/api/signals/supplier_down", nil))
+	var broadcast SignalBroadcastDto
+	if err := json.Unmarshal(recorder.Body.Bytes(), &broadcast); err != nil || recorder.Code != http.StatusAccepted {
+		t.Fatalf("expected accepted signal, got %d %s", recorder.Code, recorder.Body.String())
+	}
+	if len(broadcast.Interrupted) != 1 || broadcast.Interrupted[0] != session.Uuid() {
+		t.Errorf("expected session %s interrupted, got %v", session.Uuid(), broadcast.Interrupted)
+	}
+}
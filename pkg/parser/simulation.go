@@ -0,0 +1,230 @@
+package parser
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+
+	"github.com/AkronimBlack/process-manager/shared"
+)
+
+const (
+	MockOutcomeSuccess = "success"
+	MockOutcomeFailure = "failure"
+)
+
+var ErrNotMocked = errors.New("action is not mocked in the simulation scenario")
+
+// Scenario describes a dry run of the loaded process definition.
+type Scenario struct {
+	Name string                 `json:"name"`
+	Data map[string]interface{} `json:"data"`
+	// Mocks replace the handler of actions, keyed by action id or action type. An action id takes precedence.
+	Mocks map[string]Mock `json:"mocks"`
+	// Tasks holds the completion payloads of tasks, keyed by task id, business key, definition key or task name.
+	Tasks  TaskCompletions `json:"tasks"`
+	Expect Expectation     `json:"expect"`
+}
+
+// Mock is the response of a mocked action.
+type Mock struct {
+	// Outcome selects the transition taken, success (default) or failure. Next overrides it with an action id.
+	Outcome string                 `json:"outcome"`
+	Next    string                 `json:"next"`
+	Result  interface{}            `json:"result"`
+	Values  map[string]interface{} `json:"values"`
+}
+
+// Expectation is asserted against the simulated session. Empty fields are not checked.
+type Expectation struct {
+	Status  string                 `json:"status"`
+	Visited []string               `json:"visited"`
+	Values  map[string]interface{} `json:"values"`
+}
+
+type SimulationResult struct {
+	Scenario string     `json:"scenario"`
+	Visited  []string   `json:"visited"`
+	Failures []string   `json:"failures"`
+	Session  SessionDto `json:"session"`
+}
+
+func (r SimulationResult) Passed() bool {
+	return len(r.Failures) == 0
+}
+
+// LoadScenarios reads a json file holding a single scenario or a list of scenarios.
+func LoadScenarios(location string) ([]Scenario, error) {
+	file, err := os.ReadFile(location)
+	if err != nil {
+		return nil, err
+	}
+	file = bytes.TrimSpace(file)
+	if bytes.HasPrefix(file, []byte("[")) {
+		var scenarios []Scenario
+		err = json.Unmarshal(file, &scenarios)
+		return scenarios, err
+	}
+	var scenario Scenario
+	err = json.Unmarshal(file, &scenario)
+	return []Scenario{scenario}, err
+}
+
+// Simulate runs the loaded definition with mocked handlers and checks the scenario expectations.
+// Simulated sessions are not registered with the parser and never send webhooks. Http actions
+// without a mock take on_failure instead of calling the real endpoint and timers fire right away. Tasks with a
+// deadline and without a payload expire.
+func (p *Parser) Simulate(ctx context.Context, scenario Scenario) SimulationResult {
+	simulation := p.simulationParser(scenario.Mocks)
+	data := scenario.Data
+	if data == nil {
+		data = map[string]interface{}{}
+	}
+	result := SimulationResult{Scenario: scenario.Name, Failures: []string{}}
+
+	session := simulation.Run(ctx, data, nil)
+	expired := map[Task]bool{}
+	for session.Status() == StatusWaiting {
+		task := FirstOpenTask(session)
+		if task == nil {
+			break
+		}
+		payload, ok := scenario.Tasks.For(task)
+		if !ok && !task.Deadline().Due.IsZero() && !expired[task] {
+			expired[task] = true
+			simulation.expireTask(task)
+			continue
+		}
+		if !ok {
+			result.Failures = append(result.Failures, fmt.Sprintf("no payload for task %s (%s)", task.DefinitionKey(), task.Name()))
+			break
+		}
+		err := simulation.RunTask(ContextWithTaskUser(ctx, TaskOwner(task)), task, payload)
+		if err != nil {
+			result.Failures = append(result.Failures, err.Error())
+			break
+		}
+	}
+
+	result.Session = NewSessionDto(session)
+	result.Visited = VisitedActions(session)
+	result.Failures = append(result.Failures, scenario.Expect.check(session, result.Visited)...)
+	return result
+}
+
+func (e Expectation) check(session Session, visited []string) []string {
+	failures := make([]string, 0)
+	if e.Status != "" && e.Status != session.Status() {
+		failures = append(failures, fmt.Sprintf("expected status %s, got %s", e.Status, session.Status()))
+	}
+	if e.Visited != nil && !reflect.DeepEqual(e.Visited, visited) {
+		failures = append(failures, fmt.Sprintf(
+			"expected visited actions [%s], got [%s]",
+			strings.Join(e.Visited, ", "), strings.Join(visited, ", "),
+		))
+	}
+	for key, expected := range e.Values {
+		var normalized interface{}
+		_ = json.Unmarshal(shared.ToJsonByte(expected), &normalized)
+		actual := session.ValueOf(key)
+		if !reflect.DeepEqual(normalized, actual) {
+			failures = append(failures, fmt.Sprintf(
+				"expected value %s to be %s, got %s",
+				key, shared.ToJsonString(expected), shared.ToJsonString(actual),
+			))
+		}
+	}
+	return failures
+}
+
+func (p *Parser) simulationParser(mocks map[string]Mock) *Parser {
+	handlers := make(map[string]Handler, len(p.handlers))
+	for actionType, handler := range p.handlers {
+		handlers[actionType] = mockHandler(handler, mocks)
+	}
+	for id, action := range p.Actions() {
+		_, mockedId := mocks[id]
+		_, mockedType := mocks[action.ActionType]
+		if _, ok := handlers[action.ActionType]; !ok && (mockedId || mockedType) {
+			handlers[action.ActionType] = mockHandler(nil, mocks)
+		}
+	}
+	handlers[HttpAction] = mockHandler(unmockedHandler, mocks)
+	handlers[CallActivityAction] = mockHandler(unmockedHandler, mocks)
+	simulation := &Parser{
+		key:      p.Key(),
+		handlers: handlers,
+		actions:  p.Actions(),
+		sessions: make([]Session, 0),
+		logger:   p.logger,
+		tracer:   p.tracer,
+		clock:    immediateClock{},
+		limits:   p.Limits(),
+		// tasks only expire when the scenario has no payload for them
+		holdDeadlines: true,
+	}
+	handlers[TimerAction] = mockHandler(simulation.TimerHandler, mocks)
+	handlers[ReceiveMessageAction] = mockHandler(simulation.ReceiveMessageHandler, mocks)
+	handlers[WaitSignalAction] = mockHandler(simulation.WaitSignalHandler, mocks)
+	handlers[CompensateAction] = mockHandler(simulation.CompensateHandler, mocks)
+	handlers[ParallelAction] = mockHandler(simulation.ParallelHandler, mocks)
+	handlers[JoinAction] = mockHandler(simulation.JoinHandler, mocks)
+	return simulation
+}
+
+func mockHandler(handler Handler, mocks map[string]Mock) Handler {
+	return func(ctx context.Context, action *Action, session Session) string {
+		mock, ok := mocks[action.ID]
+		if !ok {
+			mock, ok = mocks[action.ActionType]
+		}
+		if !ok {
+			if handler == nil {
+				return unmockedHandler(ctx, action, session)
+			}
+			return handler(ctx, action, session)
+		}
+		return mock.execute(action, session)
+	}
+}
+
+func (m Mock) execute(action *Action, session Session) string {
+	resultArgs := ResultArgs{}
+	_ = action.Args.Bind(&resultArgs)
+	if m.Result != nil {
+		session.Set(resultArgs.ResultVariable(action.ActionType), m.Result)
+	}
+	for key, value := range m.Values {
+		session.Set(key, value)
+	}
+	session.AddExecutedAction(&executedAction{
+		Action: *action,
+		Params: map[string]interface{}{
+			"mocked":  true,
+			"outcome": m.Outcome,
+		},
+	})
+	if m.Next != "" {
+		return m.Next
+	}
+	if m.Outcome == MockOutcomeFailure {
+		return action.OnFailure
+	}
+	return action.OnSuccess
+}
+
+func unmockedHandler(ctx context.Context, action *Action, session Session) string {
+	resultArgs := ResultArgs{}
+	_ = action.Args.Bind(&resultArgs)
+	AddActionError(session, resultArgs.ResultVariableAsError(action.ActionType), ErrNotMocked)
+	session.AddExecutedAction(&executedAction{
+		Action: *action,
+		Params: map[string]interface{}{"mocked": false},
+	})
+	return action.OnFailure
+}
@@ -0,0 +1,118 @@
+package parser
+
+import (
+	"context"
+	"testing"
+
+	"github.com/AkronimBlack/process-manager/shared"
+)
+
+func simulationParser() *Parser {
+	parser := NewParser()
+	parser.SetActions(map[string]*Action{
+		StartNode: {
+			ActionType: StartNode,
+			OnSuccess:  "fetch",
+		},
+		"fetch": {
+			ActionType: HttpAction,
+			Args: map[string]interface{}{
+				"url":    "http://partner.invalid/score",
+				"method": "get",
+				result:   "score",
+			},
+			OnSuccess: "approve",
+			OnFailure: "rejected",
+		},
+		"approve": {
+			ActionType: TaskAction,
+			Args:       map[string]interface{}{"id": "approve_task", "name": "approve", "wait": true},
+			OnSuccess:  "check",
+			OnFailure:  "rejected",
+		},
+		"check": {
+			ActionType: IsGreater,
+			Args: map[string]interface{}{
+				comparingKey: "{{input_data.amount}}",
+				compareToKey: "10",
+				result:       "big",
+			},
+			OnSuccess: "end",
+			OnFailure: "end",
+		},
+		"rejected": {
+			ActionType: IsEqual,
+			Args:       map[string]interface{}{comparingKey: "1", compareToKey: "1"},
+			OnSuccess:  "end",
+			OnFailure:  "end",
+		},
+	})
+	return parser
+}
+
+func TestParser_SimulateFollowsMockedPath(t *testing.T) {
+	parser := simulationParser()
+	result := parser.Simulate(context.Background(), Scenario{
+		Name: "approved",
+		Mocks: map[string]Mock{
+			"fetch": {Result: map[string]interface{}{"status_code": 200}},
+		},
+		Tasks: TaskCompletions{"approve": {"amount": 20}},
+		Expect: Expectation{
+			Status:  StatusCompleted,
+			Visited: []string{"fetch", "approve", "check"},
+			Values: map[string]interface{}{
+				"big":               true,
+				"score.status_code": 200,
+			},
+		},
+	})
+	if !result.Passed() {
+		t.Errorf("scenario failed\n%s", shared.ToJsonPrettyString(result.Failures))
+	}
+	if len(parser.Sessions()) != 0 {
+		t.Error("simulated session registered with the parser")
+	}
+}
+
+func TestParser_SimulateReportsUnexpectedPath(t *testing.T) {
+	result := simulationParser().Simulate(context.Background(), Scenario{
+		Expect: Expectation{
+			Visited: []string{"fetch", "approve", "check"},
+		},
+	})
+	if result.Passed() {
+		t.Fatal("expected unmocked http action to take on_failure")
+	}
+	if len(result.Visited) != 2 || result.Visited[1] != "rejected" {
+		t.Errorf("unexpected path %v", result.Visited)
+	}
+}
+
+func TestParser_SimulateReportsMissingTaskPayload(t *testing.T) {
+	result := simulationParser().Simulate(context.Background(), Scenario{
+		Mocks: map[string]Mock{HttpAction: {}},
+	})
+	if result.Passed() {
+		t.Fatal("expected failure for task without payload")
+	}
+	if result.Session.Status != StatusWaiting {
+		t.Errorf("expected waiting session, got %s", result.Session.Status)
+	}
+}
+
+func TestParser_SimulateExpiresTaskWithoutPayload(t *testing.T) {
+	parser := simulationParser()
+	parser.Actions()["approve"].Args["due_in"] = "48h"
+	parser.Actions()["approve"].Args["on_timeout"] = "rejected"
+	result := parser.Simulate(context.Background(), Scenario{
+		Mocks:  map[string]Mock{HttpAction: {}},
+		Expect: Expectation{Status: StatusCompleted, Visited: []string{"fetch", "approve", "rejected"}},
+	})
+	if !result.Passed() {
+		t.Fatalf("expected the task to time out, got %v", result.Failures)
+	}
+	if result.Session.Tasks[0].Status != TaskStatusCancelled {
+		t.Errorf("expected cancelled task, got %s", result.Session.Tasks[0].Status)
+	}
+}
@@ -0,0 +1,167 @@
+package parser
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// SessionCheckpoint is the state of an unfinished session at its current action.
+type SessionCheckpoint struct {
+	SessionDto
+	CheckpointedAt time.Time `json:"checkpointed_at"`
+}
+
+func NewSessionCheckpoint(session Session, at time.Time) SessionCheckpoint {
+	return SessionCheckpoint{SessionDto: NewSessionDto(session), CheckpointedAt: at}
+}
+
+// NewSessionFromCheckpoint rebuilds the session of a checkpoint with its uuid, values, executed actions, errors,
+// steps and tasks. Tasks keep their ids and status, their deadline only has the due time, see Parser.RestoreSessions.
+func NewSessionFromCheckpoint(checkpoint SessionCheckpoint) (Session, error) {
+	limits, err := checkpoint.Limits.Limits()
+	if err != nil {
+		return nil, fmt.Errorf("invalid checkpoint of session %s: %w", checkpoint.Uuid, err)
+	}
+	restored := &session{
+		uuid:                    checkpoint.Uuid,
+		processKey:              checkpoint.ProcessKey,
+		status:                  checkpoint.Status,
+		values:                  checkpoint.Values,
+		executedActions:         make([]ExecutedAction, len(checkpoint.ExecutedActions)),
+		inputData:               checkpoint.InputData,
+		tasks:                   make([]Task, 0),
+		onFinishWebhookResponse: checkpoint.OnFinishWebhookResponse,
+		errors:                  checkpoint.Errors,
+		started:                 checkpoint.StartedAt,
+		limits:                  limits,
+		steps:                   checkpoint.Steps,
+		currentAction:           checkpoint.CurrentAction,
+	}
+	if restored.values == nil {
+		restored.values = map[string]interface{}{}
+	}
+	if checkpoint.OnFinishWebhook != nil {
+		restored.onFinishWebhook = NewWebHook(checkpoint.OnFinishWebhook.Url)
+	}
+	for i, executed := range checkpoint.ExecutedActions {
+		restored.executedActions[i] = &executedAction{
+			Action: Action{
+				ID:         executed.ID,
+				ActionType: executed.ActionType,
+				Args:       executed.Args,
+				OnSuccess:  executed.OnSuccess,
+				OnFailure:  executed.OnFailure,
+			},
+			Params: executed.Params,
+			failed: executed.Failed,
+		}
+	}
+	for _, checkpointed := range checkpoint.Tasks {
+		restored.tasks = append(restored.tasks, newTaskFromDto(checkpointed, restored))
+	}
+	return restored, nil
+}
+
+func newTaskFromDto(dto TaskDto, session Session) *task {
+	restored := &task{
+		id:            dto.ID,
+		definitionKey: dto.DefinitionKey,
+		actionId:      dto.ActionId,
+		businessKey:   dto.BusinessKey,
+		name:          dto.Name,
+		next:          dto.Next,
+		parameters:    dto.Parameters,
+		session:       session,
+		status:        dto.Status,
+		assignment: TaskAssignment{
+			Assignee:        dto.Assignee,
+			CandidateUsers:  dto.CandidateUsers,
+			CandidateGroups: dto.CandidateGroups,
+		},
+		form:    dto.Form,
+		created: dto.CreatedAt,
+	}
+	if dto.DueAt != nil {
+		restored.deadline.Due = *dto.DueAt
+	}
+	return restored
+}
+
+// SessionStore keeps checkpoints of sessions, see Parser.Shutdown and Parser.RestoreSessions.
+type SessionStore interface {
+	Save(checkpoint SessionCheckpoint) error
+	Load(uuid string) (SessionCheckpoint, error)
+	// List returns the uuids of the checkpointed sessions.
+	List() ([]string, error)
+	Delete(uuid string) error
+}
+
+// FileSessionStore keeps every checkpoint as <uuid>.json in a directory.
+type FileSessionStore struct {
+	dir string
+}
+
+// NewFileSessionStore creates the directory if it does not exist.
+func NewFileSessionStore(dir string) (*FileSessionStore, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &FileSessionStore{dir: dir}, nil
+}
+
+// Save replaces the checkpoint of the session, a partially written checkpoint never replaces the previous one.
+func (s *FileSessionStore) Save(checkpoint SessionCheckpoint) error {
+	content, err := json.Marshal(checkpoint)
+	if err != nil {
+		return err
+	}
+	temporary, err := os.CreateTemp(s.dir, checkpoint.Uuid+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(temporary.Name())
+	if _, err = temporary.Write(content); err != nil {
+		temporary.Close()
+		return err
+	}
+	if err = temporary.Close(); err != nil {
+		return err
+	}
+	return os.Rename(temporary.Name(), s.path(checkpoint.Uuid))
+}
+
+func (s *FileSessionStore) Load(uuid string) (SessionCheckpoint, error) {
+	checkpoint := SessionCheckpoint{}
+	content, err := os.ReadFile(s.path(uuid))
+	if err != nil {
+		return checkpoint, err
+	}
+	if err = json.Unmarshal(content, &checkpoint); err != nil {
+		return checkpoint, fmt.Errorf("invalid checkpoint of session %s: %w", uuid, err)
+	}
+	return checkpoint, nil
+}
+
+func (s *FileSessionStore) List() ([]string, error) {
+	files, err := filepath.Glob(filepath.Join(s.dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	uuids := make([]string, len(files))
+	for i, file := range files {
+		uuids[i] = strings.TrimSuffix(filepath.Base(file), ".json")
+	}
+	return uuids, nil
+}
+
+func (s *FileSessionStore) Delete(uuid string) error {
+	return os.Remove(s.path(uuid))
+}
+
+func (s *FileSessionStore) path(uuid string) string {
+	return filepath.Join(s.dir, filepath.Base(uuid)+".json")
+}
@@ -0,0 +1,97 @@
+package parser
+
+import (
+	"context"
+	"log/slog"
+	"time"
+)
+
+const TaskReminderEvent = "task_reminder"
+
+// TaskReminderDto is posted to the reminder webhook of a pending task.
+type TaskReminderDto struct {
+	Event string    `json:"event"`
+	DueAt time.Time `json:"due_at"`
+	Task  TaskDto   `json:"task"`
+}
+
+// scheduleDeadline starts the reminder and expiry timers of a task with a due time on the parser clock.
+func (p *Parser) scheduleDeadline(task Task) {
+	deadline := task.Deadline()
+	if deadline.Due.IsZero() || p.holdDeadlines {
+		return
+	}
+	now := p.Clock().Now()
+	for _, remindAt := range deadline.Reminders {
+		if remindAt.Before(now) {
+			continue
+		}
+		p.Clock().AfterFunc(remindAt.Sub(now), func() {
+			p.remindTask(task)
+		})
+	}
+	p.Clock().AfterFunc(deadline.Due.Sub(now), func() {
+		p.expireTask(task)
+	})
+}
+
+// remindTask posts a reminder for a task that is still pending.
+func (p *Parser) remindTask(task Task) {
+	if !TaskPending(task) {
+		return
+	}
+	session := task.Session()
+	logger := p.sessionLogger(session).With(slog.String("task_id", task.ID()))
+	webhook := task.Deadline().ReminderWebhook
+	if !hasWebhook(webhook) {
+		webhook = session.OnFinishWebhook()
+	}
+	if !hasWebhook(webhook) {
+		logger.Debug("no webhook for task reminder")
+		return
+	}
+	_, deliveryResult := p.postWebhook(context.Background(), session, webhook.Url(), TaskReminderDto{
+		Event: TaskReminderEvent,
+		DueAt: task.Deadline().Due,
+		Task:  NewTaskDto(task),
+	})
+	logger.Info("task reminder sent", slog.String("result", deliveryResult))
+}
+
+// expireTask escalates a task that is still pending at its due time. The task is reassigned when the deadline
+// escalates to other users, otherwise it is cancelled and a session waiting for it continues at on_timeout.
+func (p *Parser) expireTask(task Task) {
+	deadline := task.Deadline()
+	session := task.Session()
+	logger := p.sessionLogger(session).With(slog.String("task_id", task.ID()))
+	p.lock.Lock()
+	if !TaskPending(task) {
+		p.lock.Unlock()
+		return
+	}
+	if deadline.EscalateTo != nil {
+		err := task.Reassign(*deadline.EscalateTo)
+		p.lock.Unlock()
+		if err != nil {
+			return
+		}
+		setTaskResult(session, deadline, taskEscalated)
+		logger.Info("task expired, escalated")
+		return
+	}
+	task.Cancel()
+	p.lock.Unlock()
+	setTaskResult(session, deadline, taskTimedOut)
+	if task.Next() == "" {
+		logger.Info("task expired, cancelled")
+		return
+	}
+	logger.Info("task expired, continuing at on_timeout", slog.String("next", deadline.OnTimeout))
+	p.wakeQueued(session, task.ActionId(), deadline.OnTimeout, runInline)
+}
+
+func setTaskResult(session Session, deadline TaskDeadline, value string) {
+	if deadline.Result != "" {
+		session.Set(deadline.Result, value)
+	}
+}
@@ -0,0 +1,216 @@
+package parser
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	TaskSortCreated           = "created_at"
+	TaskSortCreatedDescending = "-created_at"
+	TaskSortName              = "name"
+	TaskSortNameDescending    = "-name"
+)
+
+// TaskSorts are the supported TaskQuery sort orders.
+var TaskSorts = map[string]bool{
+	TaskSortCreated:           true,
+	TaskSortCreatedDescending: true,
+	TaskSortName:              true,
+	TaskSortNameDescending:    true,
+}
+
+// TaskQuery filters the task index, empty fields do not filter.
+type TaskQuery struct {
+	Name           string
+	DefinitionKey  string
+	BusinessKey    string
+	Status         string
+	Assignee       string
+	CandidateGroup string
+	ProcessKey     string
+	CreatedAfter   time.Time
+	CreatedBefore  time.Time
+	// Sort is one of TaskSorts, oldest first by default.
+	Sort   string
+	Offset int
+	// Limit of returned tasks, no limit when 0.
+	Limit int
+}
+
+// TaskIndex indexes the tasks of all sessions by id, keys, name and process key. A nil index ignores every call.
+type TaskIndex struct {
+	tasks           []Task
+	byId            map[string][]Task
+	byBusinessKey   map[string][]Task
+	byDefinitionKey map[string][]Task
+	byName          map[string][]Task
+	byProcess       map[string][]Task
+	// indexed counts the tasks of a session that are already in the index.
+	indexed map[string]int
+
+	lock sync.RWMutex
+}
+
+func NewTaskIndex() *TaskIndex {
+	return &TaskIndex{
+		byId:            map[string][]Task{},
+		byBusinessKey:   map[string][]Task{},
+		byDefinitionKey: map[string][]Task{},
+		byName:          map[string][]Task{},
+		byProcess:       map[string][]Task{},
+		indexed:         map[string]int{},
+	}
+}
+
+// sync adds the tasks the session created since the last call.
+func (i *TaskIndex) sync(session Session) {
+	if i == nil {
+		return
+	}
+	tasks := session.Tasks()
+	i.lock.Lock()
+	defer i.lock.Unlock()
+	for _, newTask := range tasks[i.indexed[session.Uuid()]:] {
+		i.tasks = append(i.tasks, newTask)
+		i.byId[newTask.ID()] = append(i.byId[newTask.ID()], newTask)
+		if newTask.BusinessKey() != "" {
+			i.byBusinessKey[newTask.BusinessKey()] = append(i.byBusinessKey[newTask.BusinessKey()], newTask)
+		}
+		i.byDefinitionKey[newTask.DefinitionKey()] = append(i.byDefinitionKey[newTask.DefinitionKey()], newTask)
+		i.byName[newTask.Name()] = append(i.byName[newTask.Name()], newTask)
+		i.byProcess[session.ProcessKey()] = append(i.byProcess[session.ProcessKey()], newTask)
+	}
+	i.indexed[session.Uuid()] = len(tasks)
+}
+
+// remove drops the tasks of the sessions with the uuids.
+func (i *TaskIndex) remove(uuids map[string]bool) {
+	if i == nil {
+		return
+	}
+	i.lock.Lock()
+	defer i.lock.Unlock()
+	i.tasks = tasksWithout(i.tasks, uuids)
+	for _, index := range []map[string][]Task{i.byId, i.byBusinessKey, i.byDefinitionKey, i.byName, i.byProcess} {
+		for key, tasks := range index {
+			if remaining := tasksWithout(tasks, uuids); len(remaining) != 0 {
+				index[key] = remaining
+			} else {
+				delete(index, key)
+			}
+		}
+	}
+	for uuid := range uuids {
+		delete(i.indexed, uuid)
+	}
+}
+
+// tasksWithout copies the tasks that do not belong to the sessions.
+func tasksWithout(tasks []Task, uuids map[string]bool) []Task {
+	remaining := make([]Task, 0, len(tasks))
+	for _, candidate := range tasks {
+		if candidate.Session() == nil || !uuids[candidate.Session().Uuid()] {
+			remaining = append(remaining, candidate)
+		}
+	}
+	return remaining
+}
+
+// Find returns the task with the id, or else every task with the business key or else the definition key.
+func (i *TaskIndex) Find(idOrKey string) []Task {
+	if i == nil {
+		return nil
+	}
+	i.lock.RLock()
+	defer i.lock.RUnlock()
+	for _, tasks := range []map[string][]Task{i.byId, i.byBusinessKey, i.byDefinitionKey} {
+		if len(tasks[idOrKey]) != 0 {
+			return append([]Task{}, tasks[idOrKey]...)
+		}
+	}
+	return []Task{}
+}
+
+// Query returns a page of the matching tasks and the total number of matches.
+func (i *TaskIndex) Query(query TaskQuery) ([]Task, int) {
+	if i == nil {
+		return []Task{}, 0
+	}
+	i.lock.RLock()
+	candidates := i.tasks
+	if query.Name != "" {
+		candidates = i.byName[query.Name]
+	}
+	if query.ProcessKey != "" && (query.Name == "" || len(i.byProcess[query.ProcessKey]) < len(candidates)) {
+		candidates = i.byProcess[query.ProcessKey]
+	}
+	candidates = append([]Task{}, candidates...)
+	i.lock.RUnlock()
+
+	matches := make([]Task, 0, len(candidates))
+	for _, candidate := range candidates {
+		if query.matches(candidate) {
+			matches = append(matches, candidate)
+		}
+	}
+	sort.SliceStable(matches, func(a, b int) bool {
+		switch query.Sort {
+		case TaskSortCreatedDescending:
+			return matches[a].Created().After(matches[b].Created())
+		case TaskSortName:
+			return matches[a].Name() < matches[b].Name()
+		case TaskSortNameDescending:
+			return matches[a].Name() > matches[b].Name()
+		}
+		return matches[a].Created().Before(matches[b].Created())
+	})
+
+	total := len(matches)
+	if query.Offset >= total {
+		return []Task{}, total
+	}
+	matches = matches[query.Offset:]
+	if query.Limit > 0 && query.Limit < len(matches) {
+		matches = matches[:query.Limit]
+	}
+	return matches, total
+}
+
+func (q TaskQuery) matches(candidate Task) bool {
+	if q.Name != "" && candidate.Name() != q.Name {
+		return false
+	}
+	if q.DefinitionKey != "" && candidate.DefinitionKey() != q.DefinitionKey {
+		return false
+	}
+	if q.BusinessKey != "" && candidate.BusinessKey() != q.BusinessKey {
+		return false
+	}
+	if q.ProcessKey != "" && (candidate.Session() == nil || candidate.Session().ProcessKey() != q.ProcessKey) {
+		return false
+	}
+	if q.Status != "" && candidate.Status() != q.Status {
+		return false
+	}
+	if !q.CreatedAfter.IsZero() && !candidate.Created().After(q.CreatedAfter) {
+		return false
+	}
+	if !q.CreatedBefore.IsZero() && !candidate.Created().Before(q.CreatedBefore) {
+		return false
+	}
+	assignment := candidate.Assignment()
+	if q.Assignee != "" && assignment.Assignee != q.Assignee {
+		return false
+	}
+	if q.CandidateGroup != "" {
+		for _, group := range assignment.CandidateGroups {
+			if group == q.CandidateGroup {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
@@ -0,0 +1,101 @@
+package parser
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func indexedTasks(index *TaskIndex) {
+	created := time.Date(2023, time.March, 1, 9, 0, 0, 0, time.UTC)
+	for i, processKey := range []string{"loans", "loans", "leases"} {
+		session := NewSession(map[string]interface{}{}, nil)
+		session.SetProcessKey(processKey)
+		session.AddTask(NewTaskWithOptions("approve", "approve", "end", nil, TaskOptions{
+			Assignment: TaskAssignment{CandidateGroups: []string{"risk"}},
+			Created:    created.Add(time.Duration(i) * time.Hour),
+		}, session))
+		session.AddTask(NewTaskWithOptions("review", "review", "end", nil, TaskOptions{
+			Assignment: TaskAssignment{Assignee: "alice"},
+			Created:    created.Add(time.Duration(i)*time.Hour + time.Minute),
+		}, session))
+		index.sync(session)
+		index.sync(session)
+	}
+}
+
+func TestTaskIndex_Query(t *testing.T) {
+	index := NewTaskIndex()
+	indexedTasks(index)
+
+	tasks, total := index.Query(TaskQuery{})
+	if total != 6 || len(tasks) != 6 {
+		t.Fatalf("expected every task indexed once, got %d", total)
+	}
+	tasks, total = index.Query(TaskQuery{Name: "approve", ProcessKey: "loans", Sort: TaskSortCreatedDescending})
+	if total != 2 || !tasks[0].Created().After(tasks[1].Created()) {
+		t.Errorf("expected 2 loan approvals newest first, got %d", total)
+	}
+	_, total = index.Query(TaskQuery{CandidateGroup: "risk", Status: TaskStatusOpen})
+	if total != 3 {
+		t.Errorf("expected 3 open risk tasks, got %d", total)
+	}
+	_, total = index.Query(TaskQuery{Assignee: "alice", CreatedAfter: time.Date(2023, time.March, 1, 10, 0, 0, 0, time.UTC)})
+	if total != 2 {
+		t.Errorf("expected 2 tasks of alice created after 10:00, got %d", total)
+	}
+	tasks, total = index.Query(TaskQuery{Sort: TaskSortName, Offset: 2, Limit: 2})
+	if total != 6 || len(tasks) != 2 || tasks[0].Name() != "approve" || tasks[1].Name() != "review" {
+		t.Errorf("expected second page of names, got %d tasks of %d", len(tasks), total)
+	}
+	if len(index.Find("approve")) != 3 {
+		t.Errorf("expected 3 tasks with id approve, got %d", len(index.Find("approve")))
+	}
+}
+
+func TestParserHttpHandler_QueryTasks(t *testing.T) {
+	parser := NewParser()
+	parser.SetKey("loans")
+	parser.SetActions(Actions{
+		StartNode: {ActionType: StartNode, OnSuccess: "approve"},
+		"approve": {
+			ActionType: TaskAction,
+			Args:       Args{"id": "approve", "name": "approve", "candidate_groups": []interface{}{"risk"}, "wait": true},
+			OnSuccess:  "end",
+			OnFailure:  "end",
+		},
+	})
+	session := parser.Run(context.Background(), map[string]interface{}{}, nil)
+	parser.Run(context.Background(), map[string]interface{}{}, nil)
+	router := newTestRouter(parser)
+
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/api/tasks?candidate_group=risk&process_key=loans&limit=1", nil))
+	var page TaskPageDto
+	if err := json.Unmarshal(recorder.Body.Bytes(), &page); err != nil || page.Total != 2 || len(page.Items) != 1 {
+		t.Fatalf("expected first of 2 tasks, got %d %s", recorder.Code, recorder.Body.String())
+	}
+	if page.Items[0].SessionUuid != session.Uuid() || page.Items[0].Status != TaskStatusOpen {
+		t.Errorf("expected oldest task first, got %+v", page.Items[0])
+	}
+
+	recorder = httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/api/tasks/approve", nil))
+	if recorder.Code != http.StatusConflict {
+		t.Errorf("expected shared task id to conflict, got %d", recorder.Code)
+	}
+	recorder = httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/api/tasks/approve?session="+session.Uuid(), nil))
+	if recorder.Code != http.StatusOK {
+		t.Errorf("expected task of the session, got %d", recorder.Code)
+	}
+
+	recorder = httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/api/tasks?sort=priority", nil))
+	if recorder.Code != http.StatusUnprocessableEntity {
+		t.Errorf("expected unknown sort to be rejected, got %d", recorder.Code)
+	}
+}
@@ -0,0 +1,99 @@
+package parser
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	tracerName  = "github.com/AkronimBlack/process-manager/pkg/parser"
+	serviceName = "process-manager"
+
+	TraceExporterNone   = "none"
+	TraceExporterStdout = "stdout"
+	TraceExporterOtlp   = "otlp"
+
+	processKeyAttribute  = attribute.Key("process.key")
+	sessionUuidAttribute = attribute.Key("session.uuid")
+	actionIdAttribute    = attribute.Key("action.id")
+	actionTypeAttribute  = attribute.Key("action.type")
+)
+
+// Propagator reads and writes W3C trace context and baggage headers.
+var Propagator propagation.TextMapPropagator = propagation.NewCompositeTextMapPropagator(
+	propagation.TraceContext{},
+	propagation.Baggage{},
+)
+
+// NewTracerProvider builds a tracer provider exporting to stdout or to an OTLP http endpoint.
+// An empty endpoint falls back to the OTEL_EXPORTER_OTLP_* environment variables.
+func NewTracerProvider(ctx context.Context, exporter string, endpoint string) (*sdktrace.TracerProvider, error) {
+	var spanExporter sdktrace.SpanExporter
+	var err error
+	switch exporter {
+	case TraceExporterStdout:
+		spanExporter, err = stdouttrace.New(stdouttrace.WithWriter(os.Stdout))
+	case TraceExporterOtlp:
+		var options []otlptracehttp.Option
+		if endpoint != "" {
+			options = append(options, otlptracehttp.WithEndpoint(endpoint), otlptracehttp.WithInsecure())
+		}
+		spanExporter, err = otlptracehttp.New(ctx, options...)
+	case TraceExporterNone, "":
+		return sdktrace.NewTracerProvider(), nil
+	default:
+		return nil, fmt.Errorf("unknown trace exporter %s", exporter)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(spanExporter),
+		sdktrace.WithResource(resource.NewSchemaless(semconv.ServiceName(serviceName))),
+	), nil
+}
+
+// SetTracerProvider overrides the globally registered tracer provider for this parser.
+func (p *Parser) SetTracerProvider(provider trace.TracerProvider) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.tracer = provider.Tracer(tracerName)
+}
+
+func (p *Parser) Tracer() trace.Tracer {
+	if p.tracer == nil {
+		return otel.Tracer(tracerName)
+	}
+	return p.tracer
+}
+
+func (p *Parser) startSessionSpan(ctx context.Context, session Session) context.Context {
+	ctx, _ = p.Tracer().Start(ctx, fmt.Sprintf("session %s", session.ProcessKey()),
+		trace.WithAttributes(
+			processKeyAttribute.String(session.ProcessKey()),
+			sessionUuidAttribute.String(session.Uuid()),
+		),
+	)
+	return ctx
+}
+
+func (p *Parser) startActionSpan(ctx context.Context, actionId string, action *Action, session Session) (context.Context, trace.Span) {
+	return p.Tracer().Start(ctx, fmt.Sprintf("action %s", action.ActionType),
+		trace.WithAttributes(
+			sessionUuidAttribute.String(session.Uuid()),
+			actionIdAttribute.String(actionId),
+			actionTypeAttribute.String(action.ActionType),
+		),
+	)
+}
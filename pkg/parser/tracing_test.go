@@ -0,0 +1,105 @@
+package parser
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func newTracedParser(actions Actions) (*Parser, *tracetest.InMemoryExporter) {
+	exporter := tracetest.NewInMemoryExporter()
+	parser := NewParser()
+	parser.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter)))
+	parser.SetActions(actions)
+	return parser, exporter
+}
+
+func TestParser_TracesSessionWithSpanPerAction(t *testing.T) {
+	parser, exporter := newTracedParser(map[string]*Action{
+		StartNode: {
+			ActionType: StartNode,
+			OnSuccess:  "test_id_1",
+		},
+		"test_id_1": {
+			ActionType: IsGreater,
+			Args:       map[string]interface{}{comparingKey: 10, compareToKey: 11},
+			OnSuccess:  "test_id_2",
+			OnFailure:  "test_id_2",
+		},
+		"test_id_2": {
+			ActionType: IsEqual,
+			Args:       map[string]interface{}{comparingKey: 10, compareToKey: 10},
+		},
+	})
+
+	remote := trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    trace.TraceID{1, 2, 3},
+		SpanID:     trace.SpanID{4, 5, 6},
+		TraceFlags: trace.FlagsSampled,
+		Remote:     true,
+	})
+	ctx, session := parser.startSession(trace.ContextWithRemoteSpanContext(context.Background(), remote), nil, nil)
+	parser.runActionById(ctx, parser.Actions()[StartNode].OnSuccess, session)
+
+	spans := exporter.GetSpans()
+	if len(spans) != 3 {
+		t.Fatalf("expected 3 spans, got %d", len(spans))
+	}
+	sessionSpan := spans[len(spans)-1]
+	if sessionSpan.Name != "session default" {
+		t.Errorf("expected session span last, got %s", sessionSpan.Name)
+	}
+	if sessionSpan.Parent.SpanID() != remote.SpanID() {
+		t.Errorf("session span is not a child of the incoming trace context")
+	}
+	for _, span := range spans[:2] {
+		if span.SpanContext.TraceID() != remote.TraceID() {
+			t.Errorf("span %s is not part of the session trace", span.Name)
+		}
+		if span.Parent.SpanID() != sessionSpan.SpanContext.SpanID() {
+			t.Errorf("span %s is not a child of the session span", span.Name)
+		}
+	}
+	if spans[0].Name != "action "+IsGreater || spans[1].Name != "action "+IsEqual {
+		t.Errorf("unexpected action spans %s, %s", spans[0].Name, spans[1].Name)
+	}
+}
+
+func TestHttpHandler_PropagatesTraceContext(t *testing.T) {
+	var traceparent string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		traceparent = r.Header.Get("traceparent")
+	}))
+	defer server.Close()
+
+	exporter := tracetest.NewInMemoryExporter()
+	ctx, span := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter)).Tracer("test").Start(context.Background(), "test")
+	action := &Action{
+		ActionType: HttpAction,
+		Args: map[string]interface{}{
+			"url":     server.URL,
+			"method":  "get",
+			"timeout": 500,
+		},
+		OnSuccess: "test_1",
+		OnFailure: "test_2",
+	}
+	HttpHandler(ctx, action, NewSession(map[string]interface{}{}, nil))
+	span.End()
+
+	if traceparent == "" {
+		t.Fatal("traceparent header was not sent")
+	}
+	extracted := trace.SpanContextFromContext(
+		Propagator.Extract(context.Background(), propagation.HeaderCarrier{"Traceparent": []string{traceparent}}),
+	)
+	if extracted.TraceID() != span.SpanContext().TraceID() {
+		t.Errorf("traceparent %s does not carry the action trace id", traceparent)
+	}
+}
@@ -2,13 +2,13 @@ package shared
 
 import (
 	"encoding/json"
-	"log"
+	"log/slog"
 )
 
 func ToJsonByte(value interface{}) []byte {
 	v, err := json.Marshal(value)
 	if err != nil {
-		log.Println(err.Error())
+		slog.Error("failed to marshal json", slog.String("error", err.Error()))
 	}
 	return v
 }
@@ -16,7 +16,7 @@ func ToJsonByte(value interface{}) []byte {
 func ToJsonPrettyByte(value interface{}) []byte {
 	v, err := json.MarshalIndent(value, "", "    ")
 	if err != nil {
-		log.Println(err.Error())
+		slog.Error("failed to marshal json", slog.String("error", err.Error()))
 	}
 	return v
 }